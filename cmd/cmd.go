@@ -1,16 +1,35 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"syscall"
 	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/assembler"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/canary"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/chunkcache"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/correlator"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/decoder"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/downloader"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/eta"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/imagery"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/polling"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/rules"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/server"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/status"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sweeps"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/systemd"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/tracing"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/zones"
 	"github.com/spf13/cobra"
 	"github.com/ztrue/shutdown"
 	"golang.org/x/sync/errgroup"
@@ -40,26 +59,152 @@ func run(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	var shutdownTracing func(context.Context) error
+	if config.HTTP.Tracing.Enabled {
+		shutdownTracing, err = tracing.Setup(cmd.Context(), &config.HTTP.Tracing, cmd.Annotations["version"], cmd.Annotations["commit"])
+		if err != nil {
+			return fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		slog.Info("Tracing enabled", "protocol", config.HTTP.Tracing.Protocol, "sampleRate", config.HTTP.Tracing.SampleRate)
+	}
+
+	// Keys are loaded before any AWS resources are created, so a bad one
+	// leaves nothing behind.
+	var authenticator *auth.Authenticator
+	if config.HTTP.Auth.Enabled {
+		authenticator, err = auth.NewAuthenticator(&config.HTTP.Auth)
+		if err != nil {
+			return fmt.Errorf("failed to set up auth: %w", err)
+		}
+		slog.Info("Websocket auth enabled", "apiKeys", len(config.HTTP.Auth.APIKeys))
+	}
+
 	// Initialize the websocket event bus
 	eventBus := events.NewEventBus()
 	slog.Info("Event bus started")
 
 	eventChannel := eventBus.GetChannel()
-	sqsListener, err := sqs.NewListener(eventChannel)
+	sqsListener, err := sqs.NewListener(&config.Ingest, eventChannel)
 	if err != nil {
 		return fmt.Errorf("failed to create SQS listener: %w", err)
 	}
-	slog.Info("SQS listener started")
+
+	s3Client := s3.NewClient(config.S3.Endpoint)
+
+	var chunkCache *chunkcache.Cache
+	if config.ChunkCache.Enabled {
+		chunkCache = chunkcache.NewCache(&config.ChunkCache, s3Client, sqsListener, eventBus.Subscribe())
+		slog.Info("Chunk proxy started", "directory", config.ChunkCache.Directory, "maxSizeMB", config.ChunkCache.MaxSize)
+	}
+
+	// With the chunk cache, the decoder, assembler and chunk proxy share one
+	// fetch of each chunk.
+	var chunkGetter s3.Getter = s3Client
+	if chunkCache != nil {
+		chunkGetter = chunkCache
+	}
+
+	registry := stations.NewRegistry()
+
+	var sweepTracker *sweeps.Tracker
+	if config.Decoder.Enabled {
+		sqsListener.SetChunkEnricher(decoder.NewDecoder(chunkGetter, registry), time.Duration(config.Decoder.Timeout))
+		sweepTracker = sweeps.NewTracker(eventBus.Subscribe(), eventChannel)
+		slog.Info("Chunk decoding enabled")
+	}
+
+	var ruleEngine *rules.Engine
+	if len(config.Rules) > 0 {
+		ruleEngine = rules.NewEngine(config.Rules, eventBus.Subscribe(), eventChannel)
+		slog.Info("Rule engine started", "rules", len(config.Rules))
+	}
+
+	var volumeCorrelator *correlator.Correlator
+	if config.Correlator.Enabled {
+		volumeCorrelator = correlator.NewCorrelator(&config.Correlator, sqsListener, eventBus.Subscribe(), eventChannel)
+		slog.Info("Volume correlator started", "window", time.Duration(config.Correlator.Window))
+	}
+
+	estimator := eta.NewEstimator(eventBus.Subscribe())
+
+	statusTracker := status.NewTracker(&config.Status, sqsListener, eventBus.Subscribe(), eventChannel)
+
+	var zoneMonitor *zones.Monitor
+	if len(config.Zones) > 0 {
+		zoneMonitor = zones.NewMonitor(config.Zones, registry, eventBus.Subscribe(), eventChannel)
+		slog.Info("Zone monitor started", "zones", len(config.Zones))
+	}
+
+	var imager *imagery.Imager
+	if config.Imagery.Enabled {
+		imager = imagery.NewImager(&config.Imagery, registry, sqsListener, eventBus.Subscribe(), eventChannel)
+		slog.Info("Imagery started", "directory", config.Imagery.Directory)
+	}
+
+	var objectDownloader *downloader.Downloader
+	if config.Downloader.Enabled {
+		objectDownloader = downloader.NewDownloader(&config.Downloader, s3Client, sqsListener, eventBus.Subscribe(), eventChannel)
+		slog.Info("Downloader started", "directory", config.Downloader.Directory)
+	}
+
+	var volumeAssembler *assembler.Assembler
+	if config.Assembler.Enabled {
+		volumeAssembler = assembler.NewAssembler(&config.Assembler, chunkGetter, sqsListener, eventBus.Subscribe(), eventChannel)
+		volumeAssembler.SetEstimator(estimator)
+		slog.Info("Volume assembler started", "directory", config.Assembler.Directory)
+	}
+
+	var pollingDirectory *polling.Directory
+	if config.Polling.Enabled {
+		// The directories are kept whether or not anyone is watching the
+		// stations, so their chunks are always received.
+		for _, station := range config.Polling.Stations {
+			err = sqsListener.ListenChunk(cmd.Context(), station)
+			if err != nil {
+				return fmt.Errorf("failed to listen for %s chunks: %w", station, err)
+			}
+		}
+		pollingDirectory = polling.NewDirectory(&config.Polling, eventBus.Subscribe())
+		slog.Info("Polling directory started", "directory", config.Polling.Directory, "stations", config.Polling.Stations)
+	}
+
+	var ingestCanary *canary.Canary
+	if config.Ingest.Canary.Enabled {
+		ingestCanary = canary.NewCanary(&config.Ingest.Canary, sqsListener, sqsListener.Health())
+		slog.Info("Canary started", "interval", time.Duration(config.Ingest.Canary.Interval))
+	}
 
 	slog.Info("Starting HTTP server")
-	server := server.NewServer(&config.HTTP, eventChannel, sqsListener)
+	server := server.NewServer(&config.HTTP, eventBus.Subscribe(), sqsListener, imager, statusTracker, estimator, pollingDirectory, chunkCache, ingestCanary, authenticator)
 	err = server.Start()
 	if err != nil {
 		return fmt.Errorf("failed to start HTTP server: %w", err)
 	}
 
+	// In http ingest mode SNS confirms the subscription by calling back into
+	// the server, so the listener can only start once it is up.
+	err = sqsListener.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start SQS listener: %w", err)
+	}
+	slog.Info("SQS listener started", "mode", config.Ingest.Mode)
+
+	if err := systemd.Notify(systemd.StateReady); err != nil {
+		slog.Warn("Failed to tell systemd we are ready", "error", err)
+	}
+	var watchdog *systemd.Watchdog
+	if interval, ok := systemd.WatchdogInterval(); ok {
+		// Pings stop once the listener is no longer live, so systemd
+		// restarts us just as a failing /healthz would.
+		watchdog = systemd.NewWatchdog(interval, sqsListener.Health().Live)
+		slog.Info("Systemd watchdog started", "interval", interval)
+	}
+
 	stop := func(sig os.Signal) {
 		slog.Info("Shutting down")
+		if err := systemd.Notify(systemd.StateStopping); err != nil {
+			slog.Warn("Failed to tell systemd we are stopping", "error", err)
+		}
 
 		errGrp := errgroup.Group{}
 
@@ -71,9 +216,92 @@ func run(cmd *cobra.Command, _ []string) error {
 			return sqsListener.Stop()
 		})
 
+		errGrp.Go(func() error {
+			return statusTracker.Stop()
+		})
+
+		errGrp.Go(func() error {
+			return estimator.Stop()
+		})
+
+		if objectDownloader != nil {
+			errGrp.Go(func() error {
+				return objectDownloader.Stop()
+			})
+		}
+
+		if volumeAssembler != nil {
+			errGrp.Go(func() error {
+				return volumeAssembler.Stop()
+			})
+		}
+
+		if sweepTracker != nil {
+			errGrp.Go(func() error {
+				return sweepTracker.Stop()
+			})
+		}
+
+		if imager != nil {
+			errGrp.Go(func() error {
+				return imager.Stop()
+			})
+		}
+
+		if ruleEngine != nil {
+			errGrp.Go(func() error {
+				return ruleEngine.Stop()
+			})
+		}
+
+		if volumeCorrelator != nil {
+			errGrp.Go(func() error {
+				return volumeCorrelator.Stop()
+			})
+		}
+
+		if chunkCache != nil {
+			errGrp.Go(func() error {
+				return chunkCache.Stop()
+			})
+		}
+
+		if pollingDirectory != nil {
+			errGrp.Go(func() error {
+				return pollingDirectory.Stop()
+			})
+		}
+
+		if zoneMonitor != nil {
+			errGrp.Go(func() error {
+				return zoneMonitor.Stop()
+			})
+		}
+
+		if ingestCanary != nil {
+			errGrp.Go(func() error {
+				return ingestCanary.Stop()
+			})
+		}
+
+		if watchdog != nil {
+			errGrp.Go(func() error {
+				return watchdog.Stop()
+			})
+		}
+
 		err := errGrp.Wait()
 		// We always want to close the event channel before exiting
 		close(eventChannel)
+		if shutdownTracing != nil {
+			// Flush whatever spans the shutdown produced, without waiting
+			// forever on a collector that has gone away.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := shutdownTracing(ctx); err != nil {
+				slog.Warn("Failed to flush traces", "error", err)
+			}
+			cancel()
+		}
 		if err != nil {
 			slog.Error("Shutdown error", "error", err.Error())
 			os.Exit(1)
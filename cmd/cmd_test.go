@@ -10,7 +10,7 @@ func TestDefault(t *testing.T) {
 	t.Parallel()
 	baseCmd := cmd.NewCommand("testing", "default")
 	// Avoid port conflict
-	baseCmd.SetArgs([]string{"--http.port", "8082", "--http.metrics.port", "8083"})
+	baseCmd.SetArgs([]string{"--http.listen", ":8082", "--http.metrics.listen", "127.0.0.1:8083"})
 	err := baseCmd.Execute()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
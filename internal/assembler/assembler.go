@@ -0,0 +1,332 @@
+package assembler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+)
+
+const (
+	// maxFetches bounds concurrent chunk downloads across all volumes.
+	maxFetches = 8
+	// fetchAttempts is how many times a chunk is requested before it is
+	// treated as missing.
+	fetchAttempts = 3
+	// finishedRetention is how long a finished volume's late and duplicate
+	// chunks are dropped rather than starting the volume over.
+	finishedRetention = time.Hour
+	// partialSuffix keeps a partial volume's file from taking the name of the
+	// complete one.
+	partialSuffix = ".partial"
+)
+
+// Subscriptions reports which stations currently have clients.
+type Subscriptions interface {
+	Subscribed(station string) bool
+}
+
+// Estimator predicts when a station's next volume will arrive.
+type Estimator interface {
+	Estimate(station string) (events.VolumeETA, bool)
+}
+
+type volumeKey struct {
+	station string
+	number  int
+	start   time.Time
+}
+
+// volume collects one volume scan's chunks until the E chunk and everything
+// before it has arrived.
+type volume struct {
+	chunks  map[int][]byte
+	version string
+	// last is the sequence number of the E chunk, once it has been seen.
+	last  int
+	timer *time.Timer
+}
+
+// Assembler stitches real-time chunks into standard Level II volume files.
+// The S chunk carries the Archive II volume header, so concatenating S, I...
+// and E in sequence order yields the same file the archive bucket publishes.
+type Assembler struct {
+	config        *config.Assembler
+	client        s3.Getter
+	subscriptions Subscriptions
+	publish       chan<- events.Event
+	fetches       chan struct{}
+	estimator     Estimator
+
+	mu      sync.Mutex
+	volumes map[volumeKey]*volume
+	// finished holds when each recently finished volume may be forgotten.
+	finished map[volumeKey]time.Time
+
+	consumer *events.Consumer
+	// publishMu lets Stop wait out expiry timers that are mid-publish.
+	publishMu sync.RWMutex
+}
+
+// NewAssembler starts assembling volumes from chunks announced on
+// eventsChannel and publishes the results to publish.
+func NewAssembler(config *config.Assembler, client s3.Getter, subscriptions Subscriptions, eventsChannel <-chan events.Event, publish chan<- events.Event) *Assembler {
+	a := &Assembler{
+		config:        config,
+		client:        client,
+		subscriptions: subscriptions,
+		publish:       publish,
+		fetches:       make(chan struct{}, maxFetches),
+		volumes:       make(map[volumeKey]*volume),
+		finished:      make(map[volumeKey]time.Time),
+		consumer:      events.NewConsumer(),
+	}
+	a.consumer.Consume(eventsChannel, a.handle)
+	return a
+}
+
+// SetEstimator has every volume event carry estimator's prediction of the
+// station's next volume. It must be called before any chunks arrive.
+func (a *Assembler) SetEstimator(estimator Estimator) {
+	a.estimator = estimator
+}
+
+// Stop abandons every volume still being collected.
+func (a *Assembler) Stop() error {
+	a.consumer.Stop()
+	a.mu.Lock()
+	for key, vol := range a.volumes {
+		vol.timer.Stop()
+		delete(a.volumes, key)
+	}
+	a.mu.Unlock()
+	a.publishMu.Lock()
+	defer a.publishMu.Unlock()
+	return nil
+}
+
+func (a *Assembler) wanted(station string) bool {
+	if len(a.config.Stations) == 0 {
+		return a.subscriptions.Subscribed(station)
+	}
+	return slices.ContainsFunc(a.config.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+// handle hands each chunk to its own fetch goroutine so the bus never waits
+// on S3.
+func (a *Assembler) handle(event events.Event) {
+	chunk, ok := event.(events.NexradChunkEvent)
+	if !ok || !a.wanted(chunk.Station) {
+		return
+	}
+	key := volumeKey{station: strings.ToUpper(chunk.Station), number: chunk.VolumeNumber, start: chunk.VolumeStart}
+
+	a.mu.Lock()
+	if _, ok := a.finished[key]; ok {
+		a.mu.Unlock()
+		slog.Debug("Dropped chunk of finished volume", "path", chunk.Path)
+		return
+	}
+	vol, ok := a.volumes[key]
+	if !ok {
+		vol = &volume{chunks: make(map[int][]byte)}
+		vol.timer = time.AfterFunc(time.Duration(a.config.Timeout), func() { a.expire(key) })
+		a.volumes[key] = vol
+	}
+	vol.timer.Reset(time.Duration(a.config.Timeout))
+	if chunk.ChunkType == "E" {
+		vol.last = chunk.Sequence
+	}
+	if chunk.ChunkType == "S" || vol.version == "" {
+		vol.version = chunk.L2Version
+	}
+	a.mu.Unlock()
+
+	a.consumer.Go(func(ctx context.Context) {
+		a.fetch(ctx, key, chunk)
+	})
+}
+
+func (a *Assembler) fetch(ctx context.Context, key volumeKey, chunk events.NexradChunkEvent) {
+	var (
+		data []byte
+		err  error
+	)
+	select {
+	case a.fetches <- struct{}{}:
+		for attempt := 0; attempt < fetchAttempts && ctx.Err() == nil; attempt++ {
+			data, err = a.client.Get(ctx, chunk.Bucket, chunk.Path)
+			if err == nil {
+				break
+			}
+		}
+		<-a.fetches
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Failed to fetch chunk for assembly", "path", chunk.Path, "error", err)
+	}
+
+	a.mu.Lock()
+	vol, ok := a.volumes[key]
+	if !ok {
+		// Already finished or expired.
+		a.mu.Unlock()
+		return
+	}
+	if err == nil {
+		vol.chunks[chunk.Sequence] = data
+	}
+	complete := vol.last > 0 && len(vol.chunks) == vol.last
+	if complete {
+		vol.timer.Stop()
+		a.markFinished(key)
+	}
+	a.mu.Unlock()
+
+	if complete {
+		a.finish(key, vol)
+	}
+}
+
+// expire gives up on a volume that has stopped receiving chunks.
+func (a *Assembler) expire(key volumeKey) {
+	a.mu.Lock()
+	vol, ok := a.volumes[key]
+	if ok {
+		a.markFinished(key)
+	}
+	a.mu.Unlock()
+	if ok {
+		a.finish(key, vol)
+	}
+}
+
+// markFinished stops collecting key's chunks, and forgets volumes finished
+// long enough ago that their chunks have stopped coming. a.mu must be held.
+func (a *Assembler) markFinished(key volumeKey) {
+	delete(a.volumes, key)
+	now := time.Now()
+	for finished, forget := range a.finished {
+		if now.After(forget) {
+			delete(a.finished, finished)
+		}
+	}
+	a.finished[key] = now.Add(finishedRetention)
+}
+
+func (a *Assembler) finish(key volumeKey, vol *volume) {
+	a.publishMu.RLock()
+	defer a.publishMu.RUnlock()
+	if a.consumer.Stopped() || len(vol.chunks) == 0 {
+		return
+	}
+
+	last := vol.last
+	if last == 0 {
+		// The E chunk never came, so the best guess at the end is the
+		// highest sequence that did.
+		for sequence := range vol.chunks {
+			last = max(last, sequence)
+		}
+	}
+	var missing []int
+	var size int
+	for sequence := 1; sequence <= last; sequence++ {
+		data, ok := vol.chunks[sequence]
+		if !ok {
+			missing = append(missing, sequence)
+			continue
+		}
+		size += len(data)
+	}
+	partial := vol.last == 0 || len(missing) > 0
+	if partial {
+		// Stragglers of a volume completed before a restart, or before
+		// finishedRetention, are not a volume of their own.
+		if _, err := os.Stat(a.path(key, vol, false)); err == nil {
+			slog.Debug("Dropped partial volume already assembled", "station", key.station, "volume", key.number)
+			return
+		}
+	}
+
+	localPath, err := a.write(key, vol, last, size, partial)
+	if err != nil {
+		slog.Warn("Failed to write assembled volume", "station", key.station, "volume", key.number, "error", err)
+		return
+	}
+
+	slog.Info("Assembled volume", "station", key.station, "volume", key.number, "path", localPath, "partial", partial, "missing", missing)
+	event := events.NexradVolumeEvent{
+		Station:      key.station,
+		VolumeNumber: key.number,
+		VolumeStart:  key.start,
+		LocalPath:    localPath,
+		Size:         int64(size),
+		Chunks:       len(vol.chunks),
+		Partial:      partial,
+		Missing:      missing,
+	}
+	if a.estimator != nil {
+		if eta, ok := a.estimator.Estimate(key.station); ok {
+			event.NextVolume = &eta
+		}
+	}
+	a.publish <- event
+}
+
+// path names a volume's file the way the archive bucket names volumes, with
+// partialSuffix added to a partial one's name.
+func (a *Assembler) path(key volumeKey, vol *volume, partial bool) string {
+	name := fmt.Sprintf("%s%s", key.station, key.start.UTC().Format("20060102_150405"))
+	if vol.version != "" {
+		name += "_" + vol.version
+	}
+	if partial {
+		name += partialSuffix
+	}
+	return filepath.Join(a.config.Directory, key.station, name)
+}
+
+// write concatenates the chunks in sequence order into the volume's file.
+func (a *Assembler) write(key volumeKey, vol *volume, last, size int, partial bool) (string, error) {
+	localPath := a.path(key, vol, partial)
+	dir, name := filepath.Split(localPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 0, size)
+	for sequence := 1; sequence <= last; sequence++ {
+		data = append(data, vol.chunks[sequence]...)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// A no-op once the rename has succeeded.
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return localPath, os.Rename(tmp.Name(), localPath)
+}
@@ -0,0 +1,182 @@
+package assembler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/assembler"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+)
+
+const bucket = "unidata-nexrad-level2-chunks"
+
+type subscribed map[string]bool
+
+func (s subscribed) Subscribed(station string) bool {
+	return s[station]
+}
+
+func chunk(sequence int, chunkType string) events.NexradChunkEvent {
+	volumeStart := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+	name := volumeStart.Format("20060102-150405") + "-" + []string{"000", "001", "002", "003"}[sequence] + "-" + chunkType
+	return events.NexradChunkEvent{
+		Station:      "KTLX",
+		ChunkType:    chunkType,
+		L2Version:    "V06",
+		Path:         "KTLX/415/" + name,
+		VolumeStart:  volumeStart,
+		Sequence:     sequence,
+		VolumeNumber: 415,
+		Bucket:       bucket,
+	}
+}
+
+// newTestAssembler serves objects path-style from a local stand-in for S3.
+func newTestAssembler(t *testing.T, objects map[string][]byte, timeout time.Duration) (string, chan events.Event, chan events.Event) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := objects[strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	in := make(chan events.Event, 10)
+	out := make(chan events.Event, 10)
+	a := assembler.NewAssembler(&config.Assembler{
+		Directory: dir,
+		Timeout:   config.Duration(timeout),
+	}, s3.NewClient(server.URL), subscribed{"KTLX": true}, in, out)
+	t.Cleanup(func() {
+		close(in)
+		_ = a.Stop()
+	})
+	return dir, in, out
+}
+
+func waitFor(t *testing.T, out chan events.Event) events.NexradVolumeEvent {
+	t.Helper()
+	select {
+	case event := <-out:
+		volume, ok := event.(events.NexradVolumeEvent)
+		if !ok {
+			t.Fatalf("got %T, want NexradVolumeEvent", event)
+		}
+		return volume
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a volume")
+	}
+	return events.NexradVolumeEvent{}
+}
+
+func TestAssemble(t *testing.T) {
+	t.Parallel()
+	s, i, e := chunk(1, "S"), chunk(2, "I"), chunk(3, "E")
+	dir, in, out := newTestAssembler(t, map[string][]byte{
+		s.Path: []byte("AR2V0006.415"),
+		i.Path: []byte("-middle-"),
+		e.Path: []byte("-end"),
+	}, time.Minute)
+
+	// Chunks don't always arrive in order.
+	in <- e
+	in <- s
+	in <- i
+
+	got := waitFor(t, out)
+	if got.GetType() != events.EventTypeVolumeAssembled || got.Partial {
+		t.Errorf("got a %s event, want a complete volume", got.GetType())
+	}
+	wantPath := filepath.Join(dir, "KTLX", "KTLX20240418_033635_V06")
+	if got.LocalPath != wantPath {
+		t.Errorf("LocalPath = %q, want %q", got.LocalPath, wantPath)
+	}
+	data, err := os.ReadFile(got.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("AR2V0006.415-middle--end"); !bytes.Equal(data, want) {
+		t.Errorf("volume = %q, want %q", data, want)
+	}
+	if got.Size != int64(len(data)) || got.Chunks != 3 {
+		t.Errorf("Size = %d, Chunks = %d, want %d and 3", got.Size, got.Chunks, len(data))
+	}
+}
+
+func TestAssemblePartialAfterTimeout(t *testing.T) {
+	t.Parallel()
+	s, i, e := chunk(1, "S"), chunk(2, "I"), chunk(3, "E")
+	dir, in, out := newTestAssembler(t, map[string][]byte{
+		s.Path: []byte("AR2V0006.415"),
+		e.Path: []byte("-end"),
+	}, 100*time.Millisecond)
+
+	in <- s
+	in <- i
+	in <- e
+
+	got := waitFor(t, out)
+	if got.GetType() != events.EventTypeVolumePartial || !got.Partial {
+		t.Errorf("got a %s event, want a partial volume", got.GetType())
+	}
+	if !slices.Equal(got.Missing, []int{2}) {
+		t.Errorf("Missing = %v, want [2]", got.Missing)
+	}
+	if want := filepath.Join(dir, "KTLX", "KTLX20240418_033635_V06.partial"); got.LocalPath != want {
+		t.Errorf("LocalPath = %q, want %q", got.LocalPath, want)
+	}
+	data, err := os.ReadFile(got.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("AR2V0006.415-end"); !bytes.Equal(data, want) {
+		t.Errorf("volume = %q, want %q", data, want)
+	}
+}
+
+func TestAssembleDropsChunksOfFinishedVolume(t *testing.T) {
+	t.Parallel()
+	s, i, e := chunk(1, "S"), chunk(2, "I"), chunk(3, "E")
+	_, in, out := newTestAssembler(t, map[string][]byte{
+		s.Path: []byte("AR2V0006.415"),
+		i.Path: []byte("-middle-"),
+		e.Path: []byte("-end"),
+	}, 100*time.Millisecond)
+
+	in <- s
+	in <- i
+	in <- e
+	got := waitFor(t, out)
+	if got.Partial {
+		t.Fatal("got a partial volume, want a complete one")
+	}
+
+	// A duplicate delivery must not start the volume over and time out as a
+	// partial volume of its own.
+	in <- i
+	select {
+	case event := <-out:
+		t.Errorf("got %v for a chunk of a finished volume", event)
+	case <-time.After(500 * time.Millisecond):
+	}
+	data, err := os.ReadFile(got.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("AR2V0006.415-middle--end"); !bytes.Equal(data, want) {
+		t.Errorf("volume = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Subprotocol is the websocket subprotocol the server selects. A browser
+	// can't set headers on a websocket, so it sends its credential as a
+	// subprotocol instead, and must offer this one alongside it since the
+	// server has to pick one of those offered.
+	Subprotocol = "nexrad-aws-notifier"
+	// subprotocolPrefix marks the subprotocol carrying a credential.
+	subprotocolPrefix = "bearer."
+	// QueryParam is the query parameter a credential may be sent in.
+	QueryParam = "token"
+	// leeway allows for clock skew between us and the token's issuer.
+	leeway = 30 * time.Second
+)
+
+var (
+	ErrNoCredential      = errors.New("no credential")
+	ErrInvalidCredential = errors.New("invalid credential")
+	ErrUnknownKey        = errors.New("no key to verify token with")
+	ErrNoSubject         = errors.New("token has no subject")
+)
+
+// Principal is who a credential belongs to and what it may subscribe to.
+type Principal struct {
+	// Name is the API key's name or the token's subject, for logs.
+	Name string
+	// ID tells principals apart for limits. API keys and tokens have
+	// separate namespaces, so a token can't pass for the API key its subject
+	// happens to name.
+	ID string
+	// Stations and Types restrict what may be subscribed to. Empty allows
+	// everything.
+	Stations []string
+	Types    []events.EventType
+}
+
+// Allows reports whether p may subscribe to eventType events for station.
+func (p *Principal) Allows(eventType events.EventType, station string) bool {
+	if len(p.Types) > 0 && !slices.Contains(p.Types, eventType) {
+		return false
+	}
+	if len(p.Stations) > 0 && !slices.ContainsFunc(p.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	}) {
+		return false
+	}
+	return true
+}
+
+type apiKey struct {
+	// hash is compared rather than the key, so every comparison takes the
+	// same time whatever the key's length.
+	hash      [sha256.Size]byte
+	principal *Principal
+}
+
+// claims are the token claims we read.
+type claims struct {
+	jwt.RegisteredClaims
+	Stations []string `json:"stations"`
+	Types    []string `json:"types"`
+}
+
+// Authenticator checks credentials against the configured API keys and JWT
+// keys.
+type Authenticator struct {
+	apiKeys []apiKey
+	// jwtKeys are by key ID. A key file's single key has the empty ID.
+	jwtKeys map[string]any
+	parser  *jwt.Parser
+}
+
+// NewAuthenticator loads the keys cfg names.
+func NewAuthenticator(cfg *config.Auth) (*Authenticator, error) {
+	a := &Authenticator{}
+	for _, key := range cfg.APIKeys {
+		a.apiKeys = append(a.apiKeys, apiKey{
+			hash:      sha256.Sum256([]byte(key.Key)),
+			principal: newPrincipal("apikey:"+key.Name, key.Name, key.Stations, key.Types),
+		})
+	}
+
+	switch {
+	case cfg.JWT.KeyFile != "":
+		key, err := loadKeyFile(cfg.JWT.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT key: %w", err)
+		}
+		a.jwtKeys = map[string]any{"": key}
+	case cfg.JWT.JWKSFile != "":
+		keys, err := loadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWKS: %w", err)
+		}
+		a.jwtKeys = keys
+	}
+	if a.jwtKeys != nil {
+		opts := []jwt.ParserOption{
+			jwt.WithValidMethods([]string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512"}),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(leeway),
+		}
+		if cfg.JWT.Issuer != "" {
+			opts = append(opts, jwt.WithIssuer(cfg.JWT.Issuer))
+		}
+		if cfg.JWT.Audience != "" {
+			opts = append(opts, jwt.WithAudience(cfg.JWT.Audience))
+		}
+		a.parser = jwt.NewParser(opts...)
+	}
+	return a, nil
+}
+
+func newPrincipal(id, name string, stations, types []string) *Principal {
+	principal := &Principal{ID: id, Name: name, Stations: stations}
+	for _, t := range types {
+		principal.Types = append(principal.Types, events.EventType(t))
+	}
+	return principal
+}
+
+// Credential finds the credential r carries, trying in turn a bearer token,
+// an X-API-Key header, the token query parameter and a bearer. subprotocol.
+func Credential(r *http.Request) string {
+	if scheme, credential, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credential)
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := r.URL.Query().Get(QueryParam); token != "" {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if credential, ok := strings.CutPrefix(protocol, subprotocolPrefix); ok {
+			return credential
+		}
+	}
+	return ""
+}
+
+// Authenticate returns who credential belongs to. It may be an API key or,
+// when JWT keys are configured, a token.
+func (a *Authenticator) Authenticate(credential string) (*Principal, error) {
+	if credential == "" {
+		return nil, ErrNoCredential
+	}
+	hash := sha256.Sum256([]byte(credential))
+	var found *Principal
+	// Every key is compared, so the time taken gives away nothing about
+	// which one came close.
+	for _, key := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			found = key.principal
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if a.parser == nil {
+		return nil, ErrInvalidCredential
+	}
+
+	var c claims
+	if _, err := a.parser.ParseWithClaims(credential, &c, a.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	// Without a subject, tokens can't be told apart to be limited.
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, ErrNoSubject)
+	}
+	return newPrincipal("jwt:"+c.Issuer+"/"+c.Subject, c.Subject, c.Stations, c.Types), nil
+}
+
+// key picks the key to verify token with. A key only verifies the family of
+// algorithms it is for, so an RSA public key can't be passed off as an HMAC
+// secret.
+func (a *Authenticator) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := a.jwtKeys[kid]
+	if !ok && len(a.jwtKeys) == 1 {
+		// With a single key, such as a key file's, there is no need for the
+		// token to name it.
+		for _, only := range a.jwtKeys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if secret, ok := key.([]byte); ok {
+			return secret, nil
+		}
+	case *jwt.SigningMethodRSA:
+		if public, ok := key.(*rsa.PublicKey); ok {
+			return public, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: key %q can't verify %s", ErrUnknownKey, kid, token.Method.Alg())
+}
+
+// loadKeyFile reads a PEM RSA public key or certificate, or failing that, an
+// HMAC secret.
+func loadKeyFile(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("%s is empty", path)
+		}
+		return secret, nil
+	}
+
+	var public any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not hold an RSA public key", path)
+	}
+	return rsaKey, nil
+}
+
+// jwk is the part of a JSON Web Key we use.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// N and E are an RSA key's modulus and exponent.
+	N string `json:"n"`
+	E string `json:"e"`
+	// K is an HMAC key's secret.
+	K string `json:"k"`
+}
+
+// loadJWKS reads the RSA and HMAC keys from a JSON Web Key Set. Keys of
+// other types are skipped.
+func loadJWKS(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, key := range set.Keys {
+		if _, ok := keys[key.Kid]; ok {
+			return nil, fmt.Errorf("key %q appears more than once", key.Kid)
+		}
+		switch key.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has an invalid modulus: %w", key.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has an invalid exponent: %w", key.Kid, err)
+			}
+			exponent := new(big.Int).SetBytes(e)
+			if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("key %q is not a valid RSA key", key.Kid)
+			}
+			keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("key %q has an invalid secret", key.Kid)
+			}
+			keys[key.Kid] = secret
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s holds no RSA or HMAC keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const secret = "correct horse battery staple"
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, c jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func valid(c jwt.MapClaims) jwt.MapClaims {
+	c["exp"] = time.Now().Add(time.Hour).Unix()
+	return c
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+	a, err := NewAuthenticator(&config.Auth{APIKeys: []config.APIKey{
+		{Name: "everything", Key: "k-everything"},
+		{Name: "ktlx-chunks", Key: "k-ktlx", Stations: []string{"KTLX"}, Types: []string{"nexrad-chunk"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := a.Authenticate("k-ktlx")
+	if err != nil || principal.Name != "ktlx-chunks" || principal.ID != "apikey:ktlx-chunks" {
+		t.Fatalf("Authenticate() = %+v, %v, want ktlx-chunks", principal, err)
+	}
+	if !principal.Allows(events.EventTypeNexradChunk, "ktlx") {
+		t.Error("restricted key denied its own station and type")
+	}
+	if principal.Allows(events.EventTypeNexradChunk, "KFDR") || principal.Allows(events.EventTypeNexradArchive, "KTLX") {
+		t.Error("restricted key allowed beyond its station and type")
+	}
+
+	principal, err = a.Authenticate("k-everything")
+	if err != nil || !principal.Allows(events.EventTypeNexradArchive, "KFDR") {
+		t.Errorf("unrestricted key = %+v, %v, want everything allowed", principal, err)
+	}
+
+	if _, err := a.Authenticate("k-wrong"); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("unknown key error = %v, want ErrInvalidCredential", err)
+	}
+	if _, err := a.Authenticate(""); !errors.Is(err, ErrNoCredential) {
+		t.Errorf("missing key error = %v, want ErrNoCredential", err)
+	}
+}
+
+func TestHMACKeyFile(t *testing.T) {
+	t.Parallel()
+	a, err := NewAuthenticator(&config.Auth{JWT: config.JWT{
+		KeyFile:  writeFile(t, "secret", []byte(secret+"\n")),
+		Issuer:   "https://auth.example.com",
+		Audience: "nexrad",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{
+		"sub": "alice", "iss": "https://auth.example.com", "aud": "nexrad",
+		"stations": []string{"KTLX"}, "types": []string{"station-status"},
+	}))
+	principal, err := a.Authenticate(token)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if principal.Name != "alice" || principal.ID != "jwt:https://auth.example.com/alice" || !principal.Allows(events.EventTypeStationStatus, "KTLX") || principal.Allows(events.EventTypeNexradChunk, "KTLX") {
+		t.Errorf("principal = %+v, want alice limited by her claims", principal)
+	}
+
+	rejected := map[string]string{
+		"wrong secret": sign(t, jwt.SigningMethodHS256, []byte("guess"), "", valid(jwt.MapClaims{"iss": "https://auth.example.com", "aud": "nexrad"})),
+		"expired":      sign(t, jwt.SigningMethodHS256, []byte(secret), "", jwt.MapClaims{"iss": "https://auth.example.com", "aud": "nexrad", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":    sign(t, jwt.SigningMethodHS256, []byte(secret), "", jwt.MapClaims{"iss": "https://auth.example.com", "aud": "nexrad"}),
+		"issuer":       sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"iss": "https://evil.example.com", "aud": "nexrad"})),
+		"audience":     sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"iss": "https://auth.example.com", "aud": "other"})),
+		"no subject":   sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"iss": "https://auth.example.com", "aud": "nexrad"})),
+		"none":         sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid(jwt.MapClaims{"iss": "https://auth.example.com", "aud": "nexrad"})),
+	}
+	for name, token := range rejected {
+		if _, err := a.Authenticate(token); !errors.Is(err, ErrInvalidCredential) {
+			t.Errorf("%s: error = %v, want ErrInvalidCredential", name, err)
+		}
+	}
+
+	// Every token without a subject would share one quota.
+	if _, err := a.Authenticate(rejected["no subject"]); !errors.Is(err, ErrNoSubject) {
+		t.Errorf("token without a subject error = %v, want ErrNoSubject", err)
+	}
+}
+
+func TestRSAKeyFile(t *testing.T) {
+	t.Parallel()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	a, err := NewAuthenticator(&config.Auth{JWT: config.JWT{KeyFile: writeFile(t, "public.pem", publicPEM)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodRS256, private, "", valid(jwt.MapClaims{"sub": "bob"}))); err != nil {
+		t.Errorf("RS256 token error = %v", err)
+	}
+	// The public key is no secret, so it must not verify an HMAC token.
+	forged := sign(t, jwt.SigningMethodHS256, publicPEM, "", valid(jwt.MapClaims{"sub": "mallory"}))
+	if _, err := a.Authenticate(forged); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("HS256 token signed with the public key error = %v, want ErrInvalidCredential", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa-1",
+			"n": base64.RawURLEncoding.EncodeToString(private.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes()),
+		},
+		{"kty": "oct", "kid": "hmac-1", "k": base64.RawURLEncoding.EncodeToString([]byte(secret))},
+		{"kty": "EC", "kid": "ec-1"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAuthenticator(&config.Auth{JWT: config.JWT{JWKSFile: writeFile(t, "jwks.json", set)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodRS512, private, "rsa-1", valid(jwt.MapClaims{"sub": "carol"}))); err != nil {
+		t.Errorf("RS512 token error = %v", err)
+	}
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodHS384, []byte(secret), "hmac-1", valid(jwt.MapClaims{"sub": "carol"}))); err != nil {
+		t.Errorf("HS384 token error = %v", err)
+	}
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodHS256, []byte(secret), "rsa-1", valid(jwt.MapClaims{"sub": "carol"}))); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("HS256 token naming the RSA key error = %v, want ErrInvalidCredential", err)
+	}
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"sub": "carol"}))); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("token naming no key error = %v, want ErrInvalidCredential", err)
+	}
+}
+
+func TestCredential(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		header map[string]string
+		target string
+	}{
+		{"bearer", map[string]string{"Authorization": "Bearer abc"}, "/ws/events/nexrad-chunk/KTLX"},
+		{"api key header", map[string]string{"X-API-Key": "abc"}, "/ws/events/nexrad-chunk/KTLX"},
+		{"query", nil, "/ws/events/nexrad-chunk/KTLX?token=abc"},
+		{"subprotocol", map[string]string{"Sec-WebSocket-Protocol": "nexrad-aws-notifier, bearer.abc"}, "/ws/events/nexrad-chunk/KTLX"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		for name, value := range tt.header {
+			r.Header.Set(name, value)
+		}
+		if got := Credential(r); got != "abc" {
+			t.Errorf("%s: Credential() = %q, want abc", tt.name, got)
+		}
+	}
+	if got := Credential(httptest.NewRequest("GET", "/ws/events/nexrad-chunk/KTLX", nil)); got != "" {
+		t.Errorf("Credential() = %q, want none", got)
+	}
+}
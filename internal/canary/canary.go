@@ -0,0 +1,140 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/health"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/google/uuid"
+)
+
+var ErrTimeout = errors.New("canary did not arrive")
+
+// Sender puts a canary tagged with id into the ingest path.
+type Sender interface {
+	SendCanary(ctx context.Context, id string) error
+}
+
+// Canary sends a synthetic notification at an interval and waits for the
+// websocket hub to see it, proving notifications get from the queue to
+// clients rather than only that the queue can be read. One canary is in
+// flight at a time.
+type Canary struct {
+	config *config.Canary
+	sender Sender
+	health *health.Tracker
+
+	mu sync.Mutex
+	// pending is the ID of the canary in flight, and arrived is closed when
+	// it is delivered.
+	pending string
+	arrived chan struct{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewCanary starts sending canaries through sender, recording how they fare
+// with tracker. The first is sent one interval from now, once the listener
+// has had time to start.
+func NewCanary(cfg *config.Canary, sender Sender, tracker *health.Tracker) *Canary {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Canary{
+		config: cfg,
+		sender: sender,
+		health: tracker,
+		cancel: cancel,
+	}
+	c.wg.Add(1)
+	go c.run(ctx)
+	return c
+}
+
+func (c *Canary) run(ctx context.Context) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(time.Duration(c.config.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.probe(ctx)
+		}
+	}
+}
+
+// probe sends one canary and waits for it to arrive.
+func (c *Canary) probe(ctx context.Context) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		c.failed(err)
+		return
+	}
+	arrived := make(chan struct{})
+	c.mu.Lock()
+	c.pending = id.String()
+	c.arrived = arrived
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.pending = ""
+		c.mu.Unlock()
+	}()
+
+	start := time.Now()
+	if err := c.sender.SendCanary(ctx, id.String()); err != nil {
+		if ctx.Err() == nil {
+			c.failed(err)
+		}
+		return
+	}
+
+	timeout := time.NewTimer(time.Duration(c.config.Timeout))
+	defer timeout.Stop()
+	select {
+	case <-ctx.Done():
+		// Shutting down; a canary lost to that says nothing.
+	case <-timeout.C:
+		c.failed(fmt.Errorf("%w within %s", ErrTimeout, time.Duration(c.config.Timeout)))
+	case <-arrived:
+		latency := time.Since(start)
+		metrics.CanaryRuns.WithLabelValues(metrics.ResultOK).Inc()
+		metrics.CanaryLatency.Observe(latency.Seconds())
+		metrics.CanaryLastSuccess.SetToCurrentTime()
+		c.health.CanarySucceeded(latency)
+		slog.Debug("Canary arrived", "id", id.String(), "latency", latency)
+	}
+}
+
+func (c *Canary) failed(err error) {
+	metrics.CanaryRuns.WithLabelValues(metrics.ResultError).Inc()
+	c.health.CanaryFailed(err)
+	slog.Warn("Canary failed", "error", err)
+}
+
+// Delivered is called by the websocket hub with each canary it receives.
+// Ones that arrive after their probe gave up on them are ignored.
+func (c *Canary) Delivered(event events.CanaryEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if event.ID == "" || event.ID != c.pending {
+		slog.Debug("Ignoring late canary", "id", event.ID)
+		return
+	}
+	close(c.arrived)
+	c.pending = ""
+}
+
+func (c *Canary) Stop() error {
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,88 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/health"
+)
+
+// sender delivers each canary straight to the hub end, unless it is set to
+// lose them or fail to send them.
+type sender struct {
+	canary *Canary
+	lose   bool
+	err    error
+}
+
+func (s *sender) SendCanary(_ context.Context, id string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if !s.lose {
+		go s.canary.Delivered(events.CanaryEvent{ID: id})
+	}
+	return nil
+}
+
+func newTestCanary(s *sender) *Canary {
+	cfg := &config.Health{
+		StaleAfter:     config.Duration(time.Minute),
+		ErrorThreshold: 2,
+		RestartAfter:   config.Duration(time.Hour),
+	}
+	c := &Canary{
+		config: &config.Canary{Interval: config.Duration(time.Hour), Timeout: config.Duration(50 * time.Millisecond)},
+		sender: s,
+		health: health.NewTracker(cfg, config.IngestModeHTTP, nil, "chunk"),
+	}
+	c.health.SetSubscribed("chunk", true)
+	s.canary = c
+	return c
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+	s := &sender{}
+	c := newTestCanary(s)
+
+	c.probe(context.Background())
+	report := c.health.Report()
+	if report.Canary == nil || report.Canary.LastSuccess == nil || report.Canary.ConsecutiveFailures != 0 {
+		t.Fatalf("canary = %+v, want a success", report.Canary)
+	}
+
+	s.lose = true
+	c.probe(context.Background())
+	report = c.health.Report()
+	if report.Canary.ConsecutiveFailures != 1 || report.State != health.StateDegraded {
+		t.Errorf("report = %+v, want one failure leaving the listener degraded", report)
+	}
+
+	s.lose = false
+	s.err = errors.New("access denied")
+	c.probe(context.Background())
+	report = c.health.Report()
+	if report.Canary.LastError != "access denied" || report.State != health.StateDown {
+		t.Errorf("report = %+v, want the send failure to take the listener down", report)
+	}
+}
+
+// A canary that turns up after its probe gave up must not count for the
+// next one.
+func TestLateCanaryIgnored(t *testing.T) {
+	t.Parallel()
+	s := &sender{lose: true}
+	c := newTestCanary(s)
+	c.probe(context.Background())
+
+	c.Delivered(events.CanaryEvent{ID: "late"})
+	c.Delivered(events.CanaryEvent{})
+	if report := c.health.Report(); report.Canary.ConsecutiveFailures != 1 {
+		t.Errorf("canary = %+v, want the timeout to stand", report.Canary)
+	}
+}
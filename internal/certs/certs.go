@@ -0,0 +1,182 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+)
+
+// checkInterval is how often the files are checked for changes.
+const checkInterval = 10 * time.Second
+
+var ErrNoClientCAs = errors.New("no CA certificates found")
+
+// Reloader serves a listener's certificate, and its client CAs for mutual
+// TLS, reloading them when their files change or on SIGHUP. Connections
+// already open carry on with what they were set up with, so nothing is
+// dropped by a reload.
+type Reloader struct {
+	config *config.TLS
+	// listener names the listener in logs and metrics.
+	listener string
+
+	// current is the config handed to each new connection.
+	current atomic.Pointer[tls.Config]
+	// stamp is the size and modification time of each file as last loaded.
+	stamp string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReloader loads the files cfg names, failing if they can't be loaded, and
+// starts watching them.
+func NewReloader(cfg *config.TLS, listener string) (*Reloader, error) {
+	r := &Reloader{
+		config:   cfg,
+		listener: listener,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go r.run(ctx)
+	return r, nil
+}
+
+// TLSConfig is the config to serve with. It hands each connection whatever
+// was last loaded.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.current.Load().MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+		// Never used, but tells http.Server.ServeTLS there is a certificate
+		// without it going looking for files.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current.Load().Certificates[0], nil
+		},
+	}
+}
+
+func (r *Reloader) run(ctx context.Context) {
+	defer r.wg.Done()
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			r.reload()
+		case <-ticker.C:
+			if stamp, err := r.stampFiles(); err == nil && stamp != r.stamp {
+				r.reload()
+			}
+		}
+	}
+}
+
+// reload loads the files again, keeping what was loaded before if they are
+// no good, as a half-written renewal shouldn't take the listener down.
+func (r *Reloader) reload() {
+	if err := r.load(); err != nil {
+		slog.Error("Failed to reload TLS certificate, keeping the current one", "listener", r.listener, "error", err)
+		return
+	}
+	slog.Info("Reloaded TLS certificate", "listener", r.listener, "expires", r.current.Load().Certificates[0].Leaf.NotAfter)
+}
+
+func (r *Reloader) load() error {
+	// Stamped first, so a file changed while it is read is read again.
+	stamp, err := r.stampFiles()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	// Before Go 1.23 the parsed leaf isn't kept.
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+	}
+
+	next := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion(r.config.MinVersion),
+		// ServeTLS only adds h2 to the config it is given, not to those
+		// handed out per connection.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w in %s", ErrNoClientCAs, r.config.ClientCAFile)
+		}
+		next.ClientCAs = pool
+		next.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(next)
+	r.stamp = stamp
+	metrics.TLSCertificateExpiry.WithLabelValues(r.listener).Set(float64(cert.Leaf.NotAfter.Unix()))
+	return nil
+}
+
+// stampFiles sums up the size and modification time of each file, which
+// change whenever the file is replaced, including by swapping a symlink as
+// Kubernetes does with mounted secrets.
+func (r *Reloader) stampFiles() (string, error) {
+	var stamp string
+	for _, path := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d:%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+func minVersion(version config.TLSVersion) uint16 {
+	if version == config.TLSVersion13 {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+func (r *Reloader) Stop() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
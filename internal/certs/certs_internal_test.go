@@ -0,0 +1,188 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+)
+
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// issue makes a certificate for localhost with serial, signed by parent, or
+// self-signed as a CA without one.
+func issue(t *testing.T, serial int64, parent *issued) *issued {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Duration(serial) * 24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &issued{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (i *issued) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func served(r *Reloader) int64 {
+	return r.current.Load().Certificates[0].Leaf.SerialNumber.Int64()
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := &config.TLS{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key"), MinVersion: config.TLSVersion13}
+	first := issue(t, 1, nil)
+	write(t, cfg.CertFile, first.pem)
+	write(t, cfg.KeyFile, first.keyPEM(t))
+
+	r, err := NewReloader(cfg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Stop() })
+	if served(r) != 1 || r.TLSConfig().MinVersion != tls.VersionTLS13 {
+		t.Fatalf("serving %d at TLS %x, want certificate 1 at TLS 1.3", served(r), r.TLSConfig().MinVersion)
+	}
+
+	second := issue(t, 2, nil)
+	write(t, cfg.CertFile, second.pem)
+	write(t, cfg.KeyFile, second.keyPEM(t))
+	if stamp, err := r.stampFiles(); err != nil || stamp == r.stamp {
+		t.Errorf("stampFiles() = %q, %v, want a change from %q", stamp, err, r.stamp)
+	}
+	r.reload()
+	if served(r) != 2 {
+		t.Errorf("serving certificate %d, want 2 after reloading", served(r))
+	}
+
+	// A certificate that doesn't match its key is kept out.
+	write(t, cfg.CertFile, issue(t, 3, nil).pem)
+	r.reload()
+	if served(r) != 2 {
+		t.Errorf("serving certificate %d, want 2 kept after a bad reload", served(r))
+	}
+}
+
+func TestNewReloaderFails(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := &config.TLS{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key"), ClientCAFile: filepath.Join(dir, "ca.crt")}
+	cert := issue(t, 1, nil)
+	write(t, cfg.CertFile, cert.pem)
+	write(t, cfg.KeyFile, cert.keyPEM(t))
+	write(t, cfg.ClientCAFile, []byte("not a certificate"))
+	if _, err := NewReloader(cfg, "test"); err == nil {
+		t.Error("NewReloader() succeeded with no client CAs")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca := issue(t, 1, nil)
+	server := issue(t, 2, ca)
+	client := issue(t, 3, ca)
+	cfg := &config.TLS{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	write(t, cfg.CertFile, server.pem)
+	write(t, cfg.KeyFile, server.keyPEM(t))
+	write(t, cfg.ClientCAFile, ca.pem)
+
+	r, err := NewReloader(cfg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Stop() })
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		TLSConfig:         r.TLSConfig(),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() { _ = srv.ServeTLS(listener, "", "") }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs []tls.Certificate) error {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+			MinVersion:   tls.VersionTLS12,
+		}}}
+		resp, err := c.Get("https://" + listener.Addr().String())
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(nil); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+	clientCert := tls.Certificate{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}
+	if err := get([]tls.Certificate{clientCert}); err != nil {
+		t.Errorf("request with a client certificate error = %v", err)
+	}
+}
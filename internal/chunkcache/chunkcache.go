@@ -0,0 +1,328 @@
+package chunkcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/md5" //nolint:gosec // Only used to derive ETags, the way S3 does.
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// queueSize bounds chunks waiting to be prefetched. Beyond it new chunks
+	// are skipped rather than stalling the event bus.
+	queueSize = 256
+	// prefetchers is how many chunks are prefetched at once.
+	prefetchers = 4
+	megabyte    = 1 << 20
+)
+
+// ErrEvicted is returned when a chunk is evicted between being fetched and
+// being opened, which only happens when the cache is smaller than a few
+// chunks.
+var ErrEvicted = errors.New("chunk evicted before it could be served")
+
+// Subscriptions reports which stations currently have clients.
+type Subscriptions interface {
+	Subscribed(station string) bool
+}
+
+// Entry describes a cached chunk.
+type Entry struct {
+	Key     string
+	Size    int64
+	ETag    string
+	ModTime time.Time
+}
+
+// Cache fetches chunks from the chunk bucket on demand and keeps them on
+// disk, laid out by key, removing the least recently used beyond its size.
+type Cache struct {
+	config        *config.ChunkCache
+	client        *s3.Client
+	subscriptions Subscriptions
+	maxSize       int64
+	jobs          chan string
+	fetches       singleflight.Group
+
+	mu sync.Mutex
+	// lru holds *Entry, most recently used first.
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+
+	// consumer's context outlives any one request, so a fetch shared by
+	// several isn't cancelled by the first to give up on it.
+	consumer *events.Consumer
+}
+
+// NewCache picks up the chunks already in the configured directory and,
+// when prefetching, starts caching the chunks announced on eventsChannel.
+func NewCache(config *config.ChunkCache, client *s3.Client, subscriptions Subscriptions, eventsChannel <-chan events.Event) *Cache {
+	c := &Cache{
+		config:        config,
+		client:        client,
+		subscriptions: subscriptions,
+		maxSize:       int64(config.MaxSize) * megabyte,
+		jobs:          make(chan string, queueSize),
+		lru:           list.New(),
+		entries:       make(map[string]*list.Element),
+		consumer:      events.NewConsumer(),
+	}
+	if err := c.load(); err != nil {
+		slog.Warn("Failed to load chunk cache", "directory", config.Directory, "error", err)
+	}
+	for range prefetchers {
+		c.consumer.Go(c.prefetcher)
+	}
+	c.consumer.Consume(eventsChannel, c.handle)
+	return c
+}
+
+// Stop cancels in-flight fetches and waits for the prefetchers to exit.
+func (c *Cache) Stop() error {
+	c.consumer.Stop()
+	return nil
+}
+
+// Open returns the cached chunk named key, fetching it first on a miss. The
+// caller closes the file; it stays readable even if the chunk is evicted.
+func (c *Cache) Open(ctx context.Context, key string) (*os.File, Entry, error) {
+	if _, err := nexrad.ParseChunkKey(key); err != nil {
+		return nil, Entry{}, err
+	}
+	if file, entry, ok := c.open(key); ok {
+		return file, entry, nil
+	}
+	// Concurrent misses share one fetch, which outlives any one request.
+	result := c.fetches.DoChan(key, func() (any, error) {
+		return nil, c.fetch(key)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, Entry{}, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, Entry{}, res.Err
+		}
+	}
+	if file, entry, ok := c.open(key); ok {
+		return file, entry, nil
+	}
+	return nil, Entry{}, ErrEvicted
+}
+
+// Get reads an object, through the cache when it is a chunk, so everything
+// reading chunks shares one fetch of each.
+func (c *Cache) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	if bucket != nexrad.ChunkBucket {
+		return c.client.Get(ctx, bucket, key)
+	}
+	file, _, err := c.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// open opens a cached chunk and marks it used. Eviction takes the same lock,
+// so the file can't be removed between the lookup and the open.
+func (c *Cache) open(key string) (*os.File, Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, Entry{}, false
+	}
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		slog.Warn("Cached chunk unreadable, fetching again", "key", key, "error", err)
+		c.remove(element)
+		return nil, Entry{}, false
+	}
+	c.lru.MoveToFront(element)
+	entry, _ := element.Value.(*Entry)
+	return file, *entry, true
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.config.Directory, filepath.FromSlash(key))
+}
+
+// fetch writes the chunk to a temporary file beside its place in the cache
+// and renames it into place once it is complete.
+func (c *Cache) fetch(key string) error {
+	resp, err := c.client.Do(c.consumer.Context(), nexrad.ChunkBucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	localPath := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// A no-op once the rename has succeeded.
+		_ = os.Remove(tmp.Name())
+	}()
+	hash := md5.New() //nolint:gosec // See import.
+	size, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	modTime := time.Now()
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		modTime = lastModified
+	}
+	// The modification time is the object's, so it survives a restart.
+	if err := os.Chtimes(tmp.Name(), time.Time{}, modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return err
+	}
+	c.add(&Entry{Key: key, Size: size, ETag: etag(hash.Sum(nil)), ModTime: modTime})
+	slog.Debug("Cached chunk", "key", key, "size", size)
+	return nil
+}
+
+// add records a chunk now on disk as the most recently used, then evicts
+// the least recently used until the cache fits.
+func (c *Cache) add(entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[entry.Key]; ok {
+		old, _ := element.Value.(*Entry)
+		c.size -= old.Size
+		element.Value = entry
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[entry.Key] = c.lru.PushFront(entry)
+	}
+	c.size += entry.Size
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		evicted := c.remove(c.lru.Back())
+		if err := os.Remove(c.path(evicted.Key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to remove cached chunk", "key", evicted.Key, "error", err)
+		}
+	}
+}
+
+func (c *Cache) remove(element *list.Element) *Entry {
+	entry, _ := element.Value.(*Entry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.Key)
+	c.size -= entry.Size
+	return entry
+}
+
+// load indexes the chunks left in the cache by an earlier run, treating the
+// most recently modified as the most recently used.
+func (c *Cache) load() error {
+	var loaded []*Entry
+	err := filepath.WalkDir(c.config.Directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(c.config.Directory, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if _, err := nexrad.ParseChunkKey(key); err != nil {
+			// Temporary files of interrupted fetches, or strangers.
+			if strings.HasPrefix(d.Name(), ".") {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(data) //nolint:gosec // See import.
+		loaded = append(loaded, &Entry{Key: key, Size: int64(len(data)), ETag: etag(sum[:]), ModTime: info.ModTime()})
+		return nil
+	})
+	// Oldest first, so the newest ends up at the front.
+	slices.SortFunc(loaded, func(a, b *Entry) int { return a.ModTime.Compare(b.ModTime) })
+	for _, entry := range loaded {
+		c.add(entry)
+	}
+	return err
+}
+
+// handle queues the chunks of subscribed stations for prefetching.
+func (c *Cache) handle(event events.Event) {
+	chunk, ok := event.(events.NexradChunkEvent)
+	if !ok || !c.config.Prefetch || chunk.Bucket != nexrad.ChunkBucket || !c.subscriptions.Subscribed(chunk.Station) {
+		return
+	}
+	select {
+	case c.jobs <- chunk.Path:
+	default:
+		slog.Warn("Chunk prefetch queue full, skipping chunk", "key", chunk.Path)
+	}
+}
+
+func (c *Cache) prefetcher(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case key := <-c.jobs:
+			c.mu.Lock()
+			_, cached := c.entries[key]
+			c.mu.Unlock()
+			if cached {
+				continue
+			}
+			_, err, _ := c.fetches.Do(key, func() (any, error) {
+				return nil, c.fetch(key)
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to prefetch chunk", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+func etag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum) + `"`
+}
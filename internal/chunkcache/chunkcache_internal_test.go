@@ -0,0 +1,195 @@
+package chunkcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/md5" //nolint:gosec // See chunkcache.go.
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+)
+
+const (
+	first  = "KTLX/415/20240418-033635-001-S"
+	second = "KTLX/415/20240418-033635-002-I"
+	third  = "KTLX/415/20240418-033635-003-I"
+)
+
+// standIn is a minimal path-style S3 endpoint serving the chunk bucket.
+type standIn struct {
+	objects  map[string]string
+	requests atomic.Int32
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	data, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/"+nexrad.ChunkBucket+"/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Last-Modified", "Thu, 18 Apr 2024 03:36:41 GMT")
+	_, _ = io.WriteString(w, data)
+}
+
+type subscribed map[string]bool
+
+func (s subscribed) Subscribed(station string) bool {
+	return s[station]
+}
+
+func newTestCache(t *testing.T, stand *standIn, maxSize int64) *Cache {
+	t.Helper()
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+	consumer := events.NewConsumer()
+	t.Cleanup(consumer.Stop)
+	return &Cache{
+		config:   &config.ChunkCache{Directory: t.TempDir()},
+		client:   s3.NewClient(server.URL),
+		maxSize:  maxSize,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		consumer: consumer,
+	}
+}
+
+func read(t *testing.T, c *Cache, key string) (string, Entry) {
+	t.Helper()
+	file, entry, err := c.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open(%q) = %v", key, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), entry
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	stand := &standIn{objects: map[string]string{first: "chunk one"}}
+	c := newTestCache(t, stand, 1024)
+
+	data, entry := read(t, c, first)
+	if data != "chunk one" || entry.Size != 9 {
+		t.Errorf("got %q, %+v", data, entry)
+	}
+	if sum := md5.Sum([]byte(data)); entry.ETag != `"`+hex.EncodeToString(sum[:])+`"` { //nolint:gosec // See chunkcache.go.
+		t.Errorf("ETag = %q, want the MD5 of the chunk", entry.ETag)
+	}
+	if !entry.ModTime.Equal(time.Date(2024, 4, 18, 3, 36, 41, 0, time.UTC)) {
+		t.Errorf("ModTime = %v, want the object's Last-Modified", entry.ModTime)
+	}
+
+	// A hit is served from disk.
+	if again, _ := read(t, c, first); again != data || stand.requests.Load() != 1 {
+		t.Errorf("got %q after %d requests, want the cached chunk after 1", again, stand.requests.Load())
+	}
+
+	if _, _, err := c.Open(context.Background(), second); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("Open(missing) = %v, want ErrNotFound", err)
+	}
+	if _, _, err := c.Open(context.Background(), "../../etc/passwd"); !errors.Is(err, nexrad.ErrInvalidKey) {
+		t.Errorf("Open(outside) = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+	stand := &standIn{objects: map[string]string{first: "chunk one"}}
+	c := newTestCache(t, stand, 1024)
+
+	// The decoder and assembler both read each chunk; S3 only sees it once.
+	for range 2 {
+		data, err := c.Get(context.Background(), nexrad.ChunkBucket, first)
+		if err != nil || string(data) != "chunk one" {
+			t.Fatalf("Get() = %q, %v, want the chunk", data, err)
+		}
+	}
+	if n := stand.requests.Load(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+
+	// Other buckets are passed through uncached.
+	if _, err := c.Get(context.Background(), nexrad.ArchiveBucket, first); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("Get(archive) = %v, want ErrNotFound from the stand-in", err)
+	}
+	if n := stand.requests.Load(); n != 2 {
+		t.Errorf("made %d requests, want the archive request passed through", n)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	t.Parallel()
+	stand := &standIn{objects: map[string]string{first: "0123456789", second: "0123456789", third: "0123456789"}}
+	// Room for two chunks.
+	c := newTestCache(t, stand, 25)
+
+	read(t, c, first)
+	read(t, c, second)
+	// Using the first makes the second the least recently used.
+	read(t, c, first)
+	read(t, c, third)
+
+	if _, ok := c.entries[second]; ok {
+		t.Error("least recently used chunk was kept")
+	}
+	if _, ok := c.entries[first]; !ok {
+		t.Error("recently used chunk was evicted")
+	}
+	if c.size != 20 {
+		t.Errorf("size = %d, want 20", c.size)
+	}
+
+	// A restart picks up what is left, without fetching it again.
+	restarted := newTestCache(t, stand, 25)
+	restarted.config = c.config
+	if err := restarted.load(); err != nil {
+		t.Fatal(err)
+	}
+	requests := stand.requests.Load()
+	read(t, restarted, first)
+	read(t, restarted, third)
+	if stand.requests.Load() != requests {
+		t.Error("chunks from the last run were fetched again")
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+	stand := &standIn{objects: map[string]string{first: "chunk one"}}
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+
+	in := make(chan events.Event, 2)
+	c := NewCache(&config.ChunkCache{Directory: t.TempDir(), MaxSize: 1, Prefetch: true}, s3.NewClient(server.URL), subscribed{"KTLX": true}, in)
+	t.Cleanup(func() {
+		close(in)
+		_ = c.Stop()
+	})
+	in <- events.NexradChunkEvent{Station: "KFWS", Bucket: nexrad.ChunkBucket, Path: "KFWS/1/20240418-033635-001-S"}
+	in <- events.NexradChunkEvent{Station: "KTLX", Bucket: nexrad.ChunkBucket, Path: first}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stand.requests.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	read(t, c, first)
+	if got := stand.requests.Load(); got != 1 {
+		t.Errorf("%d requests, want only the subscribed station's chunk", got)
+	}
+}
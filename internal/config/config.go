@@ -2,9 +2,15 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -12,18 +18,291 @@ import (
 )
 
 type Config struct {
-	HTTP HTTP `json:"http"`
+	HTTP       HTTP       `json:"http"`
+	Ingest     Ingest     `json:"ingest"`
+	S3         S3         `json:"s3"`
+	Downloader Downloader `json:"downloader"`
+	Assembler  Assembler  `json:"assembler"`
+	Decoder    Decoder    `json:"decoder"`
+	Imagery    Imagery    `json:"imagery"`
+	Rules      []Rule     `json:"rules"`
+	Zones      []Zone     `json:"zones"`
+	Status     Status     `json:"status"`
+	Correlator Correlator `json:"correlator"`
+	Polling    Polling    `json:"polling"`
+	ChunkCache ChunkCache `json:"chunk_cache"`
 }
 
+// Duration is a time.Duration that decodes from strings such as "1h30m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		// Bare numbers are seconds, which is what people mean in YAML.
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule raises a nexrad-alert when its one condition is met.
+type Rule struct {
+	Name string `json:"name"`
+	// Stations the rule applies to. Empty means every station.
+	Stations  []string            `json:"stations"`
+	VCPChange *VCPChangeCondition `json:"vcp_change"`
+	SAILS     *SAILSCondition     `json:"sails"`
+	Cadence   *CadenceCondition   `json:"cadence"`
+	Silence   *SilenceCondition   `json:"silence"`
+}
+
+// VCPChangeCondition matches a station switching volume coverage pattern.
+// An empty From or To matches any VCP.
+type VCPChangeCondition struct {
+	From []int `json:"from"`
+	To   []int `json:"to"`
+}
+
+// SAILSCondition matches a station entering SAILS or MESO-SAILS, that is
+// starting to repeat its lowest tilt at least MinCuts times per volume.
+type SAILSCondition struct {
+	MinCuts int `json:"min_cuts"`
+}
+
+// CadenceCondition matches a volume that started longer than Above, or
+// sooner than Below, after the previous one. Zero disables either bound.
+type CadenceCondition struct {
+	Above Duration `json:"above"`
+	Below Duration `json:"below"`
+}
+
+// SilenceCondition matches a station that has sent no chunks for After.
+type SilenceCondition struct {
+	After Duration `json:"after"`
+}
+
+// Zone raises a nexrad-alert when the lowest tilt of a station shows
+// reflectivity of at least Threshold inside it. A zone is either a Point
+// with a radius or a Polygon.
+type Zone struct {
+	Name string `json:"name"`
+	// Stations whose scans are checked. Empty means every station.
+	Stations []string `json:"stations"`
+	// Threshold is the lowest reflectivity that alerts, in dBZ.
+	Threshold float64    `json:"threshold"`
+	Point     *ZonePoint `json:"point"`
+	// Polygon lists the zone's vertices as [latitude, longitude] pairs.
+	Polygon [][2]float64 `json:"polygon"`
+	// Cooldown is the least time between alerts for the zone and station.
+	// Echoes must also leave the zone for a scan before it alerts again.
+	Cooldown Duration `json:"cooldown"`
+}
+
+type ZonePoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Radius is in kilometers.
+	Radius float64 `json:"radius"`
+}
+
+// ChunkCache caches the chunks served by the chunk proxy on disk.
+type ChunkCache struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// MaxSize is the most the cache may hold, in megabytes. The least
+	// recently used chunks are removed beyond it.
+	MaxSize uint `json:"max_size"`
+	// Prefetch caches the chunks of subscribed stations as they are
+	// announced, before any client asks for them.
+	Prefetch bool `json:"prefetch"`
+}
+
+// Polling keeps a GRLevelX polling directory of assembled volumes.
+type Polling struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// Stations to keep directories for. Their chunks are received whether
+	// or not a client is connected.
+	Stations []string `json:"stations"`
+	// Volumes is how many of the latest volumes each directory holds.
+	Volumes uint `json:"volumes"`
+}
+
+type Correlator struct {
+	Enabled bool `json:"enabled"`
+	// Window is how long a volume seen on one feed waits for the other
+	// before it is reported as chunk-only or archive-only.
+	Window Duration `json:"window"`
+}
+
+type Status struct {
+	// OfflineAfter is how long a subscribed station may send no chunks
+	// before it is reported offline.
+	OfflineAfter Duration `json:"offline_after"`
+	// DegradedFactor is how many times longer, or shorter, than is typical
+	// for its VCP a station's time between volumes may be before it is
+	// reported degraded.
+	DegradedFactor float64 `json:"degraded_factor"`
+}
+
+type Imagery struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// Stations to render. Empty means every station with a subscriber.
+	Stations []string `json:"stations"`
+	// Size is the width and height of the square image in pixels.
+	Size uint `json:"size"`
+	// Range is how far from the radar the image reaches, in kilometers.
+	Range float64 `json:"range"`
+}
+
+type Decoder struct {
+	Enabled bool `json:"enabled"`
+	// Timeout bounds how long a chunk event may be held back while its chunk
+	// is fetched and decoded. On timeout the event is published undecoded.
+	Timeout Duration `json:"timeout"`
+}
+
+type Assembler struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// Stations to assemble. Empty means every station with a subscriber.
+	Stations []string `json:"stations"`
+	// Timeout is how long a volume may go without a new chunk before it is
+	// given up on and announced as partial.
+	Timeout Duration `json:"timeout"`
+}
+
+type S3 struct {
+	// Endpoint overrides where objects are fetched from, for S3-compatible
+	// stand-ins. Objects are requested path-style as Endpoint/bucket/key.
+	Endpoint string `json:"endpoint"`
+}
+
+type Downloader struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// Stations to download. Empty means every station with a subscriber.
+	Stations    []string `json:"stations"`
+	Concurrency uint     `json:"concurrency"`
+	Retries     uint     `json:"retries"`
+	// Retention is how long downloaded files are kept. Zero keeps them forever.
+	Retention Duration `json:"retention"`
+}
+
+type IngestMode string
+
+const (
+	// IngestModeSQS subscribes a private SQS queue to the NOAA topics and polls it.
+	IngestModeSQS IngestMode = "sqs"
+	// IngestModeHTTP subscribes the server's own public URL to the NOAA topics.
+	IngestModeHTTP IngestMode = "http"
+)
+
+type SNS struct {
+	EndpointURL      string   `json:"endpoint_url"`
+	SigningCertHosts []string `json:"signing_cert_hosts"`
+}
+
+// Health sets when the listener is reported unhealthy.
+type Health struct {
+	// StaleAfter is how long a queue may go without a successful receive
+	// before the listener is down.
+	StaleAfter Duration `json:"stale_after"`
+	// ErrorThreshold is how many receives in a row may fail before the
+	// listener is down. Fewer leave it degraded.
+	ErrorThreshold uint `json:"error_threshold"`
+	// RestartAfter is how long the listener may be down, or starting,
+	// before liveness fails and the service should be restarted.
+	RestartAfter Duration `json:"restart_after"`
+	// VerifyInterval is how often the SNS subscriptions are checked, and
+	// recreated if they have gone.
+	VerifyInterval Duration `json:"verify_interval"`
+}
+
+// Canary sends a synthetic notification through the chunk queue at an
+// interval, checking that it reaches the websocket hub.
+type Canary struct {
+	Enabled  bool     `json:"enabled"`
+	Interval Duration `json:"interval"`
+	// Timeout is how long a canary may take to arrive before it has failed.
+	Timeout Duration `json:"timeout"`
+}
+
+type Ingest struct {
+	Mode   IngestMode `json:"mode"`
+	SNS    SNS        `json:"sns"`
+	Health Health     `json:"health"`
+	Canary Canary     `json:"canary"`
+}
+
+// Listen address prefixes for Unix sockets and for sockets passed by systemd.
+const (
+	ListenUnixPrefix    = "unix:"
+	ListenSystemdPrefix = "systemd:"
+)
+
+type TLSVersion string
+
+const (
+	TLSVersion12 TLSVersion = "1.2"
+	TLSVersion13 TLSVersion = "1.3"
+)
+
+// TLS serves a listener over TLS when CertFile and KeyFile are set. The files
+// are reloaded when they change or on SIGHUP.
+type TLS struct {
+	CertFile   string     `json:"cert_file"`
+	KeyFile    string     `json:"key_file"`
+	MinVersion TLSVersion `json:"min_version"`
+	// ClientCAFile, when set, requires clients to present a certificate
+	// signed by one of the PEM CAs it holds.
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+// HTTPListener is where a server listens. Each of Listen is a TCP address
+// such as ":8080" or "127.0.0.1:8080", a Unix socket path prefixed with
+// "unix:", or "systemd:" for the sockets systemd passed us, optionally
+// followed by a FileDescriptorName to take only those with that name.
 type HTTPListener struct {
-	IPV4Host string `json:"ipv4_host"`
-	IPV6Host string `json:"ipv6_host"`
-	Port     uint16 `json:"port"`
+	Listen []string `json:"listen"`
+	// SocketMode is the octal permissions Unix sockets are created with.
+	SocketMode string `json:"socket_mode"`
+	TLS        TLS    `json:"tls"`
 }
 
+type TracingProtocol string
+
+const (
+	TracingProtocolGRPC TracingProtocol = "grpc"
+	TracingProtocolHTTP TracingProtocol = "http"
+)
+
 type Tracing struct {
-	Enabled      bool   `json:"enabled"`
-	OTLPEndpoint string `json:"otlp_endpoint"`
+	Enabled bool `json:"enabled"`
+	// OTLPEndpoint is the collector's URL. Without a scheme TLS is used.
+	// When empty the OTEL_EXPORTER_OTLP_* environment variables apply.
+	OTLPEndpoint string          `json:"otlp_endpoint"`
+	Protocol     TracingProtocol `json:"protocol"`
+	// SampleRate is the fraction of notifications traced. Spans started
+	// by an incoming request that is already traced follow its decision.
+	SampleRate float64 `json:"sample_rate"`
 }
 
 type PProf struct {
@@ -35,72 +314,653 @@ type Metrics struct {
 	Enabled bool `json:"enabled"`
 }
 
+// APIKey is a static credential. Stations and Types restrict what it may
+// subscribe to; left empty, either allows everything.
+type APIKey struct {
+	// Name identifies the key in logs.
+	Name     string   `json:"name"`
+	Key      string   `json:"key"`
+	Stations []string `json:"stations"`
+	Types    []string `json:"types"`
+}
+
+// JWT sets how bearer tokens are verified. Tokens are restricted by their
+// stations and types claims in the same way as API keys.
+type JWT struct {
+	// KeyFile holds a PEM RSA public key or certificate to verify RS256,
+	// RS384 and RS512 tokens with, or otherwise an HMAC secret to verify
+	// HS256, HS384 and HS512 tokens with.
+	KeyFile string `json:"key_file"`
+	// JWKSFile holds a JSON Web Key Set of RSA and HMAC keys, picked by the
+	// token's kid header.
+	JWKSFile string `json:"jwks_file"`
+	// Issuer and Audience are checked when set.
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+}
+
+type Auth struct {
+	Enabled bool     `json:"enabled"`
+	APIKeys []APIKey `json:"api_keys"`
+	JWT     JWT      `json:"jwt"`
+}
+
+// Limits bounds the websocket connections clients may open. Zero leaves a
+// limit off.
+type Limits struct {
+	// MaxConnections is the most connections open at once, from every
+	// client together.
+	MaxConnections uint `json:"max_connections"`
+	// MaxConnectionsPerIP is the most connections one client IP may have
+	// open at once.
+	MaxConnectionsPerIP uint `json:"max_connections_per_ip"`
+	// MaxSubscriptionsPerKey is the most subscriptions one API key, or one
+	// token subject, may have open at once. A connection subscribes to one
+	// type and station.
+	MaxSubscriptionsPerKey uint `json:"max_subscriptions_per_key"`
+	// ConnectRate is how many connections a second one client IP may open,
+	// in bursts of up to ConnectBurst.
+	ConnectRate  float64 `json:"connect_rate"`
+	ConnectBurst uint    `json:"connect_burst"`
+}
+
 type HTTP struct {
 	HTTPListener
-	Tracing
+	Tracing        Tracing  `json:"tracing"`
 	PProf          PProf    `json:"pprof"`
 	TrustedProxies []string `json:"trusted_proxies"`
-	Metrics        Metrics  `json:"metrics"`
-	CORSHosts      []string `json:"cors_hosts"`
+	// TrustedPlatform is a header, set by the platform in front of us, that
+	// holds the client's IP and is believed whoever sends it. Empty, the
+	// default, trusts no header.
+	TrustedPlatform string   `json:"trusted_platform"`
+	Metrics         Metrics  `json:"metrics"`
+	CORSHosts       []string `json:"cors_hosts"`
+	Auth            Auth     `json:"auth"`
+	Limits          Limits   `json:"limits"`
 }
 
 //nolint:golint,gochecknoglobals
 var (
-	ConfigFileKey          = "config"
-	HTTPIPV4HostKey        = "http.ipv4_host"
-	HTTPIPV6HostKey        = "http.ipv6_host"
-	HTTPPortKey            = "http.port"
-	HTTPTracingEnabledKey  = "http.tracing.enabled"
-	HTTPTracingOTLPEndKey  = "http.tracing.otlp_endpoint"
-	HTTPPProfEnabledKey    = "http.pprof.enabled"
-	HTTPTrustedProxiesKey  = "http.trusted_proxies"
-	HTTPMetricsEnabledKey  = "http.metrics.enabled"
-	HTTPMetricsIPV4HostKey = "http.metrics.ipv4_host"
-	HTTPMetricsIPV6HostKey = "http.metrics.ipv6_host"
-	HTTPMetricsPortKey     = "http.metrics.port"
-	HTTPCORSHostsKey       = "http.cors_hosts"
+	ConfigFileKey           = "config"
+	HTTPListenKey           = "http.listen"
+	HTTPSocketModeKey       = "http.socket_mode"
+	HTTPTLSCertKey          = "http.tls.cert_file"
+	HTTPTLSKeyKey           = "http.tls.key_file"
+	HTTPTLSMinVersionKey    = "http.tls.min_version"
+	HTTPTLSClientCAKey      = "http.tls.client_ca_file"
+	HTTPTracingEnabledKey   = "http.tracing.enabled"
+	HTTPTracingOTLPEndKey   = "http.tracing.otlp_endpoint"
+	HTTPTracingProtocolKey  = "http.tracing.protocol"
+	HTTPTracingSampleKey    = "http.tracing.sample_rate"
+	HTTPPProfEnabledKey     = "http.pprof.enabled"
+	HTTPTrustedProxiesKey   = "http.trusted_proxies"
+	HTTPTrustedPlatformKey  = "http.trusted_platform"
+	HTTPMetricsEnabledKey   = "http.metrics.enabled"
+	HTTPMetricsListenKey    = "http.metrics.listen"
+	HTTPMetricsSocketKey    = "http.metrics.socket_mode"
+	HTTPMetricsTLSCertKey   = "http.metrics.tls.cert_file"
+	HTTPMetricsTLSKeyKey    = "http.metrics.tls.key_file"
+	HTTPMetricsTLSMinKey    = "http.metrics.tls.min_version"
+	HTTPMetricsTLSCAKey     = "http.metrics.tls.client_ca_file"
+	HTTPCORSHostsKey        = "http.cors_hosts"
+	HTTPAuthEnabledKey      = "http.auth.enabled"
+	HTTPAuthKeyFileKey      = "http.auth.jwt.key_file"
+	HTTPAuthJWKSFileKey     = "http.auth.jwt.jwks_file"
+	HTTPAuthIssuerKey       = "http.auth.jwt.issuer"
+	HTTPAuthAudienceKey     = "http.auth.jwt.audience"
+	HTTPLimitsMaxConnsKey   = "http.limits.max_connections"
+	HTTPLimitsPerIPKey      = "http.limits.max_connections_per_ip"
+	HTTPLimitsPerKeyKey     = "http.limits.max_subscriptions_per_key"
+	HTTPLimitsRateKey       = "http.limits.connect_rate"
+	HTTPLimitsBurstKey      = "http.limits.connect_burst"
+	IngestModeKey           = "ingest.mode"
+	IngestSNSEndpointKey    = "ingest.sns.endpoint_url"
+	IngestSNSCertHostsKey   = "ingest.sns.signing_cert_hosts"
+	IngestHealthStaleKey    = "ingest.health.stale_after"
+	IngestHealthErrorsKey   = "ingest.health.error_threshold"
+	IngestHealthRestartKey  = "ingest.health.restart_after"
+	IngestHealthVerifyKey   = "ingest.health.verify_interval"
+	IngestCanaryEnabledKey  = "ingest.canary.enabled"
+	IngestCanaryIntervalKey = "ingest.canary.interval"
+	IngestCanaryTimeoutKey  = "ingest.canary.timeout"
+	S3EndpointKey           = "s3.endpoint"
+	DownloaderEnabledKey    = "downloader.enabled"
+	DownloaderDirectoryKey  = "downloader.directory"
+	DownloaderStationsKey   = "downloader.stations"
+	DownloaderConcurKey     = "downloader.concurrency"
+	DownloaderRetriesKey    = "downloader.retries"
+	DownloaderRetentionKey  = "downloader.retention"
+	AssemblerEnabledKey     = "assembler.enabled"
+	AssemblerDirectoryKey   = "assembler.directory"
+	AssemblerStationsKey    = "assembler.stations"
+	AssemblerTimeoutKey     = "assembler.timeout"
+	DecoderEnabledKey       = "decoder.enabled"
+	DecoderTimeoutKey       = "decoder.timeout"
+	ImageryEnabledKey       = "imagery.enabled"
+	ImageryDirectoryKey     = "imagery.directory"
+	ImageryStationsKey      = "imagery.stations"
+	ImagerySizeKey          = "imagery.size"
+	ImageryRangeKey         = "imagery.range"
+	StatusOfflineAfterKey   = "status.offline_after"
+	StatusDegradedKey       = "status.degraded_factor"
+	CorrelatorEnabledKey    = "correlator.enabled"
+	CorrelatorWindowKey     = "correlator.window"
+	ChunkCacheEnabledKey    = "chunk_cache.enabled"
+	ChunkCacheDirectoryKey  = "chunk_cache.directory"
+	ChunkCacheMaxSizeKey    = "chunk_cache.max_size"
+	ChunkCachePrefetchKey   = "chunk_cache.prefetch"
+	PollingEnabledKey       = "polling.enabled"
+	PollingDirectoryKey     = "polling.directory"
+	PollingStationsKey      = "polling.stations"
+	PollingVolumesKey       = "polling.volumes"
 )
 
 const (
-	DefaultHTTPIPV4Host        = "0.0.0.0"
-	DefaultHTTPIPV6Host        = "::"
-	DefaultHTTPPort            = 8080
-	DefaultHTTPMetricsIPV4Host = "127.0.0.1"
-	DefaultHTTPMetricsIPV6Host = "::1"
-	DefaultHTTPMetricsPort     = 8081
+	DefaultHTTPListen          = ":8080"
+	DefaultHTTPMetricsListen   = "127.0.0.1:8081"
+	DefaultSocketMode          = "0660"
+	DefaultTLSMinVersion       = TLSVersion12
+	DefaultIngestMode          = IngestModeSQS
+	DefaultSNSSigningCertHost  = "sns.us-east-1.amazonaws.com"
+	DefaultDownloaderDirectory = "data"
+	DefaultDownloaderConcur    = 4
+	DefaultDownloaderRetries   = 3
+	DefaultDownloaderRetention = 24 * time.Hour
+	DefaultAssemblerDirectory  = "volumes"
+	DefaultAssemblerTimeout    = 2 * time.Minute
+	DefaultDecoderTimeout      = 10 * time.Second
+	DefaultImageryDirectory    = "images"
+	DefaultImagerySize         = 1024
+	DefaultImageryRange        = 230
+	DefaultZoneCooldown        = 30 * time.Minute
+	DefaultStatusOfflineAfter  = 20 * time.Minute
+	DefaultStatusDegraded      = 2
+	DefaultCorrelatorWindow    = 30 * time.Minute
+	DefaultChunkCacheDirectory = "chunk-cache"
+	DefaultChunkCacheMaxSize   = 512
+	DefaultPollingDirectory    = "polling"
+	DefaultPollingVolumes      = 12
+	DefaultTracingProtocol     = TracingProtocolGRPC
+	DefaultHealthStaleAfter    = time.Minute
+	DefaultHealthErrors        = 5
+	DefaultHealthRestartAfter  = 10 * time.Minute
+	DefaultHealthVerify        = 5 * time.Minute
+	DefaultCanaryInterval      = time.Minute
+	DefaultCanaryTimeout       = 30 * time.Second
+	DefaultTracingSampleRate   = 1.0
+	DefaultLimitsConnectBurst  = 5
 )
 
 func RegisterFlags(cmd *cobra.Command) {
 	cmd.Flags().StringP(ConfigFileKey, "c", "", "Config file path")
-	cmd.Flags().String(HTTPIPV4HostKey, DefaultHTTPIPV4Host, "HTTP server IPv4 host")
-	cmd.Flags().String(HTTPIPV6HostKey, DefaultHTTPIPV6Host, "HTTP server IPv6 host")
-	cmd.Flags().Uint16(HTTPPortKey, DefaultHTTPPort, "HTTP server port")
+	cmd.Flags().StringSlice(HTTPListenKey, []string{DefaultHTTPListen}, "Comma-separated list of addresses the HTTP server listens on: host:port, unix:/path or systemd:[name]")
+	cmd.Flags().String(HTTPSocketModeKey, DefaultSocketMode, "Octal permissions of the HTTP server's Unix sockets")
+	cmd.Flags().String(HTTPTLSCertKey, "", "PEM certificate chain to serve HTTPS with")
+	cmd.Flags().String(HTTPTLSKeyKey, "", "PEM private key to serve HTTPS with")
+	cmd.Flags().String(HTTPTLSMinVersionKey, string(DefaultTLSMinVersion), "Minimum TLS version, either 1.2 or 1.3")
+	cmd.Flags().String(HTTPTLSClientCAKey, "", "PEM CA certificates clients must present a certificate from")
 	cmd.Flags().Bool(HTTPTracingEnabledKey, false, "Enable Open Telemetry tracing")
 	cmd.Flags().String(HTTPTracingOTLPEndKey, "", "Open Telemetry endpoint")
+	cmd.Flags().String(HTTPTracingProtocolKey, string(DefaultTracingProtocol), "OTLP protocol, either grpc or http")
+	cmd.Flags().Float64(HTTPTracingSampleKey, DefaultTracingSampleRate, "Fraction of notifications traced, from 0 to 1")
 	cmd.Flags().Bool(HTTPPProfEnabledKey, false, "Enable pprof")
 	cmd.Flags().StringSlice(HTTPTrustedProxiesKey, []string{}, "Comma-separated list of trusted proxies")
+	cmd.Flags().String(HTTPTrustedPlatformKey, "", "Header holding the client IP, set by the platform in front of the server. Empty uses the connection's address")
 	cmd.Flags().Bool(HTTPMetricsEnabledKey, false, "Enable metrics server")
-	cmd.Flags().String(HTTPMetricsIPV4HostKey, DefaultHTTPMetricsIPV4Host, "Metrics server IPv4 host")
-	cmd.Flags().String(HTTPMetricsIPV6HostKey, DefaultHTTPMetricsIPV6Host, "Metrics server IPv6 host")
-	cmd.Flags().Uint16(HTTPMetricsPortKey, DefaultHTTPMetricsPort, "Metrics server port")
+	cmd.Flags().StringSlice(HTTPMetricsListenKey, []string{DefaultHTTPMetricsListen}, "Comma-separated list of addresses the metrics server listens on: host:port, unix:/path or systemd:[name]")
+	cmd.Flags().String(HTTPMetricsSocketKey, DefaultSocketMode, "Octal permissions of the metrics server's Unix sockets")
+	cmd.Flags().String(HTTPMetricsTLSCertKey, "", "PEM certificate chain to serve metrics over HTTPS with")
+	cmd.Flags().String(HTTPMetricsTLSKeyKey, "", "PEM private key to serve metrics over HTTPS with")
+	cmd.Flags().String(HTTPMetricsTLSMinKey, string(DefaultTLSMinVersion), "Minimum TLS version for the metrics server, either 1.2 or 1.3")
+	cmd.Flags().String(HTTPMetricsTLSCAKey, "", "PEM CA certificates metrics clients must present a certificate from")
 	cmd.Flags().StringSlice(HTTPCORSHostsKey, []string{}, "Comma-separated list of CORS hosts")
+	cmd.Flags().Bool(HTTPAuthEnabledKey, false, "Require an API key or JWT to open websocket connections")
+	cmd.Flags().String(HTTPAuthKeyFileKey, "", "File holding the PEM RSA public key or HMAC secret JWTs are verified with")
+	cmd.Flags().String(HTTPAuthJWKSFileKey, "", "File holding the JSON Web Key Set JWTs are verified with")
+	cmd.Flags().String(HTTPAuthIssuerKey, "", "Issuer JWTs must have")
+	cmd.Flags().String(HTTPAuthAudienceKey, "", "Audience JWTs must have")
+	cmd.Flags().Uint(HTTPLimitsMaxConnsKey, 0, "Most websocket connections open at once, 0 for no limit")
+	cmd.Flags().Uint(HTTPLimitsPerIPKey, 0, "Most websocket connections one client IP may have open, 0 for no limit")
+	cmd.Flags().Uint(HTTPLimitsPerKeyKey, 0, "Most websocket subscriptions one API key or token subject may have open, 0 for no limit")
+	cmd.Flags().Float64(HTTPLimitsRateKey, 0, "Websocket connections a second one client IP may open, 0 for no limit")
+	cmd.Flags().Uint(HTTPLimitsBurstKey, DefaultLimitsConnectBurst, "Websocket connections one client IP may open at once before the connect rate applies")
+	cmd.Flags().String(IngestModeKey, string(DefaultIngestMode), "How notifications are received, either sqs or http")
+	cmd.Flags().String(IngestSNSEndpointKey, "", "Public URL SNS should deliver to in http ingest mode")
+	cmd.Flags().StringSlice(IngestSNSCertHostsKey, []string{DefaultSNSSigningCertHost}, "Comma-separated list of hosts SNS signing certificates may be fetched from")
+	cmd.Flags().Duration(IngestHealthStaleKey, DefaultHealthStaleAfter, "How long a queue may go without a successful receive before the listener is down")
+	cmd.Flags().Uint(IngestHealthErrorsKey, DefaultHealthErrors, "How many receives in a row may fail before the listener is down")
+	cmd.Flags().Duration(IngestHealthRestartKey, DefaultHealthRestartAfter, "How long the listener may be down before liveness fails")
+	cmd.Flags().Duration(IngestHealthVerifyKey, DefaultHealthVerify, "How often the SNS subscriptions are checked and recreated if missing")
+	cmd.Flags().Bool(IngestCanaryEnabledKey, false, "Enable sending a synthetic notification through the chunk queue to check it reaches clients, requires sqs ingest mode")
+	cmd.Flags().Duration(IngestCanaryIntervalKey, DefaultCanaryInterval, "How often a canary notification is sent")
+	cmd.Flags().Duration(IngestCanaryTimeoutKey, DefaultCanaryTimeout, "How long a canary notification may take to arrive before it has failed")
+	cmd.Flags().String(S3EndpointKey, "", "S3-compatible endpoint to fetch NEXRAD objects from instead of AWS")
+	cmd.Flags().Bool(DownloaderEnabledKey, false, "Enable downloading objects as they are announced")
+	cmd.Flags().String(DownloaderDirectoryKey, DefaultDownloaderDirectory, "Directory downloaded objects are written to")
+	cmd.Flags().StringSlice(DownloaderStationsKey, []string{}, "Comma-separated list of stations to download, defaults to every subscribed station")
+	cmd.Flags().Uint(DownloaderConcurKey, DefaultDownloaderConcur, "Number of concurrent downloads")
+	cmd.Flags().Uint(DownloaderRetriesKey, DefaultDownloaderRetries, "Number of times a failed download is retried")
+	cmd.Flags().Duration(DownloaderRetentionKey, DefaultDownloaderRetention, "How long downloaded objects are kept, 0 keeps them forever")
+	cmd.Flags().Bool(AssemblerEnabledKey, false, "Enable assembling real-time chunks into Level II volumes")
+	cmd.Flags().String(AssemblerDirectoryKey, DefaultAssemblerDirectory, "Directory assembled volumes are written to")
+	cmd.Flags().StringSlice(AssemblerStationsKey, []string{}, "Comma-separated list of stations to assemble, defaults to every subscribed station")
+	cmd.Flags().Duration(AssemblerTimeoutKey, DefaultAssemblerTimeout, "How long to wait for a missing chunk before announcing a partial volume")
+	cmd.Flags().Bool(DecoderEnabledKey, false, "Enable decoding chunks to add VCP and elevation details to chunk events")
+	cmd.Flags().Duration(DecoderTimeoutKey, DefaultDecoderTimeout, "How long to spend fetching and decoding a chunk before publishing its event without details")
+	cmd.Flags().Bool(ImageryEnabledKey, false, "Enable rendering base reflectivity images of the lowest tilt, requires the decoder")
+	cmd.Flags().String(ImageryDirectoryKey, DefaultImageryDirectory, "Directory rendered images are written to")
+	cmd.Flags().StringSlice(ImageryStationsKey, []string{}, "Comma-separated list of stations to render, defaults to every subscribed station")
+	cmd.Flags().Uint(ImagerySizeKey, DefaultImagerySize, "Width and height of rendered images in pixels")
+	cmd.Flags().Float64(ImageryRangeKey, DefaultImageryRange, "How far from the radar rendered images reach, in kilometers")
+	cmd.Flags().Duration(StatusOfflineAfterKey, DefaultStatusOfflineAfter, "How long a subscribed station may send no chunks before it is reported offline")
+	cmd.Flags().Float64(StatusDegradedKey, DefaultStatusDegraded, "How many times its typical time between volumes a station may stray before it is reported degraded")
+	cmd.Flags().Bool(CorrelatorEnabledKey, false, "Enable matching real-time volumes to their archive files")
+	cmd.Flags().Duration(CorrelatorWindowKey, DefaultCorrelatorWindow, "How long a volume seen on one feed waits for the other before it is reported as missing from it")
+	cmd.Flags().Bool(ChunkCacheEnabledKey, false, "Enable the /api/chunks proxy and its disk cache")
+	cmd.Flags().String(ChunkCacheDirectoryKey, DefaultChunkCacheDirectory, "Directory cached chunks are written to")
+	cmd.Flags().Uint(ChunkCacheMaxSizeKey, DefaultChunkCacheMaxSize, "Most the chunk cache may hold, in megabytes")
+	cmd.Flags().Bool(ChunkCachePrefetchKey, true, "Cache the chunks of subscribed stations as they are announced")
+	cmd.Flags().Bool(PollingEnabledKey, false, "Enable serving GRLevelX polling directories of assembled volumes, requires the assembler")
+	cmd.Flags().String(PollingDirectoryKey, DefaultPollingDirectory, "Directory the polling directories are kept in")
+	cmd.Flags().StringSlice(PollingStationsKey, []string{}, "Comma-separated list of stations to keep polling directories for")
+	cmd.Flags().Uint(PollingVolumesKey, DefaultPollingVolumes, "How many of the latest volumes each polling directory holds")
 }
 
 func (c *Config) Validate() error {
+	switch c.Ingest.Mode {
+	case IngestModeSQS:
+	case IngestModeHTTP:
+		endpoint, err := url.Parse(c.Ingest.SNS.EndpointURL)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return fmt.Errorf("%s must be an absolute http or https URL in http ingest mode", IngestSNSEndpointKey)
+		}
+		if len(c.Ingest.SNS.SigningCertHosts) == 0 {
+			return fmt.Errorf("%s must not be empty in http ingest mode", IngestSNSCertHostsKey)
+		}
+	default:
+		return fmt.Errorf("unknown ingest mode %q", c.Ingest.Mode)
+	}
+
+	if c.S3.Endpoint != "" {
+		endpoint, err := url.Parse(c.S3.Endpoint)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return fmt.Errorf("%s must be an absolute http or https URL", S3EndpointKey)
+		}
+	}
+
+	if c.Downloader.Enabled {
+		if c.Downloader.Concurrency == 0 {
+			return fmt.Errorf("%s must be at least 1", DownloaderConcurKey)
+		}
+		if c.Downloader.Retention < 0 {
+			return fmt.Errorf("%s must not be negative", DownloaderRetentionKey)
+		}
+	}
+
+	if c.Assembler.Enabled && c.Assembler.Timeout <= 0 {
+		return fmt.Errorf("%s must be positive", AssemblerTimeoutKey)
+	}
+
+	if c.Decoder.Enabled && c.Decoder.Timeout <= 0 {
+		return fmt.Errorf("%s must be positive", DecoderTimeoutKey)
+	}
+
+	if err := validateListener(&c.HTTP.HTTPListener, HTTPListenKey, HTTPSocketModeKey); err != nil {
+		return err
+	}
+	if c.HTTP.Metrics.Enabled {
+		if err := validateListener(&c.HTTP.Metrics.HTTPListener, HTTPMetricsListenKey, HTTPMetricsSocketKey); err != nil {
+			return err
+		}
+	}
+	if err := validateTLS(&c.HTTP.TLS, HTTPTLSCertKey, HTTPTLSKeyKey, HTTPTLSMinVersionKey, HTTPTLSClientCAKey); err != nil {
+		return err
+	}
+	if err := validateTLS(&c.HTTP.Metrics.TLS, HTTPMetricsTLSCertKey, HTTPMetricsTLSKeyKey, HTTPMetricsTLSMinKey, HTTPMetricsTLSCAKey); err != nil {
+		return err
+	}
+
+	if c.HTTP.Limits.ConnectRate < 0 {
+		return fmt.Errorf("%s must not be negative", HTTPLimitsRateKey)
+	}
+	// Zero was replaced with the default when loading.
+	if c.HTTP.Limits.ConnectRate > 0 && c.HTTP.Limits.ConnectBurst == 0 {
+		return fmt.Errorf("%s must be positive", HTTPLimitsBurstKey)
+	}
+
+	if err := c.validateAuth(); err != nil {
+		return err
+	}
+
+	if err := c.validateRules(); err != nil {
+		return err
+	}
+
+	if err := c.validateZones(); err != nil {
+		return err
+	}
+
+	// Zero values were replaced with defaults when loading.
+	if c.Ingest.Health.StaleAfter < 0 {
+		return fmt.Errorf("%s must be positive", IngestHealthStaleKey)
+	}
+	if c.Ingest.Health.RestartAfter < 0 {
+		return fmt.Errorf("%s must be positive", IngestHealthRestartKey)
+	}
+	if c.Ingest.Health.VerifyInterval < 0 {
+		return fmt.Errorf("%s must be positive", IngestHealthVerifyKey)
+	}
+	if c.Ingest.Canary.Enabled {
+		// In http mode there is no queue of our own to send it to.
+		if c.Ingest.Mode != IngestModeSQS {
+			return fmt.Errorf("%s requires sqs ingest mode", IngestCanaryEnabledKey)
+		}
+		if c.Ingest.Canary.Interval <= 0 {
+			return fmt.Errorf("%s must be positive", IngestCanaryIntervalKey)
+		}
+		if c.Ingest.Canary.Timeout <= 0 {
+			return fmt.Errorf("%s must be positive", IngestCanaryTimeoutKey)
+		}
+	}
+
+	if c.Status.OfflineAfter <= 0 {
+		return fmt.Errorf("%s must be positive", StatusOfflineAfterKey)
+	}
+	if c.Status.DegradedFactor <= 1 {
+		return fmt.Errorf("%s must be greater than 1", StatusDegradedKey)
+	}
+
+	if c.Correlator.Enabled && c.Correlator.Window <= 0 {
+		return fmt.Errorf("%s must be positive", CorrelatorWindowKey)
+	}
+
+	if c.HTTP.Tracing.Enabled {
+		switch c.HTTP.Tracing.Protocol {
+		case TracingProtocolGRPC, TracingProtocolHTTP:
+		default:
+			return fmt.Errorf("unknown %s %q", HTTPTracingProtocolKey, c.HTTP.Tracing.Protocol)
+		}
+		if c.HTTP.Tracing.SampleRate < 0 || c.HTTP.Tracing.SampleRate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", HTTPTracingSampleKey)
+		}
+	}
+
+	if c.ChunkCache.Enabled && c.ChunkCache.MaxSize == 0 {
+		return fmt.Errorf("%s must be at least 1", ChunkCacheMaxSizeKey)
+	}
+
+	if c.Polling.Enabled {
+		if !c.Assembler.Enabled {
+			return fmt.Errorf("%s requires %s", PollingEnabledKey, AssemblerEnabledKey)
+		}
+		if len(c.Polling.Stations) == 0 {
+			return fmt.Errorf("%s must not be empty", PollingStationsKey)
+		}
+		for _, station := range c.Polling.Stations {
+			assembled := len(c.Assembler.Stations) == 0 || slices.ContainsFunc(c.Assembler.Stations, func(s string) bool {
+				return strings.EqualFold(s, station)
+			})
+			if !assembled {
+				return fmt.Errorf("%s includes %s, which %s does not", PollingStationsKey, station, AssemblerStationsKey)
+			}
+		}
+		if c.Polling.Volumes == 0 {
+			return fmt.Errorf("%s must be at least 1", PollingVolumesKey)
+		}
+	}
+
+	if c.Imagery.Enabled {
+		if !c.Decoder.Enabled {
+			return fmt.Errorf("%s requires %s", ImageryEnabledKey, DecoderEnabledKey)
+		}
+		if c.Imagery.Size < 64 || c.Imagery.Size > 4096 {
+			return fmt.Errorf("%s must be between 64 and 4096", ImagerySizeKey)
+		}
+		if c.Imagery.Range <= 0 {
+			return fmt.Errorf("%s must be positive", ImageryRangeKey)
+		}
+	}
+	return nil
+}
+
+// validateListener checks one listener's addresses, naming them by the keys
+// given. Zero values were replaced with defaults when loading.
+func validateListener(listener *HTTPListener, listenKey, socketModeKey string) error {
+	if listener.Listen != nil && len(listener.Listen) == 0 {
+		return fmt.Errorf("%s must not be empty", listenKey)
+	}
+	for _, address := range listener.Listen {
+		switch {
+		case strings.HasPrefix(address, ListenUnixPrefix):
+			if strings.TrimPrefix(address, ListenUnixPrefix) == "" {
+				return fmt.Errorf("%s address %q has no socket path", listenKey, address)
+			}
+		case strings.HasPrefix(address, ListenSystemdPrefix):
+		default:
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return fmt.Errorf("%s address %q is not a host:port, unix: or systemd: address: %w", listenKey, address, err)
+			}
+		}
+	}
+	if listener.SocketMode != "" {
+		if _, err := ParseSocketMode(listener.SocketMode); err != nil {
+			return fmt.Errorf("%s %w", socketModeKey, err)
+		}
+	}
+	return nil
+}
+
+// ParseSocketMode parses octal Unix socket permissions such as "0660".
+func ParseSocketMode(mode string) (os.FileMode, error) {
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || parsed > 0o777 {
+		return 0, fmt.Errorf("%q is not octal permissions such as 0660", mode)
+	}
+	return os.FileMode(parsed), nil
+}
+
+// validateTLS checks one listener's TLS settings, naming them by the keys
+// given.
+func validateTLS(tls *TLS, certKey, keyKey, minVersionKey, clientCAKey string) error {
+	if tls.CertFile == "" && tls.KeyFile == "" {
+		if tls.ClientCAFile != "" {
+			return fmt.Errorf("%s requires %s and %s", clientCAKey, certKey, keyKey)
+		}
+		return nil
+	}
+	if tls.CertFile == "" || tls.KeyFile == "" {
+		return fmt.Errorf("%s and %s must be set together", certKey, keyKey)
+	}
+	switch tls.MinVersion {
+	case TLSVersion12, TLSVersion13:
+	default:
+		return fmt.Errorf("%s must be %s or %s", minVersionKey, TLSVersion12, TLSVersion13)
+	}
+	return nil
+}
+
+func (c *Config) validateAuth() error {
+	auth := c.HTTP.Auth
+	if !auth.Enabled {
+		return nil
+	}
+	if auth.JWT.KeyFile != "" && auth.JWT.JWKSFile != "" {
+		return fmt.Errorf("only one of %s and %s may be set", HTTPAuthKeyFileKey, HTTPAuthJWKSFileKey)
+	}
+	if len(auth.APIKeys) == 0 && auth.JWT.KeyFile == "" && auth.JWT.JWKSFile == "" {
+		return fmt.Errorf("%s needs API keys, %s or %s", HTTPAuthEnabledKey, HTTPAuthKeyFileKey, HTTPAuthJWKSFileKey)
+	}
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for i, key := range auth.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("http.auth.api_keys[%d] must have a name", i)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("API key %q is declared more than once", key.Name)
+		}
+		names[key.Name] = true
+		if key.Key == "" {
+			return fmt.Errorf("API key %q must have a key", key.Name)
+		}
+		if keys[key.Key] {
+			return fmt.Errorf("API key %q has the same key as another", key.Name)
+		}
+		keys[key.Key] = true
+	}
+	return nil
+}
+
+func (c *Config) validateRules() error {
+	names := make(map[string]bool)
+	for i, rule := range c.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rules[%d] must have a name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q is declared more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		conditions := 0
+		if rule.VCPChange != nil {
+			conditions++
+		}
+		if rule.SAILS != nil {
+			conditions++
+			if rule.SAILS.MinCuts < 0 {
+				return fmt.Errorf("rule %q sails.min_cuts must not be negative", rule.Name)
+			}
+		}
+		if rule.Cadence != nil {
+			conditions++
+			if rule.Cadence.Above < 0 || rule.Cadence.Below < 0 || (rule.Cadence.Above == 0 && rule.Cadence.Below == 0) {
+				return fmt.Errorf("rule %q cadence needs a positive above or below", rule.Name)
+			}
+		}
+		if rule.Silence != nil {
+			conditions++
+			if rule.Silence.After <= 0 {
+				return fmt.Errorf("rule %q silence.after must be positive", rule.Name)
+			}
+		}
+		if conditions != 1 {
+			return fmt.Errorf("rule %q must have exactly one condition", rule.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateZones() error {
+	if len(c.Zones) > 0 && !c.Decoder.Enabled {
+		return fmt.Errorf("zones require %s", DecoderEnabledKey)
+	}
+	names := make(map[string]bool)
+	for i, zone := range c.Zones {
+		if zone.Name == "" {
+			return fmt.Errorf("zones[%d] must have a name", i)
+		}
+		if names[zone.Name] {
+			return fmt.Errorf("zone %q is declared more than once", zone.Name)
+		}
+		names[zone.Name] = true
+
+		if zone.Threshold <= 0 {
+			return fmt.Errorf("zone %q threshold must be positive", zone.Name)
+		}
+		if zone.Cooldown < 0 {
+			return fmt.Errorf("zone %q cooldown must not be negative", zone.Name)
+		}
+		switch {
+		case zone.Point != nil && zone.Polygon != nil:
+			return fmt.Errorf("zone %q must have a point or a polygon, not both", zone.Name)
+		case zone.Point != nil:
+			if !validCoordinate(zone.Point.Latitude, zone.Point.Longitude) {
+				return fmt.Errorf("zone %q point is not a valid latitude and longitude", zone.Name)
+			}
+			if zone.Point.Radius <= 0 {
+				return fmt.Errorf("zone %q point.radius must be positive", zone.Name)
+			}
+		case zone.Polygon != nil:
+			if len(zone.Polygon) < 3 {
+				return fmt.Errorf("zone %q polygon needs at least 3 vertices", zone.Name)
+			}
+			for _, vertex := range zone.Polygon {
+				if !validCoordinate(vertex[0], vertex[1]) {
+					return fmt.Errorf("zone %q polygon vertex %v is not a valid latitude and longitude", zone.Name, vertex)
+				}
+			}
+		default:
+			return fmt.Errorf("zone %q must have a point or a polygon", zone.Name)
+		}
+	}
 	return nil
 }
 
+func validCoordinate(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// removedKeys were replaced by the keys they map to. They are rejected
+// rather than ignored, which would quietly listen somewhere else.
+//
+//nolint:golint,gochecknoglobals
+var removedKeys = [][2]string{
+	{"http.ipv4_host", HTTPListenKey},
+	{"http.ipv6_host", HTTPListenKey},
+	{"http.port", HTTPListenKey},
+	{"http.metrics.ipv4_host", HTTPMetricsListenKey},
+	{"http.metrics.ipv6_host", HTTPMetricsListenKey},
+	{"http.metrics.port", HTTPMetricsListenKey},
+}
+
+// envName is the environment variable that sets the flag or key name.
+func envName(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ToUpper(name), "-", "_"), ".", "_")
+}
+
+// checkRemovedKeys fails on any of removedKeys in the environment, or in raw,
+// the decoded config file.
+func checkRemovedKeys(raw any) error {
+	for _, removed := range removedKeys {
+		_, inEnv := os.LookupEnv(envName(removed[0]))
+		if inEnv || hasKey(raw, removed[0]) {
+			return fmt.Errorf("%s has been removed, set %s instead", removed[0], removed[1])
+		}
+	}
+	return nil
+}
+
+func hasKey(raw any, key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return false
+		}
+		if raw, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func LoadConfig(cmd *cobra.Command) (*Config, error) {
 	var config Config
 
+	// Defaults for which zero is a meaningful setting have to be in place
+	// before the config file is decoded over them.
+	config.Downloader.Retries = DefaultDownloaderRetries
+	config.Downloader.Retention = Duration(DefaultDownloaderRetention)
+	config.ChunkCache.Prefetch = true
+	config.HTTP.Tracing.SampleRate = DefaultTracingSampleRate
+
 	// Load flags from envs
 	ctx, cancel := context.WithCancelCause(cmd.Context())
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
 		if ctx.Err() != nil {
 			return
 		}
-		optName := strings.ReplaceAll(strings.ReplaceAll(strings.ToUpper(f.Name), "-", "_"), ".", "_")
-		if val, ok := os.LookupEnv(optName); !f.Changed && ok {
+		if val, ok := os.LookupEnv(envName(f.Name)); !f.Changed && ok {
 			if err := f.Value.Set(val); err != nil {
 				cancel(err)
 			}
@@ -110,6 +970,9 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 	if ctx.Err() != nil {
 		return &config, fmt.Errorf("failed to load env: %w", context.Cause(ctx))
 	}
+	if err := checkRemovedKeys(nil); err != nil {
+		return &config, err
+	}
 
 	configPath, err := cmd.Flags().GetString("config")
 	if err != nil {
@@ -121,9 +984,24 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 			return &config, fmt.Errorf("failed to read config: %w", err)
 		}
 
-		if err := yaml.Unmarshal(data, &config); err != nil {
+		// yaml.v3 ignores json tags and does not inline embedded structs, so
+		// round-trip through JSON to honour the same keys as the flags.
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
 			return &config, fmt.Errorf("failed to unmarshal config: %w", err)
 		}
+		if err := checkRemovedKeys(raw); err != nil {
+			return &config, err
+		}
+		if raw != nil {
+			jsonData, err := json.Marshal(raw)
+			if err != nil {
+				return &config, fmt.Errorf("failed to convert config: %w", err)
+			}
+			if err := json.Unmarshal(jsonData, &config); err != nil {
+				return &config, fmt.Errorf("failed to unmarshal config: %w", err)
+			}
+		}
 	}
 
 	err = overrideFlags(&config, cmd)
@@ -132,23 +1010,108 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 	}
 
 	// Defaults
-	if config.HTTP.IPV4Host == "" {
-		config.HTTP.IPV4Host = DefaultHTTPIPV4Host
+	if config.HTTP.Listen == nil {
+		config.HTTP.Listen = []string{DefaultHTTPListen}
+	}
+	if config.HTTP.SocketMode == "" {
+		config.HTTP.SocketMode = DefaultSocketMode
+	}
+	if config.HTTP.Metrics.Listen == nil {
+		config.HTTP.Metrics.Listen = []string{DefaultHTTPMetricsListen}
+	}
+	if config.HTTP.Metrics.SocketMode == "" {
+		config.HTTP.Metrics.SocketMode = DefaultSocketMode
+	}
+	if config.HTTP.TLS.MinVersion == "" {
+		config.HTTP.TLS.MinVersion = DefaultTLSMinVersion
+	}
+	if config.HTTP.Metrics.TLS.MinVersion == "" {
+		config.HTTP.Metrics.TLS.MinVersion = DefaultTLSMinVersion
+	}
+	if config.HTTP.Limits.ConnectBurst == 0 {
+		config.HTTP.Limits.ConnectBurst = DefaultLimitsConnectBurst
+	}
+	if config.Ingest.Mode == "" {
+		config.Ingest.Mode = DefaultIngestMode
 	}
-	if config.HTTP.IPV6Host == "" {
-		config.HTTP.IPV6Host = DefaultHTTPIPV6Host
+	if config.Ingest.SNS.SigningCertHosts == nil {
+		config.Ingest.SNS.SigningCertHosts = []string{DefaultSNSSigningCertHost}
 	}
-	if config.HTTP.Port == 0 {
-		config.HTTP.Port = DefaultHTTPPort
+	if config.Ingest.Health.StaleAfter == 0 {
+		config.Ingest.Health.StaleAfter = Duration(DefaultHealthStaleAfter)
+	}
+	if config.Ingest.Health.ErrorThreshold == 0 {
+		config.Ingest.Health.ErrorThreshold = DefaultHealthErrors
+	}
+	if config.Ingest.Health.RestartAfter == 0 {
+		config.Ingest.Health.RestartAfter = Duration(DefaultHealthRestartAfter)
+	}
+	if config.Ingest.Health.VerifyInterval == 0 {
+		config.Ingest.Health.VerifyInterval = Duration(DefaultHealthVerify)
+	}
+	if config.Ingest.Canary.Interval == 0 {
+		config.Ingest.Canary.Interval = Duration(DefaultCanaryInterval)
+	}
+	if config.Ingest.Canary.Timeout == 0 {
+		config.Ingest.Canary.Timeout = Duration(DefaultCanaryTimeout)
+	}
+	if config.Downloader.Directory == "" {
+		config.Downloader.Directory = DefaultDownloaderDirectory
+	}
+	if config.Downloader.Concurrency == 0 {
+		config.Downloader.Concurrency = DefaultDownloaderConcur
+	}
+	if config.Assembler.Directory == "" {
+		config.Assembler.Directory = DefaultAssemblerDirectory
+	}
+	if config.Assembler.Timeout == 0 {
+		config.Assembler.Timeout = Duration(DefaultAssemblerTimeout)
+	}
+	if config.Decoder.Timeout == 0 {
+		config.Decoder.Timeout = Duration(DefaultDecoderTimeout)
+	}
+	if config.Imagery.Directory == "" {
+		config.Imagery.Directory = DefaultImageryDirectory
+	}
+	if config.Imagery.Size == 0 {
+		config.Imagery.Size = DefaultImagerySize
+	}
+	if config.Imagery.Range == 0 {
+		config.Imagery.Range = DefaultImageryRange
+	}
+	for _, rule := range config.Rules {
+		if rule.SAILS != nil && rule.SAILS.MinCuts == 0 {
+			rule.SAILS.MinCuts = 1
+		}
 	}
-	if config.HTTP.Metrics.IPV4Host == "" {
-		config.HTTP.Metrics.IPV4Host = DefaultHTTPMetricsIPV4Host
+	if config.HTTP.Tracing.Protocol == "" {
+		config.HTTP.Tracing.Protocol = DefaultTracingProtocol
 	}
-	if config.HTTP.Metrics.IPV6Host == "" {
-		config.HTTP.Metrics.IPV6Host = DefaultHTTPMetricsIPV6Host
+	if config.ChunkCache.Directory == "" {
+		config.ChunkCache.Directory = DefaultChunkCacheDirectory
 	}
-	if config.HTTP.Metrics.Port == 0 {
-		config.HTTP.Metrics.Port = DefaultHTTPMetricsPort
+	if config.ChunkCache.MaxSize == 0 {
+		config.ChunkCache.MaxSize = DefaultChunkCacheMaxSize
+	}
+	if config.Polling.Directory == "" {
+		config.Polling.Directory = DefaultPollingDirectory
+	}
+	if config.Polling.Volumes == 0 {
+		config.Polling.Volumes = DefaultPollingVolumes
+	}
+	if config.Correlator.Window == 0 {
+		config.Correlator.Window = Duration(DefaultCorrelatorWindow)
+	}
+	if config.Status.OfflineAfter == 0 {
+		config.Status.OfflineAfter = Duration(DefaultStatusOfflineAfter)
+	}
+	if config.Status.DegradedFactor == 0 {
+		config.Status.DegradedFactor = DefaultStatusDegraded
+	}
+	for i := range config.Zones {
+		if config.Zones[i].Cooldown == 0 {
+			config.Zones[i].Cooldown = Duration(DefaultZoneCooldown)
+		}
 	}
 
 	err = config.Validate()
@@ -161,24 +1124,46 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 
 func overrideFlags(config *Config, cmd *cobra.Command) error {
 	var err error
-	if cmd.Flags().Changed(HTTPIPV4HostKey) {
-		config.HTTP.IPV4Host, err = cmd.Flags().GetString(HTTPIPV4HostKey)
+	if cmd.Flags().Changed(HTTPListenKey) {
+		config.HTTP.Listen, err = cmd.Flags().GetStringSlice(HTTPListenKey)
+		if err != nil {
+			return fmt.Errorf("failed to get HTTP listen addresses: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPSocketModeKey) {
+		config.HTTP.SocketMode, err = cmd.Flags().GetString(HTTPSocketModeKey)
+		if err != nil {
+			return fmt.Errorf("failed to get HTTP socket mode: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPTLSCertKey) {
+		config.HTTP.TLS.CertFile, err = cmd.Flags().GetString(HTTPTLSCertKey)
 		if err != nil {
-			return fmt.Errorf("failed to get HTTP IPv4 host: %w", err)
+			return fmt.Errorf("failed to get TLS certificate: %w", err)
 		}
 	}
 
-	if cmd.Flags().Changed(HTTPIPV6HostKey) {
-		config.HTTP.IPV6Host, err = cmd.Flags().GetString(HTTPIPV6HostKey)
+	if cmd.Flags().Changed(HTTPTLSKeyKey) {
+		config.HTTP.TLS.KeyFile, err = cmd.Flags().GetString(HTTPTLSKeyKey)
 		if err != nil {
-			return fmt.Errorf("failed to get HTTP IPv6 host: %w", err)
+			return fmt.Errorf("failed to get TLS key: %w", err)
 		}
 	}
 
-	if cmd.Flags().Changed(HTTPPortKey) {
-		config.HTTP.Port, err = cmd.Flags().GetUint16(HTTPPortKey)
+	if cmd.Flags().Changed(HTTPTLSMinVersionKey) {
+		version, err := cmd.Flags().GetString(HTTPTLSMinVersionKey)
 		if err != nil {
-			return fmt.Errorf("failed to get HTTP port: %w", err)
+			return fmt.Errorf("failed to get TLS minimum version: %w", err)
+		}
+		config.HTTP.TLS.MinVersion = TLSVersion(version)
+	}
+
+	if cmd.Flags().Changed(HTTPTLSClientCAKey) {
+		config.HTTP.TLS.ClientCAFile, err = cmd.Flags().GetString(HTTPTLSClientCAKey)
+		if err != nil {
+			return fmt.Errorf("failed to get TLS client CA: %w", err)
 		}
 	}
 
@@ -196,6 +1181,13 @@ func overrideFlags(config *Config, cmd *cobra.Command) error {
 		}
 	}
 
+	if cmd.Flags().Changed(HTTPTrustedPlatformKey) {
+		config.HTTP.TrustedPlatform, err = cmd.Flags().GetString(HTTPTrustedPlatformKey)
+		if err != nil {
+			return fmt.Errorf("failed to get trusted platform: %w", err)
+		}
+	}
+
 	if cmd.Flags().Changed(HTTPMetricsEnabledKey) {
 		config.HTTP.Metrics.Enabled, err = cmd.Flags().GetBool(HTTPMetricsEnabledKey)
 		if err != nil {
@@ -203,24 +1195,46 @@ func overrideFlags(config *Config, cmd *cobra.Command) error {
 		}
 	}
 
-	if cmd.Flags().Changed(HTTPMetricsIPV4HostKey) {
-		config.HTTP.Metrics.IPV4Host, err = cmd.Flags().GetString(HTTPMetricsIPV4HostKey)
+	if cmd.Flags().Changed(HTTPMetricsListenKey) {
+		config.HTTP.Metrics.Listen, err = cmd.Flags().GetStringSlice(HTTPMetricsListenKey)
+		if err != nil {
+			return fmt.Errorf("failed to get metrics listen addresses: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPMetricsSocketKey) {
+		config.HTTP.Metrics.SocketMode, err = cmd.Flags().GetString(HTTPMetricsSocketKey)
+		if err != nil {
+			return fmt.Errorf("failed to get metrics socket mode: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPMetricsTLSCertKey) {
+		config.HTTP.Metrics.TLS.CertFile, err = cmd.Flags().GetString(HTTPMetricsTLSCertKey)
 		if err != nil {
-			return fmt.Errorf("failed to get metrics IPv4 host: %w", err)
+			return fmt.Errorf("failed to get metrics TLS certificate: %w", err)
 		}
 	}
 
-	if cmd.Flags().Changed(HTTPMetricsIPV6HostKey) {
-		config.HTTP.Metrics.IPV6Host, err = cmd.Flags().GetString(HTTPMetricsIPV6HostKey)
+	if cmd.Flags().Changed(HTTPMetricsTLSKeyKey) {
+		config.HTTP.Metrics.TLS.KeyFile, err = cmd.Flags().GetString(HTTPMetricsTLSKeyKey)
 		if err != nil {
-			return fmt.Errorf("failed to get metrics IPv6 host: %w", err)
+			return fmt.Errorf("failed to get metrics TLS key: %w", err)
 		}
 	}
 
-	if cmd.Flags().Changed(HTTPMetricsPortKey) {
-		config.HTTP.Metrics.Port, err = cmd.Flags().GetUint16(HTTPMetricsPortKey)
+	if cmd.Flags().Changed(HTTPMetricsTLSMinKey) {
+		version, err := cmd.Flags().GetString(HTTPMetricsTLSMinKey)
 		if err != nil {
-			return fmt.Errorf("failed to get metrics port: %w", err)
+			return fmt.Errorf("failed to get metrics TLS minimum version: %w", err)
+		}
+		config.HTTP.Metrics.TLS.MinVersion = TLSVersion(version)
+	}
+
+	if cmd.Flags().Changed(HTTPMetricsTLSCAKey) {
+		config.HTTP.Metrics.TLS.ClientCAFile, err = cmd.Flags().GetString(HTTPMetricsTLSCAKey)
+		if err != nil {
+			return fmt.Errorf("failed to get metrics TLS client CA: %w", err)
 		}
 	}
 
@@ -238,6 +1252,21 @@ func overrideFlags(config *Config, cmd *cobra.Command) error {
 		}
 	}
 
+	if cmd.Flags().Changed(HTTPTracingProtocolKey) {
+		protocol, err := cmd.Flags().GetString(HTTPTracingProtocolKey)
+		if err != nil {
+			return fmt.Errorf("failed to get tracing protocol: %w", err)
+		}
+		config.HTTP.Tracing.Protocol = TracingProtocol(protocol)
+	}
+
+	if cmd.Flags().Changed(HTTPTracingSampleKey) {
+		config.HTTP.Tracing.SampleRate, err = cmd.Flags().GetFloat64(HTTPTracingSampleKey)
+		if err != nil {
+			return fmt.Errorf("failed to get tracing sample rate: %w", err)
+		}
+	}
+
 	if cmd.Flags().Changed(HTTPCORSHostsKey) {
 		config.HTTP.CORSHosts, err = cmd.Flags().GetStringSlice(HTTPCORSHostsKey)
 		if err != nil {
@@ -245,5 +1274,366 @@ func overrideFlags(config *Config, cmd *cobra.Command) error {
 		}
 	}
 
+	if cmd.Flags().Changed(HTTPAuthEnabledKey) {
+		config.HTTP.Auth.Enabled, err = cmd.Flags().GetBool(HTTPAuthEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get auth enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPAuthKeyFileKey) {
+		config.HTTP.Auth.JWT.KeyFile, err = cmd.Flags().GetString(HTTPAuthKeyFileKey)
+		if err != nil {
+			return fmt.Errorf("failed to get JWT key file: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPAuthJWKSFileKey) {
+		config.HTTP.Auth.JWT.JWKSFile, err = cmd.Flags().GetString(HTTPAuthJWKSFileKey)
+		if err != nil {
+			return fmt.Errorf("failed to get JWKS file: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPAuthIssuerKey) {
+		config.HTTP.Auth.JWT.Issuer, err = cmd.Flags().GetString(HTTPAuthIssuerKey)
+		if err != nil {
+			return fmt.Errorf("failed to get JWT issuer: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPAuthAudienceKey) {
+		config.HTTP.Auth.JWT.Audience, err = cmd.Flags().GetString(HTTPAuthAudienceKey)
+		if err != nil {
+			return fmt.Errorf("failed to get JWT audience: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPLimitsMaxConnsKey) {
+		config.HTTP.Limits.MaxConnections, err = cmd.Flags().GetUint(HTTPLimitsMaxConnsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get connection limit: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPLimitsPerIPKey) {
+		config.HTTP.Limits.MaxConnectionsPerIP, err = cmd.Flags().GetUint(HTTPLimitsPerIPKey)
+		if err != nil {
+			return fmt.Errorf("failed to get per-IP connection limit: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPLimitsPerKeyKey) {
+		config.HTTP.Limits.MaxSubscriptionsPerKey, err = cmd.Flags().GetUint(HTTPLimitsPerKeyKey)
+		if err != nil {
+			return fmt.Errorf("failed to get per-key subscription limit: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPLimitsRateKey) {
+		config.HTTP.Limits.ConnectRate, err = cmd.Flags().GetFloat64(HTTPLimitsRateKey)
+		if err != nil {
+			return fmt.Errorf("failed to get connect rate: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(HTTPLimitsBurstKey) {
+		config.HTTP.Limits.ConnectBurst, err = cmd.Flags().GetUint(HTTPLimitsBurstKey)
+		if err != nil {
+			return fmt.Errorf("failed to get connect burst: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(IngestModeKey) {
+		mode, err := cmd.Flags().GetString(IngestModeKey)
+		if err != nil {
+			return fmt.Errorf("failed to get ingest mode: %w", err)
+		}
+		config.Ingest.Mode = IngestMode(mode)
+	}
+
+	if cmd.Flags().Changed(IngestSNSEndpointKey) {
+		config.Ingest.SNS.EndpointURL, err = cmd.Flags().GetString(IngestSNSEndpointKey)
+		if err != nil {
+			return fmt.Errorf("failed to get SNS endpoint URL: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(IngestSNSCertHostsKey) {
+		config.Ingest.SNS.SigningCertHosts, err = cmd.Flags().GetStringSlice(IngestSNSCertHostsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get SNS signing certificate hosts: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(S3EndpointKey) {
+		config.S3.Endpoint, err = cmd.Flags().GetString(S3EndpointKey)
+		if err != nil {
+			return fmt.Errorf("failed to get S3 endpoint: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderEnabledKey) {
+		config.Downloader.Enabled, err = cmd.Flags().GetBool(DownloaderEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderDirectoryKey) {
+		config.Downloader.Directory, err = cmd.Flags().GetString(DownloaderDirectoryKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader directory: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderStationsKey) {
+		config.Downloader.Stations, err = cmd.Flags().GetStringSlice(DownloaderStationsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader stations: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderConcurKey) {
+		config.Downloader.Concurrency, err = cmd.Flags().GetUint(DownloaderConcurKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader concurrency: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderRetriesKey) {
+		config.Downloader.Retries, err = cmd.Flags().GetUint(DownloaderRetriesKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader retries: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DownloaderRetentionKey) {
+		retention, err := cmd.Flags().GetDuration(DownloaderRetentionKey)
+		if err != nil {
+			return fmt.Errorf("failed to get downloader retention: %w", err)
+		}
+		config.Downloader.Retention = Duration(retention)
+	}
+
+	if cmd.Flags().Changed(AssemblerEnabledKey) {
+		config.Assembler.Enabled, err = cmd.Flags().GetBool(AssemblerEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get assembler enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(AssemblerDirectoryKey) {
+		config.Assembler.Directory, err = cmd.Flags().GetString(AssemblerDirectoryKey)
+		if err != nil {
+			return fmt.Errorf("failed to get assembler directory: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(AssemblerStationsKey) {
+		config.Assembler.Stations, err = cmd.Flags().GetStringSlice(AssemblerStationsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get assembler stations: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(AssemblerTimeoutKey) {
+		timeout, err := cmd.Flags().GetDuration(AssemblerTimeoutKey)
+		if err != nil {
+			return fmt.Errorf("failed to get assembler timeout: %w", err)
+		}
+		config.Assembler.Timeout = Duration(timeout)
+	}
+
+	if cmd.Flags().Changed(DecoderEnabledKey) {
+		config.Decoder.Enabled, err = cmd.Flags().GetBool(DecoderEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get decoder enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(DecoderTimeoutKey) {
+		timeout, err := cmd.Flags().GetDuration(DecoderTimeoutKey)
+		if err != nil {
+			return fmt.Errorf("failed to get decoder timeout: %w", err)
+		}
+		config.Decoder.Timeout = Duration(timeout)
+	}
+
+	if cmd.Flags().Changed(ImageryEnabledKey) {
+		config.Imagery.Enabled, err = cmd.Flags().GetBool(ImageryEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get imagery enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ImageryDirectoryKey) {
+		config.Imagery.Directory, err = cmd.Flags().GetString(ImageryDirectoryKey)
+		if err != nil {
+			return fmt.Errorf("failed to get imagery directory: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ImageryStationsKey) {
+		config.Imagery.Stations, err = cmd.Flags().GetStringSlice(ImageryStationsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get imagery stations: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ImagerySizeKey) {
+		config.Imagery.Size, err = cmd.Flags().GetUint(ImagerySizeKey)
+		if err != nil {
+			return fmt.Errorf("failed to get imagery size: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ImageryRangeKey) {
+		config.Imagery.Range, err = cmd.Flags().GetFloat64(ImageryRangeKey)
+		if err != nil {
+			return fmt.Errorf("failed to get imagery range: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(IngestHealthStaleKey) {
+		staleAfter, err := cmd.Flags().GetDuration(IngestHealthStaleKey)
+		if err != nil {
+			return fmt.Errorf("failed to get health stale after: %w", err)
+		}
+		config.Ingest.Health.StaleAfter = Duration(staleAfter)
+	}
+
+	if cmd.Flags().Changed(IngestHealthErrorsKey) {
+		config.Ingest.Health.ErrorThreshold, err = cmd.Flags().GetUint(IngestHealthErrorsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get health error threshold: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(IngestHealthRestartKey) {
+		restartAfter, err := cmd.Flags().GetDuration(IngestHealthRestartKey)
+		if err != nil {
+			return fmt.Errorf("failed to get health restart after: %w", err)
+		}
+		config.Ingest.Health.RestartAfter = Duration(restartAfter)
+	}
+
+	if cmd.Flags().Changed(IngestHealthVerifyKey) {
+		verifyInterval, err := cmd.Flags().GetDuration(IngestHealthVerifyKey)
+		if err != nil {
+			return fmt.Errorf("failed to get health verify interval: %w", err)
+		}
+		config.Ingest.Health.VerifyInterval = Duration(verifyInterval)
+	}
+
+	if cmd.Flags().Changed(IngestCanaryEnabledKey) {
+		config.Ingest.Canary.Enabled, err = cmd.Flags().GetBool(IngestCanaryEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get canary enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(IngestCanaryIntervalKey) {
+		interval, err := cmd.Flags().GetDuration(IngestCanaryIntervalKey)
+		if err != nil {
+			return fmt.Errorf("failed to get canary interval: %w", err)
+		}
+		config.Ingest.Canary.Interval = Duration(interval)
+	}
+
+	if cmd.Flags().Changed(IngestCanaryTimeoutKey) {
+		timeout, err := cmd.Flags().GetDuration(IngestCanaryTimeoutKey)
+		if err != nil {
+			return fmt.Errorf("failed to get canary timeout: %w", err)
+		}
+		config.Ingest.Canary.Timeout = Duration(timeout)
+	}
+
+	if cmd.Flags().Changed(StatusOfflineAfterKey) {
+		offlineAfter, err := cmd.Flags().GetDuration(StatusOfflineAfterKey)
+		if err != nil {
+			return fmt.Errorf("failed to get status offline after: %w", err)
+		}
+		config.Status.OfflineAfter = Duration(offlineAfter)
+	}
+
+	if cmd.Flags().Changed(StatusDegradedKey) {
+		config.Status.DegradedFactor, err = cmd.Flags().GetFloat64(StatusDegradedKey)
+		if err != nil {
+			return fmt.Errorf("failed to get status degraded factor: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(CorrelatorEnabledKey) {
+		config.Correlator.Enabled, err = cmd.Flags().GetBool(CorrelatorEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get correlator enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(CorrelatorWindowKey) {
+		window, err := cmd.Flags().GetDuration(CorrelatorWindowKey)
+		if err != nil {
+			return fmt.Errorf("failed to get correlator window: %w", err)
+		}
+		config.Correlator.Window = Duration(window)
+	}
+
+	if cmd.Flags().Changed(ChunkCacheEnabledKey) {
+		config.ChunkCache.Enabled, err = cmd.Flags().GetBool(ChunkCacheEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get chunk cache enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ChunkCacheDirectoryKey) {
+		config.ChunkCache.Directory, err = cmd.Flags().GetString(ChunkCacheDirectoryKey)
+		if err != nil {
+			return fmt.Errorf("failed to get chunk cache directory: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ChunkCacheMaxSizeKey) {
+		config.ChunkCache.MaxSize, err = cmd.Flags().GetUint(ChunkCacheMaxSizeKey)
+		if err != nil {
+			return fmt.Errorf("failed to get chunk cache max size: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(ChunkCachePrefetchKey) {
+		config.ChunkCache.Prefetch, err = cmd.Flags().GetBool(ChunkCachePrefetchKey)
+		if err != nil {
+			return fmt.Errorf("failed to get chunk cache prefetch: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(PollingEnabledKey) {
+		config.Polling.Enabled, err = cmd.Flags().GetBool(PollingEnabledKey)
+		if err != nil {
+			return fmt.Errorf("failed to get polling enabled: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(PollingDirectoryKey) {
+		config.Polling.Directory, err = cmd.Flags().GetString(PollingDirectoryKey)
+		if err != nil {
+			return fmt.Errorf("failed to get polling directory: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(PollingStationsKey) {
+		config.Polling.Stations, err = cmd.Flags().GetStringSlice(PollingStationsKey)
+		if err != nil {
+			return fmt.Errorf("failed to get polling stations: %w", err)
+		}
+	}
+
+	if cmd.Flags().Changed(PollingVolumesKey) {
+		config.Polling.Volumes, err = cmd.Flags().GetUint(PollingVolumesKey)
+		if err != nil {
+			return fmt.Errorf("failed to get polling volumes: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -1,16 +1,23 @@
 package config_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/USA-RedDragon/nexrad-aws-notifier/cmd"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/spf13/cobra"
 )
 
 func TestExampleConfig(t *testing.T) {
 	t.Parallel()
 	baseCmd := cmd.NewCommand("testing", "deadbeef")
 	// Avoid port conflict
-	baseCmd.SetArgs([]string{"--config", "../../config.example.yaml", "--http.port", "8083", "--http.metrics.port", "8084"})
+	baseCmd.SetArgs([]string{"--config", "../../config.example.yaml", "--http.listen", ":8083", "--http.metrics.listen", "127.0.0.1:8084"})
 	err := baseCmd.Execute()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -21,7 +28,7 @@ func TestTracing(t *testing.T) {
 	t.Parallel()
 	baseCmd := cmd.NewCommand("testing", "deadbeef")
 	// Avoid port conflict
-	baseCmd.SetArgs([]string{"--http.port", "8085", "--http.metrics.port", "8086", "--http.tracing.enabled", "true"})
+	baseCmd.SetArgs([]string{"--http.listen", ":8085", "--http.metrics.listen", "127.0.0.1:8086", "--http.tracing.enabled", "true"})
 	err := baseCmd.Execute()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -29,11 +36,290 @@ func TestTracing(t *testing.T) {
 }
 
 func TestEnvConfig(t *testing.T) {
-	t.Setenv("HTTP_PORT", "8087")
-	t.Setenv("HTTP_METRICS_PORT", "8088")
+	t.Setenv("HTTP_LISTEN", ":8087")
+	t.Setenv("HTTP_METRICS_LISTEN", "127.0.0.1:8088")
 	baseCmd := cmd.NewCommand("testing", "deadbeef")
 	err := baseCmd.Execute()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestValidateRules(t *testing.T) {
+	t.Parallel()
+	minute := config.Duration(time.Minute)
+	tests := []struct {
+		name  string
+		rules []config.Rule
+		valid bool
+	}{
+		{"vcp change", []config.Rule{{Name: "precip", VCPChange: &config.VCPChangeCondition{From: []int{35}, To: []int{212}}}}, true},
+		{"silence", []config.Rule{{Name: "quiet", Silence: &config.SilenceCondition{After: minute}}}, true},
+		{"no name", []config.Rule{{Silence: &config.SilenceCondition{After: minute}}}, false},
+		{"duplicate name", []config.Rule{
+			{Name: "quiet", Silence: &config.SilenceCondition{After: minute}},
+			{Name: "quiet", SAILS: &config.SAILSCondition{}},
+		}, false},
+		{"no condition", []config.Rule{{Name: "empty"}}, false},
+		{"two conditions", []config.Rule{{Name: "both", SAILS: &config.SAILSCondition{}, Silence: &config.SilenceCondition{After: minute}}}, false},
+		{"unbounded cadence", []config.Rule{{Name: "cadence", Cadence: &config.CadenceCondition{}}}, false},
+		{"zero silence", []config.Rule{{Name: "quiet", Silence: &config.SilenceCondition{}}}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{Rules: tt.rules}
+		c.Ingest.Mode = config.IngestModeSQS
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateZones(t *testing.T) {
+	t.Parallel()
+	stadium := &config.ZonePoint{Latitude: 35.2, Longitude: -97.44, Radius: 20}
+	tests := []struct {
+		name  string
+		zones []config.Zone
+		valid bool
+	}{
+		{"point", []config.Zone{{Name: "stadium", Threshold: 50, Point: stadium}}, true},
+		{"polygon", []config.Zone{{Name: "fair", Threshold: 45, Polygon: [][2]float64{{35, -97.5}, {35.1, -97.5}, {35.1, -97.4}}}}, true},
+		{"no shape", []config.Zone{{Name: "stadium", Threshold: 50}}, false},
+		{"both shapes", []config.Zone{{Name: "stadium", Threshold: 50, Point: stadium, Polygon: [][2]float64{{35, -97.5}, {35.1, -97.5}, {35.1, -97.4}}}}, false},
+		{"no threshold", []config.Zone{{Name: "stadium", Point: stadium}}, false},
+		{"no radius", []config.Zone{{Name: "stadium", Threshold: 50, Point: &config.ZonePoint{Latitude: 35.2, Longitude: -97.44}}}, false},
+		{"line", []config.Zone{{Name: "fair", Threshold: 45, Polygon: [][2]float64{{35, -97.5}, {35.1, -97.5}}}}, false},
+		{"swapped coordinates", []config.Zone{{Name: "fair", Threshold: 45, Polygon: [][2]float64{{-97.5, 35}, {-97.5, 35.1}, {-97.4, 35.1}}}}, false},
+		{"duplicate name", []config.Zone{
+			{Name: "stadium", Threshold: 50, Point: stadium},
+			{Name: "stadium", Threshold: 40, Point: stadium},
+		}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{Zones: tt.zones}
+		c.Ingest.Mode = config.IngestModeSQS
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		c.Decoder.Enabled = true
+		c.Decoder.Timeout = config.Duration(time.Second)
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidatePolling(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		polling   config.Polling
+		assembler config.Assembler
+		valid     bool
+	}{
+		{"enabled", config.Polling{Enabled: true, Stations: []string{"KTLX"}, Volumes: 12}, config.Assembler{Enabled: true, Timeout: config.Duration(time.Minute)}, true},
+		{"assembled station", config.Polling{Enabled: true, Stations: []string{"ktlx"}, Volumes: 12}, config.Assembler{Enabled: true, Stations: []string{"KTLX"}, Timeout: config.Duration(time.Minute)}, true},
+		{"station not assembled", config.Polling{Enabled: true, Stations: []string{"KFWS"}, Volumes: 12}, config.Assembler{Enabled: true, Stations: []string{"KTLX"}, Timeout: config.Duration(time.Minute)}, false},
+		{"no assembler", config.Polling{Enabled: true, Stations: []string{"KTLX"}, Volumes: 12}, config.Assembler{}, false},
+		{"no stations", config.Polling{Enabled: true, Volumes: 12}, config.Assembler{Enabled: true, Timeout: config.Duration(time.Minute)}, false},
+		{"no volumes", config.Polling{Enabled: true, Stations: []string{"KTLX"}}, config.Assembler{Enabled: true, Timeout: config.Duration(time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{Polling: tt.polling, Assembler: tt.assembler}
+		c.Ingest.Mode = config.IngestModeSQS
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateTracing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		tracing config.Tracing
+		valid   bool
+	}{
+		{"grpc", config.Tracing{Enabled: true, Protocol: config.TracingProtocolGRPC, SampleRate: 1}, true},
+		{"http", config.Tracing{Enabled: true, Protocol: config.TracingProtocolHTTP, SampleRate: 0.1}, true},
+		{"sampling off", config.Tracing{Enabled: true, Protocol: config.TracingProtocolGRPC}, true},
+		{"unknown protocol", config.Tracing{Enabled: true, Protocol: "thrift", SampleRate: 1}, false},
+		{"rate above one", config.Tracing{Enabled: true, Protocol: config.TracingProtocolGRPC, SampleRate: 2}, false},
+		{"negative rate", config.Tracing{Enabled: true, Protocol: config.TracingProtocolGRPC, SampleRate: -0.5}, false},
+		{"disabled", config.Tracing{Protocol: "thrift"}, true},
+	}
+	for _, tt := range tests {
+		c := config.Config{}
+		c.HTTP.Tracing = tt.tracing
+		c.Ingest.Mode = config.IngestModeSQS
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		auth  config.Auth
+		valid bool
+	}{
+		{"disabled", config.Auth{}, true},
+		{"api keys", config.Auth{Enabled: true, APIKeys: []config.APIKey{{Name: "a", Key: "1"}, {Name: "b", Key: "2"}}}, true},
+		{"key file", config.Auth{Enabled: true, JWT: config.JWT{KeyFile: "/etc/notifier/jwt.pem"}}, true},
+		{"jwks file", config.Auth{Enabled: true, JWT: config.JWT{JWKSFile: "/etc/notifier/jwks.json"}}, true},
+		{"nothing to check", config.Auth{Enabled: true}, false},
+		{"both key files", config.Auth{Enabled: true, JWT: config.JWT{KeyFile: "/etc/notifier/jwt.pem", JWKSFile: "/etc/notifier/jwks.json"}}, false},
+		{"unnamed key", config.Auth{Enabled: true, APIKeys: []config.APIKey{{Key: "1"}}}, false},
+		{"empty key", config.Auth{Enabled: true, APIKeys: []config.APIKey{{Name: "a"}}}, false},
+		{"duplicate name", config.Auth{Enabled: true, APIKeys: []config.APIKey{{Name: "a", Key: "1"}, {Name: "a", Key: "2"}}}, false},
+		{"duplicate key", config.Auth{Enabled: true, APIKeys: []config.APIKey{{Name: "a", Key: "1"}, {Name: "b", Key: "1"}}}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{}
+		c.HTTP.Auth = tt.auth
+		c.Ingest.Mode = config.IngestModeHTTP
+		c.Ingest.SNS = config.SNS{EndpointURL: "https://notifier.example.com/api/sns", SigningCertHosts: []string{config.DefaultSNSSigningCertHost}}
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		limits config.Limits
+		valid  bool
+	}{
+		{"none", config.Limits{}, true},
+		{"rate", config.Limits{ConnectRate: 0.5, ConnectBurst: 5}, true},
+		{"negative rate", config.Limits{ConnectRate: -1, ConnectBurst: 5}, false},
+		{"no burst", config.Limits{ConnectRate: 1}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{}
+		c.HTTP.Limits = tt.limits
+		c.Ingest.Mode = config.IngestModeHTTP
+		c.Ingest.SNS = config.SNS{EndpointURL: "https://notifier.example.com/api/sns", SigningCertHosts: []string{config.DefaultSNSSigningCertHost}}
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		tls   config.TLS
+		valid bool
+	}{
+		{"off", config.TLS{}, true},
+		{"on", config.TLS{CertFile: "tls.crt", KeyFile: "tls.key", MinVersion: config.TLSVersion12}, true},
+		{"mutual", config.TLS{CertFile: "tls.crt", KeyFile: "tls.key", MinVersion: config.TLSVersion13, ClientCAFile: "ca.crt"}, true},
+		{"no key", config.TLS{CertFile: "tls.crt", MinVersion: config.TLSVersion12}, false},
+		{"client CA alone", config.TLS{ClientCAFile: "ca.crt"}, false},
+		{"old version", config.TLS{CertFile: "tls.crt", KeyFile: "tls.key", MinVersion: "1.0"}, false},
+	}
+	for _, tt := range tests {
+		for _, listener := range []string{"api", "metrics"} {
+			c := config.Config{}
+			if listener == "api" {
+				c.HTTP.TLS = tt.tls
+			} else {
+				c.HTTP.Metrics.TLS = tt.tls
+			}
+			c.Ingest.Mode = config.IngestModeHTTP
+			c.Ingest.SNS = config.SNS{EndpointURL: "https://notifier.example.com/api/sns", SigningCertHosts: []string{config.DefaultSNSSigningCertHost}}
+			c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+			if err := c.Validate(); (err == nil) != tt.valid {
+				t.Errorf("%s %s: Validate() = %v, want valid %t", listener, tt.name, err, tt.valid)
+			}
+		}
+	}
+}
+
+func TestValidateListen(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		listener config.HTTPListener
+		valid    bool
+	}{
+		{"default", config.HTTPListener{}, true},
+		{"mixed", config.HTTPListener{Listen: []string{":8080", "[::1]:8080", "unix:/run/notifier.sock", "systemd:", "systemd:api"}, SocketMode: "0660"}, true},
+		{"empty", config.HTTPListener{Listen: []string{}}, false},
+		{"no port", config.HTTPListener{Listen: []string{"0.0.0.0"}}, false},
+		{"no socket path", config.HTTPListener{Listen: []string{"unix:"}}, false},
+		{"bad mode", config.HTTPListener{Listen: []string{"unix:/run/notifier.sock"}, SocketMode: "rw-rw----"}, false},
+		{"mode too wide", config.HTTPListener{Listen: []string{"unix:/run/notifier.sock"}, SocketMode: "4777"}, false},
+	}
+	for _, tt := range tests {
+		c := config.Config{}
+		c.HTTP.HTTPListener = tt.listener
+		c.Ingest.Mode = config.IngestModeHTTP
+		c.Ingest.SNS = config.SNS{EndpointURL: "https://notifier.example.com/api/sns", SigningCertHosts: []string{config.DefaultSNSSigningCertHost}}
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateCanary(t *testing.T) {
+	t.Parallel()
+	enabled := config.Canary{Enabled: true, Interval: config.Duration(time.Minute), Timeout: config.Duration(30 * time.Second)}
+	tests := []struct {
+		name   string
+		mode   config.IngestMode
+		canary config.Canary
+		valid  bool
+	}{
+		{"sqs", config.IngestModeSQS, enabled, true},
+		{"http", config.IngestModeHTTP, enabled, false},
+		{"no interval", config.IngestModeSQS, config.Canary{Enabled: true, Timeout: enabled.Timeout}, false},
+		{"no timeout", config.IngestModeSQS, config.Canary{Enabled: true, Interval: enabled.Interval}, false},
+		{"disabled", config.IngestModeHTTP, config.Canary{}, true},
+	}
+	for _, tt := range tests {
+		c := config.Config{}
+		c.Ingest.Mode = tt.mode
+		c.Ingest.SNS = config.SNS{EndpointURL: "https://notifier.example.com/api/sns", SigningCertHosts: []string{config.DefaultSNSSigningCertHost}}
+		c.Ingest.Canary = tt.canary
+		c.Status = config.Status{OfflineAfter: config.Duration(time.Hour), DegradedFactor: 2}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestLoadConfigRejectsRemovedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("http:\n  metrics:\n    port: 9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	load := func(args ...string) error {
+		cmd := &cobra.Command{}
+		cmd.SetContext(context.Background())
+		config.RegisterFlags(cmd)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		_, err := config.LoadConfig(cmd)
+		return err
+	}
+
+	if err := load("--config", path); err == nil || !strings.Contains(err.Error(), config.HTTPMetricsListenKey) {
+		t.Errorf("LoadConfig() with http.metrics.port in the file = %v, want an error naming %s", err, config.HTTPMetricsListenKey)
+	}
+	t.Setenv("HTTP_PORT", "8080")
+	if err := load(); err == nil || !strings.Contains(err.Error(), config.HTTPListenKey) {
+		t.Errorf("LoadConfig() with HTTP_PORT set = %v, want an error naming %s", err, config.HTTPListenKey)
+	}
+}
@@ -0,0 +1,188 @@
+package correlator
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+)
+
+// queueSize bounds results waiting to be published. Beyond it they are
+// dropped rather than stalling the event bus.
+const queueSize = 64
+
+// Feeds reports which NOAA feeds are being received for a station.
+type Feeds interface {
+	ListeningChunk(station string) bool
+	ListeningArchive(station string) bool
+}
+
+type volumeKey struct {
+	station string
+	start   time.Time
+}
+
+// volume is what each feed has carried of one volume.
+type volume struct {
+	number     int
+	chunks     int
+	firstChunk time.Time
+	lastChunk  time.Time
+	archive    *events.NexradArchiveEvent
+	archived   time.Time
+	// seen is when either feed first carried the volume, which starts the
+	// window for the other.
+	seen time.Time
+	// matched is set once the volume has been announced as matched. It is
+	// kept until the window ends so stragglers do not start a new volume.
+	matched bool
+}
+
+// Correlator matches volumes on the real-time chunk feed to their files in
+// the archive bucket by station and volume start time, and announces each
+// with a VolumeArchivedEvent.
+type Correlator struct {
+	window  time.Duration
+	feeds   Feeds
+	publish chan<- events.Event
+	pending chan events.Event
+	// volumes is only touched by handle and expire.
+	volumes map[volumeKey]*volume
+
+	consumer *events.Consumer
+}
+
+// NewCorrelator starts matching the chunks and archive files announced on
+// eventsChannel and publishes the results to publish.
+func NewCorrelator(config *config.Correlator, feeds Feeds, eventsChannel <-chan events.Event, publish chan<- events.Event) *Correlator {
+	c := &Correlator{
+		window:   time.Duration(config.Window),
+		feeds:    feeds,
+		publish:  publish,
+		pending:  make(chan events.Event, queueSize),
+		volumes:  make(map[volumeKey]*volume),
+		consumer: events.NewConsumer(),
+	}
+	c.consumer.Go(c.send)
+	c.consumer.ConsumeTicking(eventsChannel, func(event events.Event) {
+		c.handle(event, time.Now())
+	}, max(c.window/10, time.Second), c.expire)
+	return c
+}
+
+// Stop discards results that have not been published yet.
+func (c *Correlator) Stop() error {
+	c.consumer.Stop()
+	return nil
+}
+
+func (c *Correlator) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-c.pending:
+			c.publish <- event
+		}
+	}
+}
+
+func (c *Correlator) volume(station string, start time.Time, now time.Time) *volume {
+	key := volumeKey{station: station, start: start.UTC()}
+	v, ok := c.volumes[key]
+	if !ok {
+		v = &volume{seen: now}
+		c.volumes[key] = v
+	}
+	return v
+}
+
+func (c *Correlator) handle(event events.Event, now time.Time) {
+	switch ev := event.(type) {
+	case events.NexradChunkEvent:
+		if ev.VolumeStart.IsZero() {
+			return
+		}
+		station := strings.ToUpper(ev.Station)
+		v := c.volume(station, ev.VolumeStart, now)
+		if v.chunks == 0 {
+			v.firstChunk = now
+		}
+		v.number = ev.VolumeNumber
+		v.chunks++
+		v.lastChunk = now
+		c.match(station, ev.VolumeStart, v)
+	case events.NexradArchiveEvent:
+		// The metadata file shares the volume's scan time.
+		if ev.Kind != nexrad.ArchiveKindVolume {
+			return
+		}
+		station := strings.ToUpper(ev.Station)
+		v := c.volume(station, ev.ScanTime, now)
+		v.archive = &ev
+		v.archived = now
+		c.match(station, ev.ScanTime, v)
+	}
+}
+
+func (c *Correlator) match(station string, start time.Time, v *volume) {
+	if v.matched || v.chunks == 0 || v.archive == nil {
+		return
+	}
+	v.matched = true
+	event := result(station, start, v, events.VolumeMatched)
+	event.Lag = v.archived.Sub(v.lastChunk).Truncate(time.Second).String()
+	slog.Info("Volume archived", "station", station, "volume", v.number, "start", start, "lag", event.Lag)
+	c.enqueue(event)
+}
+
+// expire reports the volumes whose window has ended with only one feed. A
+// volume missing from a feed that was not being received for the station
+// says nothing about that feed, so it is dropped quietly.
+func (c *Correlator) expire(now time.Time) {
+	for key, v := range c.volumes {
+		if now.Sub(v.seen) <= c.window {
+			continue
+		}
+		delete(c.volumes, key)
+		switch {
+		case v.matched:
+		case v.archive == nil && c.feeds.ListeningArchive(key.station):
+			slog.Warn("Volume never archived", "station", key.station, "volume", v.number, "start", key.start)
+			c.enqueue(result(key.station, key.start, v, events.VolumeChunkOnly))
+		case v.chunks == 0 && c.feeds.ListeningChunk(key.station):
+			slog.Warn("Archived volume never seen in chunks", "station", key.station, "start", key.start)
+			c.enqueue(result(key.station, key.start, v, events.VolumeArchiveOnly))
+		}
+	}
+}
+
+func (c *Correlator) enqueue(event events.VolumeArchivedEvent) {
+	select {
+	case c.pending <- event:
+	default:
+		slog.Warn("Correlator queue full, dropping result", "station", event.Station, "start", event.VolumeStart)
+	}
+}
+
+func result(station string, start time.Time, v *volume, match events.VolumeMatch) events.VolumeArchivedEvent {
+	event := events.VolumeArchivedEvent{
+		Station:      station,
+		VolumeStart:  start.UTC(),
+		Match:        match,
+		VolumeNumber: v.number,
+		Chunks:       v.chunks,
+		FirstChunk:   v.firstChunk,
+		LastChunk:    v.lastChunk,
+		ArchiveTime:  v.archived,
+	}
+	if v.archive != nil {
+		event.ArchivePath = v.archive.Path
+		event.ArchiveURL = v.archive.URL
+	}
+	return event
+}
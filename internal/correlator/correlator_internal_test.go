@@ -0,0 +1,127 @@
+package correlator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+)
+
+type feeds struct {
+	chunk   bool
+	archive bool
+}
+
+func (f feeds) ListeningChunk(string) bool   { return f.chunk }
+func (f feeds) ListeningArchive(string) bool { return f.archive }
+
+func newTestCorrelator(f feeds) *Correlator {
+	return &Correlator{
+		window:  30 * time.Minute,
+		feeds:   f,
+		pending: make(chan events.Event, queueSize),
+		volumes: make(map[volumeKey]*volume),
+	}
+}
+
+func results(c *Correlator) []events.VolumeArchivedEvent {
+	var got []events.VolumeArchivedEvent
+	for {
+		select {
+		case event := <-c.pending:
+			got = append(got, event.(events.VolumeArchivedEvent))
+		default:
+			return got
+		}
+	}
+}
+
+func chunk(start time.Time, sequence int) events.NexradChunkEvent {
+	return events.NexradChunkEvent{Station: "KTLX", VolumeStart: start, VolumeNumber: 415, Sequence: sequence}
+}
+
+func archive(start time.Time, kind nexrad.ArchiveKind) events.NexradArchiveEvent {
+	return events.NexradArchiveEvent{
+		Station:  "KTLX",
+		Path:     "2024/04/18/KTLX/KTLX20240418_033635_V06",
+		ScanTime: start,
+		Kind:     kind,
+		URL:      "https://unidata-nexrad-level2.s3.amazonaws.com/2024/04/18/KTLX/KTLX20240418_033635_V06",
+	}
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	c := newTestCorrelator(feeds{chunk: true, archive: true})
+	start := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+	now := start.Add(10 * time.Second)
+
+	c.handle(chunk(start, 1), now)
+	c.handle(chunk(start, 2), now.Add(20*time.Second))
+	c.handle(archive(start, nexrad.ArchiveKindMDM), now.Add(time.Minute))
+	if got := results(c); len(got) != 0 {
+		t.Fatalf("got %+v before the volume was archived", got)
+	}
+	c.handle(archive(start, nexrad.ArchiveKindVolume), now.Add(6*time.Minute))
+
+	got := results(c)
+	if len(got) != 1 {
+		t.Fatalf("got %d results, want 1: %+v", len(got), got)
+	}
+	if got[0].Match != events.VolumeMatched || got[0].VolumeNumber != 415 || got[0].Chunks != 2 {
+		t.Errorf("unexpected result %+v", got[0])
+	}
+	if got[0].Lag != "5m40s" || got[0].ArchivePath != "2024/04/18/KTLX/KTLX20240418_033635_V06" {
+		t.Errorf("Lag = %q, ArchivePath = %q", got[0].Lag, got[0].ArchivePath)
+	}
+
+	// A straggler is neither a second match nor a chunk-only volume.
+	c.handle(chunk(start, 3), now.Add(7*time.Minute))
+	c.expire(now.Add(time.Hour))
+	if got := results(c); len(got) != 0 {
+		t.Errorf("got %+v after the match", got)
+	}
+}
+
+func TestOneSided(t *testing.T) {
+	t.Parallel()
+	c := newTestCorrelator(feeds{chunk: true, archive: true})
+	start := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+	next := start.Add(5 * time.Minute)
+
+	c.handle(chunk(start, 1), start)
+	c.handle(archive(next, nexrad.ArchiveKindVolume), next)
+	c.expire(start.Add(29 * time.Minute))
+	if got := results(c); len(got) != 0 {
+		t.Fatalf("got %+v within the window", got)
+	}
+
+	c.expire(next.Add(31 * time.Minute))
+	got := results(c)
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(got), got)
+	}
+	byMatch := map[events.VolumeMatch]events.VolumeArchivedEvent{}
+	for _, result := range got {
+		byMatch[result.Match] = result
+	}
+	if r := byMatch[events.VolumeChunkOnly]; !r.VolumeStart.Equal(start) || r.ArchivePath != "" {
+		t.Errorf("chunk-only result = %+v", r)
+	}
+	if r := byMatch[events.VolumeArchiveOnly]; !r.VolumeStart.Equal(next) || r.Chunks != 0 {
+		t.Errorf("archive-only result = %+v", r)
+	}
+}
+
+func TestOneSidedWithoutTheOtherFeed(t *testing.T) {
+	t.Parallel()
+	c := newTestCorrelator(feeds{chunk: true})
+	start := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+
+	c.handle(chunk(start, 1), start)
+	c.expire(start.Add(time.Hour))
+	if got := results(c); len(got) != 0 {
+		t.Errorf("got %+v, want nothing while archive events are not received", got)
+	}
+}
@@ -0,0 +1,87 @@
+package decoder
+
+import (
+	"context"
+	"math"
+	"slices"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+// Decoder fetches real-time chunks and fills their events in with what the
+// radar was doing: the VCP and the elevation cuts each chunk covers.
+type Decoder struct {
+	client   s3.Getter
+	registry *stations.Registry
+}
+
+// NewDecoder returns a Decoder that also records each station's reported
+// location in registry.
+func NewDecoder(client s3.Getter, registry *stations.Registry) *Decoder {
+	return &Decoder{client: client, registry: registry}
+}
+
+// Enrich fetches and decodes the chunk behind event, then records its VCP and
+// elevations on it. The event is left untouched on error.
+func (d *Decoder) Enrich(ctx context.Context, event *events.NexradChunkEvent) error {
+	data, err := d.client.Get(ctx, event.Bucket, event.Path)
+	if err != nil {
+		return err
+	}
+	chunk, err := level2.Decode(data)
+	if err != nil {
+		return err
+	}
+	if len(chunk.Radials) > 0 {
+		radial := chunk.Radials[0]
+		d.registry.Observe(event.Station, float64(radial.Latitude), float64(radial.Longitude))
+	}
+	event.VCP = chunk.VCP
+	event.Cuts = chunk.Cuts
+	event.Elevations = Elevations(chunk.Radials)
+	event.Radials = chunk.Radials
+	return nil
+}
+
+// Elevations summarises radials, in order, into the elevation cuts they
+// belong to. A chunk usually holds part of one cut, but can straddle two.
+func Elevations(radials []*level2.Radial) []events.ChunkElevation {
+	var elevations []events.ChunkElevation
+	var sum float64
+	for _, radial := range radials {
+		n := len(elevations)
+		if n == 0 || elevations[n-1].Number != radial.ElevationNumber {
+			if n > 0 {
+				elevations[n-1].Angle = meanAngle(sum, elevations[n-1].Radials)
+			}
+			elevations = append(elevations, events.ChunkElevation{Number: radial.ElevationNumber})
+			sum = 0
+			n++
+		}
+		elevation := &elevations[n-1]
+		elevation.Radials++
+		sum += float64(radial.Elevation)
+		elevation.Start = elevation.Start || radial.Status.StartsElevation()
+		elevation.End = elevation.End || radial.Status.EndsElevation()
+		for name := range radial.Moments {
+			if !slices.Contains(elevation.Moments, name) {
+				elevation.Moments = append(elevation.Moments, name)
+			}
+		}
+	}
+	for i := range elevations {
+		slices.Sort(elevations[i].Moments)
+	}
+	if n := len(elevations); n > 0 {
+		elevations[n-1].Angle = meanAngle(sum, elevations[n-1].Radials)
+	}
+	return elevations
+}
+
+// meanAngle rounds to hundredths of a degree, finer than any VCP specifies.
+func meanAngle(sum float64, count int) float64 {
+	return math.Round(sum/float64(count)*100) / 100
+}
@@ -0,0 +1,90 @@
+package decoder_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/decoder"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+const bucket = "unidata-nexrad-level2-chunks"
+
+// newTestDecoder serves the level2 fixtures path-style, as S3 would under
+// KTLX/415/<name>.
+func newTestDecoder(t *testing.T) (*decoder.Decoder, *stations.Registry) {
+	t.Helper()
+	fixtures := http.StripPrefix("/"+bucket+"/KTLX/415/", http.FileServer(http.Dir("../level2/testdata")))
+	server := httptest.NewServer(fixtures)
+	t.Cleanup(server.Close)
+	registry := stations.NewRegistry()
+	return decoder.NewDecoder(s3.NewClient(server.URL), registry), registry
+}
+
+func TestEnrich(t *testing.T) {
+	t.Parallel()
+	d, registry := newTestDecoder(t)
+
+	tests := []struct {
+		name       string
+		vcp        int
+		elevations []events.ChunkElevation
+	}{
+		{"001-S", 212, nil},
+		{"002-I", 212, []events.ChunkElevation{
+			{Number: 1, Angle: 0.48, Radials: 180, Moments: []string{"REF", "VEL"}, Start: true},
+		}},
+		{"003-I", 212, []events.ChunkElevation{
+			{Number: 1, Angle: 0.48, Radials: 180, Moments: []string{"REF", "VEL"}, End: true},
+			{Number: 2, Angle: 0.88, Radials: 120, Moments: []string{"REF", "VEL"}, Start: true},
+		}},
+		{"004-E", 212, []events.ChunkElevation{
+			{Number: 2, Angle: 0.88, Radials: 240, Moments: []string{"REF", "VEL"}, End: true},
+		}},
+	}
+	for _, tt := range tests {
+		event := events.NexradChunkEvent{
+			Station: "KTLX",
+			Bucket:  bucket,
+			Path:    "KTLX/415/KTLX-20240418-033635-" + tt.name,
+		}
+		if err := d.Enrich(context.Background(), &event); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if event.VCP != tt.vcp {
+			t.Errorf("%s: VCP = %d, want %d", tt.name, event.VCP, tt.vcp)
+		}
+		if !reflect.DeepEqual(event.Elevations, tt.elevations) {
+			t.Errorf("%s: Elevations = %+v, want %+v", tt.name, event.Elevations, tt.elevations)
+		}
+	}
+
+	station, ok := registry.Lookup("ktlx")
+	if !ok {
+		t.Fatal("KTLX was not registered")
+	}
+	if station.Latitude < 35.33 || station.Latitude > 35.34 || station.Longitude < -97.28 || station.Longitude > -97.27 {
+		t.Errorf("KTLX registered at %f, %f", station.Latitude, station.Longitude)
+	}
+}
+
+func TestEnrichMissingChunk(t *testing.T) {
+	t.Parallel()
+	d, _ := newTestDecoder(t)
+
+	event := events.NexradChunkEvent{Station: "KTLX", Bucket: bucket, Path: "KTLX/415/KTLX-20240418-033635-005-E"}
+	err := d.Enrich(context.Background(), &event)
+	if !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+	if event.VCP != 0 || event.Elevations != nil {
+		t.Errorf("event was modified: %+v", event)
+	}
+}
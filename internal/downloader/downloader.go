@@ -0,0 +1,305 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // S3 ETags are MD5 digests; this is an integrity check, not security.
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+)
+
+const (
+	// queueSize bounds how many downloads may wait for a worker. Beyond it new
+	// objects are skipped rather than stalling the event bus.
+	queueSize = 256
+	// maxCleanupInterval caps how long expired files may linger.
+	maxCleanupInterval = 10 * time.Minute
+)
+
+var (
+	ErrVerification = errors.New("downloaded object failed verification")
+	ErrUnsafePath   = errors.New("object can't be mirrored safely")
+)
+
+// Subscriptions reports which stations currently have clients.
+type Subscriptions interface {
+	Subscribed(station string) bool
+}
+
+type job struct {
+	station string
+	source  events.EventType
+	bucket  string
+	key     string
+	// size and etag are what the announcing event claims, when it says.
+	size uint
+	etag string
+	// localPath is where the object is mirrored to.
+	localPath string
+}
+
+// Downloader mirrors announced objects into a local directory laid out as
+// bucket/key, then announces each one with a NexradDownloadedEvent.
+type Downloader struct {
+	config        *config.Downloader
+	client        *s3.Client
+	subscriptions Subscriptions
+	publish       chan<- events.Event
+	jobs          chan job
+	// backoff is the delay before the first retry; it doubles each attempt.
+	backoff time.Duration
+
+	consumer *events.Consumer
+}
+
+// NewDownloader starts downloading objects announced on eventsChannel and
+// publishes the results to publish.
+func NewDownloader(config *config.Downloader, client *s3.Client, subscriptions Subscriptions, eventsChannel <-chan events.Event, publish chan<- events.Event) *Downloader {
+	d := &Downloader{
+		config:        config,
+		client:        client,
+		subscriptions: subscriptions,
+		publish:       publish,
+		jobs:          make(chan job, queueSize),
+		backoff:       time.Second,
+		consumer:      events.NewConsumer(),
+	}
+
+	for range config.Concurrency {
+		d.consumer.Go(d.worker)
+	}
+	if config.Retention > 0 {
+		d.consumer.Go(d.cleanupLoop)
+	}
+	d.consumer.Consume(eventsChannel, d.enqueue)
+	return d
+}
+
+// Stop cancels in-flight downloads and waits for the workers to exit.
+func (d *Downloader) Stop() error {
+	d.consumer.Stop()
+	return nil
+}
+
+func (d *Downloader) wanted(station string) bool {
+	if len(d.config.Stations) == 0 {
+		return d.subscriptions.Subscribed(station)
+	}
+	return slices.ContainsFunc(d.config.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+// enqueue turns events into jobs.
+func (d *Downloader) enqueue(event events.Event) {
+	var j job
+	switch e := event.(type) {
+	case events.NexradChunkEvent:
+		j = job{station: e.Station, source: e.GetType(), bucket: e.Bucket, key: e.Path}
+	case events.NexradArchiveEvent:
+		j = job{station: e.Station, source: e.GetType(), bucket: e.Bucket, key: e.Path, size: e.Size, etag: e.ETag}
+	default:
+		return
+	}
+	if !d.wanted(j.station) {
+		return
+	}
+	localPath, err := localPath(d.config.Directory, j.bucket, j.key)
+	if err != nil {
+		slog.Warn("Skipping object", "bucket", j.bucket, "key", j.key, "error", err)
+		return
+	}
+	j.localPath = localPath
+	select {
+	case d.jobs <- j:
+	default:
+		slog.Warn("Download queue full, skipping object", "bucket", j.bucket, "key", j.key)
+	}
+}
+
+func (d *Downloader) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-d.jobs:
+			d.handle(ctx, j)
+		}
+	}
+}
+
+// localPath is where the object key in bucket is mirrored under directory.
+// Both come from the notification, so only the NEXRAD buckets are mirrored,
+// and keys that would climb out of their bucket's directory are refused.
+func localPath(directory, bucket, key string) (string, error) {
+	if bucket != nexrad.ArchiveBucket && bucket != nexrad.ChunkBucket {
+		return "", fmt.Errorf("%w: unknown bucket %q", ErrUnsafePath, bucket)
+	}
+	rel := filepath.Join(bucket, filepath.FromSlash(key))
+	if !filepath.IsLocal(rel) || !strings.HasPrefix(rel, bucket+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: key %q leaves the bucket", ErrUnsafePath, key)
+	}
+	return filepath.Join(directory, rel), nil
+}
+
+func (d *Downloader) handle(ctx context.Context, j job) {
+	localPath := j.localPath
+
+	var (
+		size int64
+		err  error
+	)
+	backoff := d.backoff
+	for attempt := uint(0); ; attempt++ {
+		size, err = d.download(ctx, j, localPath)
+		if err == nil || ctx.Err() != nil || attempt >= d.config.Retries {
+			break
+		}
+		slog.Debug("Retrying download", "key", j.key, "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Failed to download object", "bucket", j.bucket, "key", j.key, "error", err)
+		}
+		return
+	}
+
+	slog.Debug("Downloaded object", "bucket", j.bucket, "key", j.key, "path", localPath)
+	if d.consumer.Stopped() {
+		return
+	}
+	d.publish <- events.NexradDownloadedEvent{
+		Station:   j.station,
+		Source:    j.source,
+		Bucket:    j.bucket,
+		Path:      j.key,
+		LocalPath: localPath,
+		Size:      size,
+	}
+}
+
+// download writes the object to a temporary file beside localPath and only
+// renames it into place once its size and checksum have been verified.
+func (d *Downloader) download(ctx context.Context, j job, localPath string) (int64, error) {
+	resp, err := d.client.Do(ctx, j.bucket, j.key, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// A no-op once the rename has succeeded.
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := md5.New() //nolint:gosec // See import.
+	size, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	wantSize := resp.ContentLength
+	if j.size > 0 {
+		wantSize = int64(j.size)
+	}
+	if wantSize >= 0 && size != wantSize {
+		return 0, fmt.Errorf("%w: got %d bytes, want %d", ErrVerification, size, wantSize)
+	}
+	wantETag := j.etag
+	if wantETag == "" {
+		wantETag = resp.Header.Get("ETag")
+	}
+	wantETag = strings.Trim(wantETag, `"`)
+	// Multipart ETags are not a digest of the content, so they can't be checked.
+	if wantETag != "" && !strings.Contains(wantETag, "-") {
+		if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, wantETag) {
+			return 0, fmt.Errorf("%w: got MD5 %s, want %s", ErrVerification, got, wantETag)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (d *Downloader) cleanupLoop(ctx context.Context) {
+	interval := min(time.Duration(d.config.Retention)/4, maxCleanupInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := d.cleanup(now); err != nil {
+				slog.Warn("Failed to clean up downloads", "error", err)
+			}
+		}
+	}
+}
+
+// cleanup removes files older than the retention period, then any
+// directories that leaves empty.
+func (d *Downloader) cleanup(now time.Time) error {
+	cutoff := now.Add(-time.Duration(d.config.Retention))
+	var dirs []string
+	err := filepath.WalkDir(d.config.Directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if path != d.config.Directory {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+	// Deepest first, so parents empty out as their children are removed.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// Fails harmlessly on directories that still hold files.
+		_ = os.Remove(dirs[i])
+	}
+	return err
+}
@@ -0,0 +1,241 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // See downloader.go.
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+)
+
+// standIn is a minimal path-style S3 endpoint serving fixed objects.
+type standIn struct {
+	objects map[string][]byte
+	// failures is how many requests fail with a 503 before objects are served.
+	failures atomic.Int32
+	requests atomic.Int32
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if s.failures.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	data, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sum := md5.Sum(data) //nolint:gosec // See downloader.go.
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	_, _ = w.Write(data)
+}
+
+type subscribed map[string]bool
+
+func (s subscribed) Subscribed(station string) bool {
+	return s[station]
+}
+
+func newTestDownloader(t *testing.T, cfg *config.Downloader, stand *standIn, subs Subscriptions) (chan events.Event, chan events.Event) {
+	t.Helper()
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+
+	if cfg.Directory == "" {
+		cfg.Directory = t.TempDir()
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 2
+	}
+	in := make(chan events.Event, 10)
+	out := make(chan events.Event, 10)
+	d := NewDownloader(cfg, s3.NewClient(server.URL), subs, in, out)
+	d.backoff = time.Millisecond
+	t.Cleanup(func() {
+		close(in)
+		_ = d.Stop()
+	})
+	return in, out
+}
+
+func waitFor(t *testing.T, out chan events.Event) events.NexradDownloadedEvent {
+	t.Helper()
+	select {
+	case event := <-out:
+		downloaded, ok := event.(events.NexradDownloadedEvent)
+		if !ok {
+			t.Fatalf("got %T, want NexradDownloadedEvent", event)
+		}
+		return downloaded
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for download")
+	}
+	return events.NexradDownloadedEvent{}
+}
+
+func TestDownloadChunk(t *testing.T) {
+	t.Parallel()
+	chunk := []byte("AR2V0006.415")
+	stand := &standIn{objects: map[string][]byte{
+		"unidata-nexrad-level2-chunks/KJAX/415/20240418-033635-001-S": chunk,
+	}}
+	stand.failures.Store(1)
+	in, out := newTestDownloader(t, &config.Downloader{Retries: 2}, stand, subscribed{"KJAX": true})
+
+	in <- events.NexradChunkEvent{
+		Station: "KJAX",
+		Bucket:  "unidata-nexrad-level2-chunks",
+		Path:    "KJAX/415/20240418-033635-001-S",
+	}
+
+	got := waitFor(t, out)
+	if got.Station != "KJAX" || got.Source != events.EventTypeNexradChunk || got.Size != int64(len(chunk)) {
+		t.Errorf("unexpected event %+v", got)
+	}
+	want := filepath.Join("unidata-nexrad-level2-chunks", "KJAX", "415", "20240418-033635-001-S")
+	if !strings.HasSuffix(got.LocalPath, want) {
+		t.Errorf("LocalPath = %q, want it to mirror the key as %q", got.LocalPath, want)
+	}
+	data, err := os.ReadFile(got.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, chunk) {
+		t.Errorf("downloaded %q, want %q", data, chunk)
+	}
+	if n := stand.requests.Load(); n != 2 {
+		t.Errorf("made %d requests, want a retry after the first failure", n)
+	}
+}
+
+func TestDownloadVerifiesArchiveETag(t *testing.T) {
+	t.Parallel()
+	key := "2024/04/18/KTLX/KTLX20240418_033635_V06"
+	volume := []byte("AR2V0006.volume")
+	stand := &standIn{objects: map[string][]byte{"unidata-nexrad-level2/" + key: volume}}
+	dir := t.TempDir()
+	in, out := newTestDownloader(t, &config.Downloader{Directory: dir, Stations: []string{"ktlx"}}, stand, subscribed{})
+
+	// The event claims a different checksum than the object has.
+	in <- events.NexradArchiveEvent{
+		Station: "KTLX",
+		Bucket:  "unidata-nexrad-level2",
+		Path:    key,
+		Size:    uint(len(volume)),
+		ETag:    "00000000000000000000000000000000",
+	}
+	sum := md5.Sum(volume) //nolint:gosec // See downloader.go.
+	in <- events.NexradArchiveEvent{
+		Station: "KTLX",
+		Bucket:  "unidata-nexrad-level2",
+		Path:    key,
+		Size:    uint(len(volume)),
+		ETag:    hex.EncodeToString(sum[:]),
+	}
+
+	// Only the second event can produce a download.
+	got := waitFor(t, out)
+	if got.Source != events.EventTypeNexradArchive {
+		t.Errorf("Source = %q, want %q", got.Source, events.EventTypeNexradArchive)
+	}
+	select {
+	case event := <-out:
+		t.Errorf("unexpected second event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	tests := []struct {
+		bucket string
+		key    string
+		valid  bool
+	}{
+		{"unidata-nexrad-level2-chunks", "KTLX/415/20240418-033635-001-S", true},
+		{"unidata-nexrad-level2", "2024/04/18/KTLX/KTLX20240418_033635_V06", true},
+		{"unidata-nexrad-level2", "/2024/04/18/KTLX/KTLX20240418_033635_V06", true},
+		{"elsewhere", "KTLX/415/20240418-033635-001-S", false},
+		{"..", "etc/passwd", false},
+		{"unidata-nexrad-level2-chunks", "../../etc/passwd", false},
+		{"unidata-nexrad-level2-chunks", "KTLX/../../unidata-nexrad-level2/x", false},
+		{"unidata-nexrad-level2-chunks", "..", false},
+		{"unidata-nexrad-level2-chunks", "", false},
+	}
+	for _, tt := range tests {
+		path, err := localPath(dir, tt.bucket, tt.key)
+		if (err == nil) != tt.valid {
+			t.Errorf("localPath(%q, %q) = %q, %v, want valid %t", tt.bucket, tt.key, path, err, tt.valid)
+			continue
+		}
+		if err == nil && !strings.HasPrefix(path, filepath.Join(dir, tt.bucket)+string(filepath.Separator)) {
+			t.Errorf("localPath(%q, %q) = %q, outside %s", tt.bucket, tt.key, path, dir)
+		}
+	}
+}
+
+func TestDownloadSkipsUnsubscribedStations(t *testing.T) {
+	t.Parallel()
+	stand := &standIn{objects: map[string][]byte{}}
+	in, out := newTestDownloader(t, &config.Downloader{}, stand, subscribed{"KJAX": true})
+
+	in <- events.NexradChunkEvent{Station: "KTLX", Bucket: "b", Path: "KTLX/1/20240418-033635-001-S"}
+
+	select {
+	case event := <-out:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := stand.requests.Load(); n != 0 {
+		t.Errorf("made %d requests for an unsubscribed station", n)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	d := &Downloader{config: &config.Downloader{Directory: dir, Retention: config.Duration(time.Hour)}}
+
+	old := filepath.Join(dir, "bucket", "KTLX", "1", "old")
+	fresh := filepath.Join(dir, "bucket", "KTLX", "2", "fresh")
+	for _, path := range []string{old, fresh} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(old, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.cleanup(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expired file still exists: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(old)); !os.IsNotExist(err) {
+		t.Errorf("emptied directory still exists: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh file removed: %v", err)
+	}
+}
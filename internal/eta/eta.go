@@ -0,0 +1,182 @@
+package eta
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+const (
+	// samples is how many recent volumes per VCP, and recent errors, the
+	// estimates are drawn from.
+	samples = 10
+	// minSamples is how many intervals a VCP needs before it is estimated.
+	minSamples = 2
+	// maxInterval is the longest time between volume starts that counts as
+	// cadence rather than an outage. No VCP takes this long.
+	maxInterval = 20 * time.Minute
+)
+
+// history is what has been seen of one station's volumes under one VCP.
+type history struct {
+	// intervals are between volume starts, durations from a volume's start
+	// to the arrival of its E chunk.
+	intervals []time.Duration
+	durations []time.Duration
+}
+
+type stationState struct {
+	vcp    int
+	volume time.Time
+	// estimate is the start predicted for the volume after volume, if any.
+	estimate time.Time
+	errors   []time.Duration
+	vcps     map[int]*history
+}
+
+// Estimator predicts when each station's next volume will start and finish
+// from the volume start times, E chunk arrivals and VCPs it has seen.
+type Estimator struct {
+	mu       sync.Mutex
+	stations map[string]*stationState
+
+	consumer *events.Consumer
+}
+
+// NewEstimator starts learning from the chunks announced on eventsChannel.
+func NewEstimator(eventsChannel <-chan events.Event) *Estimator {
+	e := &Estimator{
+		stations: make(map[string]*stationState),
+		consumer: events.NewConsumer(),
+	}
+	e.consumer.Consume(eventsChannel, e.handle)
+	return e
+}
+
+// Stop stops learning. Estimates already made are still given.
+func (e *Estimator) Stop() error {
+	e.consumer.Stop()
+	return nil
+}
+
+func (e *Estimator) handle(event events.Event) {
+	if chunk, ok := event.(events.NexradChunkEvent); ok {
+		e.observe(chunk, time.Now())
+	}
+}
+
+func (e *Estimator) observe(chunk events.NexradChunkEvent, now time.Time) {
+	if chunk.VolumeStart.IsZero() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	station := strings.ToUpper(chunk.Station)
+	state, ok := e.stations[station]
+	if !ok {
+		state = &stationState{vcps: make(map[int]*history)}
+		e.stations[station] = state
+	}
+
+	if chunk.VolumeStart.After(state.volume) {
+		if !state.estimate.IsZero() {
+			state.errors = appendRecent(state.errors, absDuration(chunk.VolumeStart.Sub(state.estimate)))
+		}
+		interval := chunk.VolumeStart.Sub(state.volume)
+		// A VCP change restarts the volume early, so says nothing about
+		// either VCP's cadence.
+		if !state.volume.IsZero() && interval <= maxInterval && (chunk.VCP == 0 || chunk.VCP == state.vcp) {
+			h := state.history(state.vcp)
+			h.intervals = appendRecent(h.intervals, interval)
+		}
+		state.volume = chunk.VolumeStart
+		state.estimate = time.Time{}
+	}
+	if !chunk.VolumeStart.Equal(state.volume) {
+		// A straggler from an earlier volume.
+		return
+	}
+	if chunk.VCP != 0 {
+		state.vcp = chunk.VCP
+	}
+	if chunk.ChunkType == "E" {
+		h := state.history(state.vcp)
+		h.durations = appendRecent(h.durations, now.Sub(chunk.VolumeStart))
+	}
+	if state.estimate.IsZero() {
+		if h, ok := state.vcps[state.vcp]; ok && len(h.intervals) >= minSamples {
+			state.estimate = state.volume.Add(median(h.intervals))
+		}
+	}
+}
+
+// Estimate returns when station's next volume is expected, if enough of
+// its volumes have been seen under the current VCP to say.
+func (e *Estimator) Estimate(station string) (events.VolumeETA, bool) {
+	station = strings.ToUpper(station)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state, ok := e.stations[station]
+	if !ok || state.estimate.IsZero() {
+		return events.VolumeETA{}, false
+	}
+	h := state.vcps[state.vcp]
+	eta := events.VolumeETA{
+		Station:         station,
+		VCP:             state.vcp,
+		VolumeStart:     state.volume,
+		NextVolumeStart: state.estimate,
+		Samples:         len(h.intervals),
+	}
+	// Until an E chunk has been timed, assume the volume takes as long as
+	// the time between starts, as it does when the radar never idles.
+	duration := median(h.intervals)
+	if len(h.durations) > 0 {
+		duration = median(h.durations)
+	}
+	eta.NextVolumeComplete = state.estimate.Add(duration)
+
+	confidence := float64(len(h.intervals)) / samples
+	if len(state.errors) > 0 {
+		var sum time.Duration
+		for _, err := range state.errors {
+			sum += err
+		}
+		recentError := sum / time.Duration(len(state.errors))
+		eta.RecentError = recentError.Truncate(time.Second).String()
+		confidence *= max(0, 1-float64(recentError)/float64(median(h.intervals)))
+	}
+	eta.Confidence = math.Round(confidence*100) / 100
+	return eta, true
+}
+
+func (s *stationState) history(vcp int) *history {
+	h, ok := s.vcps[vcp]
+	if !ok {
+		h = &history{}
+		s.vcps[vcp] = h
+	}
+	return h
+}
+
+func appendRecent(values []time.Duration, value time.Duration) []time.Duration {
+	values = append(values, value)
+	return values[max(0, len(values)-samples):]
+}
+
+func median(values []time.Duration) time.Duration {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
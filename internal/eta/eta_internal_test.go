@@ -0,0 +1,96 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+func newTestEstimator() *Estimator {
+	return &Estimator{stations: make(map[string]*stationState)}
+}
+
+// volume feeds the S and E chunks of a volume starting at start, the E chunk
+// arriving duration later.
+func volume(e *Estimator, start time.Time, duration time.Duration, vcp int) {
+	e.observe(events.NexradChunkEvent{Station: "KTLX", VolumeStart: start, ChunkType: "S", VCP: vcp}, start.Add(10*time.Second))
+	e.observe(events.NexradChunkEvent{Station: "KTLX", VolumeStart: start, ChunkType: "E", VCP: vcp}, start.Add(duration))
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+	e := newTestEstimator()
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+
+	volume(e, start, 4*time.Minute, 212)
+	volume(e, start.Add(5*time.Minute), 4*time.Minute, 212)
+	if _, ok := e.Estimate("KTLX"); ok {
+		t.Fatal("estimated from a single interval")
+	}
+	last := start.Add(10 * time.Minute)
+	volume(e, last, 4*time.Minute, 212)
+
+	got, ok := e.Estimate("ktlx")
+	if !ok {
+		t.Fatal("no estimate after three volumes")
+	}
+	if !got.NextVolumeStart.Equal(last.Add(5*time.Minute)) || !got.NextVolumeComplete.Equal(last.Add(9*time.Minute)) {
+		t.Errorf("next volume %v to %v, want %v to %v", got.NextVolumeStart, got.NextVolumeComplete, last.Add(5*time.Minute), last.Add(9*time.Minute))
+	}
+	if got.VCP != 212 || got.Samples != 2 || got.Confidence != 0.2 || got.RecentError != "" {
+		t.Errorf("unexpected estimate %+v", got)
+	}
+
+	// The next volume is 30 seconds late, which is the recent error.
+	volume(e, last.Add(5*time.Minute+30*time.Second), 4*time.Minute, 212)
+	got, _ = e.Estimate("KTLX")
+	if got.RecentError != "30s" || got.Samples != 3 {
+		t.Errorf("unexpected estimate %+v", got)
+	}
+	if got.Confidence >= 0.3 {
+		t.Errorf("Confidence = %v, want less than the 0.3 of a perfect record", got.Confidence)
+	}
+}
+
+func TestEstimateAfterVCPChange(t *testing.T) {
+	t.Parallel()
+	e := newTestEstimator()
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		volume(e, start.Add(time.Duration(i)*10*time.Minute), 9*time.Minute, 35)
+	}
+	if got, ok := e.Estimate("KTLX"); !ok || got.VCP != 35 {
+		t.Fatalf("Estimate = %+v, %t, want VCP 35", got, ok)
+	}
+
+	// Nothing is known of VCP 212's cadence yet.
+	volume(e, start.Add(25*time.Minute), 4*time.Minute, 212)
+	if got, ok := e.Estimate("KTLX"); ok {
+		t.Errorf("Estimate = %+v, want none for a new VCP", got)
+	}
+}
+
+func TestStop(t *testing.T) {
+	t.Parallel()
+	eventsChannel := make(chan events.Event)
+	e := NewEstimator(eventsChannel)
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	// Still taken from the channel, so the bus isn't held up, but unheard.
+	for i := range 3 {
+		select {
+		case eventsChannel <- events.NexradChunkEvent{Station: "KTLX", ChunkType: "S", VolumeStart: start.Add(time.Duration(i) * 5 * time.Minute)}:
+		case <-time.After(time.Second):
+			t.Fatal("stopped estimator blocked the bus")
+		}
+	}
+	close(eventsChannel)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.stations) != 0 {
+		t.Errorf("stopped estimator learned %v", e.stations)
+	}
+}
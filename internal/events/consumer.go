@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Consumer runs a bus subscriber: a goroutine handing it the events from its
+// subscription, and any workers it hands them on to. After Stop the
+// subscription is still drained, only without handling, so the bus is never
+// blocked on a stopped subscriber.
+type Consumer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// mu keeps Go from adding to wg while Stop waits on it.
+	mu      sync.Mutex
+	stopped atomic.Bool
+}
+
+func NewConsumer() *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{ctx: ctx, cancel: cancel}
+}
+
+// Context is done once Stop is called.
+func (c *Consumer) Context() context.Context {
+	return c.ctx
+}
+
+// Stopped reports whether Stop has been called.
+func (c *Consumer) Stopped() bool {
+	return c.stopped.Load()
+}
+
+// Go runs worker, which must return once ctx is done, and has Stop wait for
+// it. Once stopped, Go does nothing.
+func (c *Consumer) Go(worker func(ctx context.Context)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped.Load() {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		worker(c.ctx)
+	}()
+}
+
+// Consume calls handle with each event from eventsChannel until Stop.
+func (c *Consumer) Consume(eventsChannel <-chan Event, handle func(Event)) {
+	c.ConsumeTicking(eventsChannel, handle, 0, nil)
+}
+
+// ConsumeTicking is Consume, also calling tick every interval. handle and
+// tick are called from the same goroutine, so they may share state without
+// locking.
+func (c *Consumer) ConsumeTicking(eventsChannel <-chan Event, handle func(Event), interval time.Duration, tick func(time.Time)) {
+	go func() {
+		var ticks <-chan time.Time
+		if tick != nil {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+		for {
+			select {
+			case event, ok := <-eventsChannel:
+				if !ok {
+					return
+				}
+				if !c.stopped.Load() {
+					handle(event)
+				}
+			case now := <-ticks:
+				if !c.stopped.Load() {
+					tick(now)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops handling events, then cancels the workers and waits for them.
+func (c *Consumer) Stop() {
+	c.mu.Lock()
+	c.stopped.Store(true)
+	c.mu.Unlock()
+	c.cancel()
+	c.wg.Wait()
+}
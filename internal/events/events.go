@@ -1,14 +1,41 @@
 package events
 
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"go.opentelemetry.io/otel/trace"
+)
+
 type EventType string
 
 const (
-	EventTypeNexradChunk   EventType = "nexrad-chunk"
-	EventTypeNexradArchive EventType = "nexrad-archive"
+	EventTypeNexradChunk      EventType = "nexrad-chunk"
+	EventTypeNexradArchive    EventType = "nexrad-archive"
+	EventTypeNexradDownloaded EventType = "nexrad-downloaded"
+	EventTypeVolumeAssembled  EventType = "nexrad-volume-assembled"
+	EventTypeVolumePartial    EventType = "nexrad-volume-partial"
+	EventTypeSweepComplete    EventType = "nexrad-sweep-complete"
+	EventTypeNexradImage      EventType = "nexrad-image"
+	EventTypeNexradAlert      EventType = "nexrad-alert"
+	EventTypeStationStatus    EventType = "station-status"
+	EventTypeVolumeArchived   EventType = "volume-archived"
+	// EventTypeServiceStatus is a control message sent to every connection,
+	// whatever it subscribed to.
+	EventTypeServiceStatus EventType = "service-status"
+	// EventTypeCanary is the service checking its own ingest. It is never
+	// sent to clients.
+	EventTypeCanary EventType = "canary"
 )
 
 type Event interface {
 	GetType() EventType
+	// GetStation returns the ICAO identifier of the station the event is about.
+	GetStation() string
 }
 
 type NexradChunkEvent struct {
@@ -19,31 +46,413 @@ type NexradChunkEvent struct {
 	L2Version string `json:"l2Version"`
 	Name      string `json:"name"`
 	Path      string `json:"path"`
+	// VolumeStart, Sequence and VolumeNumber are parsed from Path.
+	VolumeStart  time.Time `json:"volumeStart"`
+	Sequence     int       `json:"sequence"`
+	VolumeNumber int       `json:"volumeNumber"`
+	Bucket       string    `json:"bucket"`
+	URL          string    `json:"url"`
+	// VCP and Elevations are decoded from the chunk itself, so they are
+	// only present when the decoder is enabled.
+	VCP        int              `json:"vcp,omitempty"`
+	Elevations []ChunkElevation `json:"elevations,omitempty"`
+	// Cuts is the VCP's elevation table, which only S chunks carry.
+	Cuts []level2.Cut `json:"-"`
+	// Radials are the decoded radials themselves, for consumers within the
+	// service. They are far too large to send to clients.
+	Radials []*level2.Radial `json:"-"`
+	Meta    Meta             `json:"-"`
+}
+
+// ChunkElevation describes the part of one elevation cut carried by a chunk.
+type ChunkElevation struct {
+	Number int `json:"number"`
+	// Angle is the mean elevation of the chunk's radials, in degrees.
+	Angle   float64 `json:"angle"`
+	Radials int     `json:"radials"`
+	// Moments names the data moments present, e.g. REF and VEL.
+	Moments []string `json:"moments,omitempty"`
+	// Start and End are set when the chunk holds the cut's first or last
+	// radial.
+	Start bool `json:"start"`
+	End   bool `json:"end"`
 }
 
 func (e NexradChunkEvent) GetType() EventType {
 	return EventTypeNexradChunk
 }
 
+func (e NexradChunkEvent) GetStation() string {
+	return e.Station
+}
+
 type NexradArchiveEvent struct {
 	Station string `json:"station"`
 	Path    string `json:"path"`
+	// ScanTime, Version and Kind are parsed from Path, and left unset when
+	// it isn't in the usual form.
+	ScanTime  time.Time          `json:"scanTime"`
+	Version   string             `json:"version"`
+	Kind      nexrad.ArchiveKind `json:"kind"`
+	Bucket    string             `json:"bucket"`
+	Size      uint               `json:"size"`
+	ETag      string             `json:"etag"`
+	EventTime time.Time          `json:"eventTime"`
+	URL       string             `json:"url"`
+	Meta      Meta               `json:"-"`
 }
 
 func (e NexradArchiveEvent) GetType() EventType {
 	return EventTypeNexradArchive
 }
 
+func (e NexradArchiveEvent) GetStation() string {
+	return e.Station
+}
+
+// NexradDownloadedEvent announces that the object behind a chunk or archive
+// event has been written to local disk.
+type NexradDownloadedEvent struct {
+	Station string `json:"station"`
+	// Source is the type of the event that announced the object.
+	Source    EventType `json:"source"`
+	Bucket    string    `json:"bucket"`
+	Path      string    `json:"path"`
+	LocalPath string    `json:"localPath"`
+	Size      int64     `json:"size"`
+}
+
+func (e NexradDownloadedEvent) GetType() EventType {
+	return EventTypeNexradDownloaded
+}
+
+func (e NexradDownloadedEvent) GetStation() string {
+	return e.Station
+}
+
+// NexradVolumeEvent announces a Level II volume stitched together from
+// real-time chunks. A partial volume is one that timed out with chunks
+// missing; its file holds only the chunks that did arrive.
+type NexradVolumeEvent struct {
+	Station      string    `json:"station"`
+	VolumeNumber int       `json:"volumeNumber"`
+	VolumeStart  time.Time `json:"volumeStart"`
+	LocalPath    string    `json:"localPath"`
+	Size         int64     `json:"size"`
+	Chunks       int       `json:"chunks"`
+	Partial      bool      `json:"partial"`
+	// Missing lists the absent chunk sequence numbers of a partial volume.
+	Missing []int `json:"missing,omitempty"`
+	// NextVolume estimates when the station's next volume will arrive, once
+	// enough volumes have been seen to say.
+	NextVolume *VolumeETA `json:"nextVolume,omitempty"`
+}
+
+// VolumeETA estimates when a station's next volume will start and when its
+// last chunk will arrive.
+type VolumeETA struct {
+	Station            string    `json:"station"`
+	VCP                int       `json:"vcp,omitempty"`
+	VolumeStart        time.Time `json:"volumeStart"`
+	NextVolumeStart    time.Time `json:"nextVolumeStart"`
+	NextVolumeComplete time.Time `json:"nextVolumeComplete"`
+	// Confidence runs from 0 to 1, growing with the history behind the
+	// estimate and shrinking with RecentError.
+	Confidence float64 `json:"confidence"`
+	// RecentError is the mean error of recent volume start estimates.
+	RecentError string `json:"recentError,omitempty"`
+	Samples     int    `json:"samples"`
+}
+
+func (e NexradVolumeEvent) GetType() EventType {
+	if e.Partial {
+		return EventTypeVolumePartial
+	}
+	return EventTypeVolumeAssembled
+}
+
+func (e NexradVolumeEvent) GetStation() string {
+	return e.Station
+}
+
+// NexradSweepEvent announces that every radial of one elevation cut has
+// arrived.
+type NexradSweepEvent struct {
+	Station         string    `json:"station"`
+	VolumeNumber    int       `json:"volumeNumber"`
+	VolumeStart     time.Time `json:"volumeStart"`
+	ElevationNumber int       `json:"elevationNumber"`
+	// Angle is the mean elevation of the cut's radials, in degrees.
+	Angle float64 `json:"angle"`
+	// LowestTilt is set for the volume's first cut and for supplemental
+	// (SAILS/MESO-SAILS) cuts repeating it.
+	LowestTilt bool     `json:"lowestTilt"`
+	VCP        int      `json:"vcp,omitempty"`
+	Moments    []string `json:"moments"`
+	// Chunks are the paths of the chunks holding the cut, in sequence order.
+	Chunks []string `json:"chunks"`
+	// Radials are the cut's decoded radials in the order they were scanned.
+	Radials []*level2.Radial `json:"-"`
+}
+
+func (e NexradSweepEvent) GetType() EventType {
+	return EventTypeSweepComplete
+}
+
+func (e NexradSweepEvent) GetStation() string {
+	return e.Station
+}
+
+// ImageBounds is the geographic extent of an image, in degrees.
+type ImageBounds struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// NexradImageEvent announces a newly rendered reflectivity image.
+type NexradImageEvent struct {
+	Station         string    `json:"station"`
+	VolumeNumber    int       `json:"volumeNumber"`
+	VolumeStart     time.Time `json:"volumeStart"`
+	ElevationNumber int       `json:"elevationNumber"`
+	Angle           float64   `json:"angle"`
+	// ScanTime is when the sweep's first radial was collected.
+	ScanTime  time.Time `json:"scanTime"`
+	LocalPath string    `json:"localPath"`
+	// URL is the server path the latest image for the station is served on.
+	URL    string      `json:"url"`
+	Width  int         `json:"width"`
+	Height int         `json:"height"`
+	Bounds ImageBounds `json:"bounds"`
+}
+
+func (e NexradImageEvent) GetType() EventType {
+	return EventTypeNexradImage
+}
+
+func (e NexradImageEvent) GetStation() string {
+	return e.Station
+}
+
+// NexradAlertEvent announces that a configured rule or zone matched.
+type NexradAlertEvent struct {
+	Station string `json:"station"`
+	// Rule is the name of the rule or zone.
+	Rule string `json:"rule"`
+	// Condition is the kind of condition that matched, e.g. vcp_change.
+	Condition string `json:"condition"`
+	Message   string `json:"message"`
+	// Evidence holds the observations that satisfied the condition.
+	Evidence map[string]any `json:"evidence"`
+	Time     time.Time      `json:"time"`
+}
+
+func (e NexradAlertEvent) GetType() EventType {
+	return EventTypeNexradAlert
+}
+
+func (e NexradAlertEvent) GetStation() string {
+	return e.Station
+}
+
+// ServiceState is how the service's own receipt of NOAA's notifications is
+// doing.
+type ServiceState string
+
+const (
+	ServiceHealthy  ServiceState = "healthy"
+	ServiceDegraded ServiceState = "degraded"
+	ServiceDown     ServiceState = "down"
+)
+
+// ServiceStatusEvent announces that the service's ingest changed state, so
+// clients can tell a quiet radar from a broken feed.
+type ServiceStatusEvent struct {
+	// Type is always EventTypeServiceStatus. It is sent because these arrive
+	// mixed in with whatever the connection subscribed to.
+	Type     EventType    `json:"type"`
+	Status   ServiceState `json:"status"`
+	Previous ServiceState `json:"previous,omitempty"`
+	// Reason explains any status but healthy.
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+func (e ServiceStatusEvent) GetType() EventType {
+	return EventTypeServiceStatus
+}
+
+// GetStation returns nothing; the status is of the service as a whole.
+func (e ServiceStatusEvent) GetStation() string {
+	return ""
+}
+
+// CanaryEvent is a synthetic notification the service sent through its own
+// chunk queue, having arrived at the end of the ingest path.
+type CanaryEvent struct {
+	ID   string `json:"id"`
+	Meta Meta   `json:"-"`
+}
+
+func (e CanaryEvent) GetType() EventType {
+	return EventTypeCanary
+}
+
+// GetStation returns nothing; the canary is not from a station.
+func (e CanaryEvent) GetStation() string {
+	return ""
+}
+
+// StationState is how a station's real-time feed is doing.
+type StationState string
+
+const (
+	StationOnline   StationState = "online"
+	StationDegraded StationState = "degraded"
+	StationOffline  StationState = "offline"
+)
+
+// StationStatusEvent announces that a station's feed changed state.
+type StationStatusEvent struct {
+	Station  string       `json:"station"`
+	Status   StationState `json:"status"`
+	Previous StationState `json:"previous,omitempty"`
+	// Reason explains why the station is not online.
+	Reason      string    `json:"reason,omitempty"`
+	VCP         int       `json:"vcp,omitempty"`
+	VolumeStart time.Time `json:"volumeStart"`
+	LastChunk   time.Time `json:"lastChunk"`
+	LastArchive time.Time `json:"lastArchive"`
+	// TypicalInterval is the usual time between volumes for the VCP, and
+	// LastInterval the time between the latest two.
+	TypicalInterval string    `json:"typicalInterval,omitempty"`
+	LastInterval    string    `json:"lastInterval,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+func (e StationStatusEvent) GetType() EventType {
+	return EventTypeStationStatus
+}
+
+func (e StationStatusEvent) GetStation() string {
+	return e.Station
+}
+
+// VolumeMatch is which feeds carried a volume.
+type VolumeMatch string
+
+const (
+	VolumeMatched     VolumeMatch = "matched"
+	VolumeChunkOnly   VolumeMatch = "chunk-only"
+	VolumeArchiveOnly VolumeMatch = "archive-only"
+)
+
+// VolumeArchivedEvent links a volume seen on the real-time chunk feed to its
+// file in the archive bucket, or reports that only one feed carried it.
+type VolumeArchivedEvent struct {
+	Station     string      `json:"station"`
+	VolumeStart time.Time   `json:"volumeStart"`
+	Match       VolumeMatch `json:"match"`
+	// The chunk fields are empty for archive-only volumes.
+	VolumeNumber int       `json:"volumeNumber,omitempty"`
+	Chunks       int       `json:"chunks,omitempty"`
+	FirstChunk   time.Time `json:"firstChunk"`
+	LastChunk    time.Time `json:"lastChunk"`
+	// The archive fields are empty for chunk-only volumes.
+	ArchivePath string    `json:"archivePath,omitempty"`
+	ArchiveURL  string    `json:"archiveURL,omitempty"`
+	ArchiveTime time.Time `json:"archiveTime"`
+	// Lag is how long after the last chunk the archive file arrived.
+	Lag string `json:"lag,omitempty"`
+}
+
+func (e VolumeArchivedEvent) GetType() EventType {
+	return EventTypeVolumeArchived
+}
+
+func (e VolumeArchivedEvent) GetStation() string {
+	return e.Station
+}
+
+// Meta is what the service knows about where an event came from. It is never
+// sent to clients.
+type Meta struct {
+	// Published is when SNS published the notification, for measuring
+	// delivery latency.
+	Published time.Time
+	// Span is the span the event was published under, so its delivery to
+	// clients joins the trace of the notification it came from.
+	Span trace.SpanContext
+}
+
+// MetaOf returns the metadata of events that come straight from an SNS
+// notification, and the zero Meta for the rest.
+func MetaOf(event Event) Meta {
+	switch e := event.(type) {
+	case NexradChunkEvent:
+		return e.Meta
+	case NexradArchiveEvent:
+		return e.Meta
+	case CanaryEvent:
+		return e.Meta
+	}
+	return Meta{}
+}
+
+// busBuffer is how many events may queue for publishing, and for each
+// subscriber, before senders block.
+const busBuffer = 100
+
+// EventBus fans every published event out to each subscriber. Delivery
+// blocks rather than drops, so subscribers must hand work off quickly; one
+// that stalls stalls the bus. Consumer runs a subscriber so that it does.
 type EventBus struct {
 	eventQueue chan Event
+
+	mu          sync.Mutex
+	subscribers []chan Event
 }
 
 func NewEventBus() *EventBus {
-	return &EventBus{
-		eventQueue: make(chan Event, 100),
+	eb := &EventBus{
+		eventQueue: make(chan Event, busBuffer),
 	}
+	go eb.run()
+	return eb
 }
 
+// GetChannel returns the channel events are published on. Closing it closes
+// every subscription.
 func (eb *EventBus) GetChannel() chan Event {
 	return eb.eventQueue
 }
+
+// Subscribe returns a channel that receives every event published from now on.
+func (eb *EventBus) Subscribe() <-chan Event {
+	sub := make(chan Event, busBuffer)
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.subscribers = append(eb.subscribers, sub)
+	return sub
+}
+
+func (eb *EventBus) run() {
+	for event := range eb.eventQueue {
+		metrics.EventQueueDepth.Set(float64(len(eb.eventQueue)))
+		metrics.Events.WithLabelValues(string(event.GetType()), metrics.Station(event.GetStation())).Inc()
+		eb.mu.Lock()
+		subscribers := slices.Clone(eb.subscribers)
+		eb.mu.Unlock()
+		for _, sub := range subscribers {
+			sub <- event
+		}
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	for _, sub := range eb.subscribers {
+		close(sub)
+	}
+}
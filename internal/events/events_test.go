@@ -0,0 +1,112 @@
+package events_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+func TestBusFansOutToEverySubscriber(t *testing.T) {
+	t.Parallel()
+	bus := events.NewEventBus()
+	first := bus.Subscribe()
+	second := bus.Subscribe()
+
+	event := events.NexradChunkEvent{Station: "KTLX", Chunk: "1"}
+	bus.GetChannel() <- event
+
+	for name, sub := range map[string]<-chan events.Event{"first": first, "second": second} {
+		select {
+		case got := <-sub:
+			if !reflect.DeepEqual(got, events.Event(event)) {
+				t.Errorf("%s subscriber got %v, want %v", name, got, event)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s subscriber received nothing", name)
+		}
+	}
+}
+
+func TestBusCloseClosesSubscriptions(t *testing.T) {
+	t.Parallel()
+	bus := events.NewEventBus()
+	sub := bus.Subscribe()
+	close(bus.GetChannel())
+
+	select {
+	case _, ok := <-sub:
+		if ok {
+			t.Error("expected the subscription to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription was not closed")
+	}
+}
+
+func TestConsumerDrainsAfterStop(t *testing.T) {
+	t.Parallel()
+	// Unbuffered, so every send waits for the consumer to take it.
+	eventsChannel := make(chan events.Event)
+	handled := make(chan events.Event, 10)
+	consumer := events.NewConsumer()
+	workerDone := make(chan struct{})
+	consumer.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerDone)
+	})
+	consumer.Consume(eventsChannel, func(event events.Event) {
+		handled <- event
+	})
+
+	eventsChannel <- events.NexradChunkEvent{Station: "KTLX"}
+	if got, ok := (<-handled).(events.NexradChunkEvent); !ok || got.Station != "KTLX" {
+		t.Errorf("handled %v, want the KTLX chunk", got)
+	}
+
+	consumer.Stop()
+	select {
+	case <-workerDone:
+	default:
+		t.Error("Stop returned before the worker")
+	}
+	select {
+	case eventsChannel <- events.NexradChunkEvent{Station: "KFDR"}:
+	case <-time.After(time.Second):
+		t.Fatal("stopped consumer blocked the bus")
+	}
+	close(eventsChannel)
+	if len(handled) != 0 {
+		t.Errorf("handled %v after Stop", <-handled)
+	}
+
+	ran := false
+	consumer.Go(func(context.Context) { ran = true })
+	if ran || !consumer.Stopped() {
+		t.Error("Go ran a worker after Stop")
+	}
+}
+
+func TestConsumerTicks(t *testing.T) {
+	t.Parallel()
+	eventsChannel := make(chan events.Event)
+	ticks := make(chan time.Time, 1)
+	consumer := events.NewConsumer()
+	consumer.ConsumeTicking(eventsChannel, func(events.Event) {}, time.Millisecond, func(now time.Time) {
+		select {
+		case ticks <- now:
+		default:
+		}
+	})
+	t.Cleanup(func() {
+		consumer.Stop()
+		close(eventsChannel)
+	})
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		t.Error("tick was never called")
+	}
+}
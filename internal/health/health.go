@@ -0,0 +1,433 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+const (
+	// queueSize bounds status changes waiting to be published. Beyond it
+	// they are dropped rather than stalling the tracker.
+	queueSize = 16
+	// checkInterval is how often the state is evaluated even when nothing
+	// is reported, as a hung receive loop reports nothing.
+	checkInterval = 10 * time.Second
+)
+
+type State string
+
+const (
+	// StateStarting is before every queue has been received from once.
+	StateStarting State = "starting"
+	StateHealthy  State = "healthy"
+	// StateDegraded still delivers notifications, but something that may
+	// stop it doing so has gone wrong.
+	StateDegraded State = "degraded"
+	StateDown     State = "down"
+)
+
+// Ready reports whether the service should be sent traffic in state s.
+func (s State) Ready() bool {
+	return s == StateHealthy || s == StateDegraded
+}
+
+// Service is the state as clients are told it. Starting up is only
+// degraded; nothing has gone wrong, but no events may be arriving yet.
+func (s State) Service() events.ServiceState {
+	switch s {
+	case StateHealthy:
+		return events.ServiceHealthy
+	case StateDown:
+		return events.ServiceDown
+	default:
+		return events.ServiceDegraded
+	}
+}
+
+// Queue is the health of one SQS queue's receive loop.
+type Queue struct {
+	LastReceive       *time.Time `json:"lastReceive,omitempty"`
+	ConsecutiveErrors uint       `json:"consecutiveErrors"`
+	LastError         string     `json:"lastError,omitempty"`
+}
+
+// FilterPolicy is the outcome of the last chunk filter policy update.
+type FilterPolicy struct {
+	LastApplied *time.Time `json:"lastApplied,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// Canary is the outcome of the synthetic notifications sent through the
+// ingest path.
+type Canary struct {
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// Latency is how long the last canary to arrive took.
+	Latency             string `json:"latency,omitempty"`
+	ConsecutiveFailures uint   `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+}
+
+// Report is a snapshot of the listener's health.
+type Report struct {
+	State State `json:"state"`
+	// Reason explains any state but healthy.
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	// Queues is empty in http ingest mode, where SNS delivers directly.
+	Queues        map[string]Queue `json:"queues,omitempty"`
+	FilterPolicy  FilterPolicy     `json:"filterPolicy"`
+	Subscriptions map[string]bool  `json:"subscriptions"`
+	// Canary is only present once a canary has been sent.
+	Canary *Canary `json:"canary,omitempty"`
+}
+
+type queue struct {
+	lastReceive time.Time
+	errors      uint
+	lastError   string
+}
+
+// Tracker works out the listener's state from what it reports. The state
+// depends on how long ago things happened, so it is evaluated again whenever
+// it is asked for as well as when something is reported.
+type Tracker struct {
+	config *config.Health
+	mode   config.IngestMode
+	feeds  []string
+
+	mu            sync.Mutex
+	started       time.Time
+	shutdown      bool
+	queues        map[string]*queue
+	subscriptions map[string]bool
+	policyApplied time.Time
+	policyError   string
+	canaryRan     bool
+	canarySuccess time.Time
+	canaryLatency time.Duration
+	canaryErrors  uint
+	canaryError   string
+	state         State
+	reason        string
+	since         time.Time
+	// unreadySince is when the state last stopped being ready, or when the
+	// tracker was created if it has never been.
+	unreadySince time.Time
+	now          func() time.Time
+
+	publish chan<- events.Event
+	pending chan events.Event
+	stopped atomic.Bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewTracker tracks a listener in mode receiving feeds, such as chunk and
+// archive. In sqs mode each feed has a queue as well as a subscription.
+// Changes to the service status are published to publish, unless it is nil.
+func NewTracker(cfg *config.Health, mode config.IngestMode, publish chan<- events.Event, feeds ...string) *Tracker {
+	t := &Tracker{
+		config:        cfg,
+		mode:          mode,
+		feeds:         feeds,
+		queues:        make(map[string]*queue),
+		subscriptions: make(map[string]bool),
+		state:         StateStarting,
+		now:           time.Now,
+		publish:       publish,
+		pending:       make(chan events.Event, queueSize),
+	}
+	if mode == config.IngestModeSQS {
+		for _, feed := range feeds {
+			t.queues[feed] = &queue{}
+		}
+	}
+	t.started = t.now()
+	t.since = t.started
+	t.unreadySince = t.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	if publish != nil {
+		t.wg.Add(1)
+		go t.run(ctx)
+	}
+	return t
+}
+
+func (t *Tracker) run(ctx context.Context) {
+	defer t.wg.Done()
+	ticker := time.NewTicker(min(checkInterval, time.Duration(t.config.StaleAfter)/4))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			t.evaluate()
+			t.mu.Unlock()
+		case event := <-t.pending:
+			t.publish <- event
+		}
+	}
+}
+
+// ReceiveSucceeded records a ReceiveMessage call on feed's queue that worked,
+// whether or not it returned any messages.
+func (t *Tracker) ReceiveSucceeded(feed string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queues[feed]; ok {
+		q.lastReceive = t.now()
+		q.errors = 0
+		q.lastError = ""
+	}
+	t.evaluate()
+}
+
+func (t *Tracker) ReceiveFailed(feed string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queues[feed]; ok {
+		q.errors++
+		q.lastError = err.Error()
+	}
+	t.evaluate()
+}
+
+// FilterPolicyApplied records the result of updating the chunk filter policy.
+func (t *Tracker) FilterPolicyApplied(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policyApplied = t.now()
+	t.policyError = ""
+	if err != nil {
+		t.policyError = err.Error()
+	}
+	t.evaluate()
+}
+
+// SetSubscribed records whether feed's SNS subscription exists, or in http
+// ingest mode, whether it has been confirmed.
+func (t *Tracker) SetSubscribed(feed string, subscribed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subscriptions[feed] = subscribed
+	t.evaluate()
+}
+
+// CanarySucceeded records a canary arriving latency after it was sent.
+func (t *Tracker) CanarySucceeded(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.canaryRan = true
+	t.canarySuccess = t.now()
+	t.canaryLatency = latency
+	t.canaryErrors = 0
+	t.canaryError = ""
+	t.evaluate()
+}
+
+// CanaryFailed records a canary that could not be sent or did not arrive.
+func (t *Tracker) CanaryFailed(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.canaryRan = true
+	t.canaryErrors++
+	t.canaryError = err.Error()
+	t.evaluate()
+}
+
+// Stop marks the listener as shutting down, so it is no longer ready. Status
+// changes that have not been published yet are discarded.
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	t.shutdown = true
+	t.evaluate()
+	t.mu.Unlock()
+
+	t.stopped.Store(true)
+	t.cancel()
+	t.wg.Wait()
+}
+
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evaluate()
+
+	report := Report{
+		State:         t.state,
+		Reason:        t.reason,
+		Since:         t.since,
+		Subscriptions: make(map[string]bool, len(t.feeds)),
+	}
+	for _, feed := range t.feeds {
+		report.Subscriptions[feed] = t.subscriptions[feed]
+	}
+	if len(t.queues) > 0 {
+		report.Queues = make(map[string]Queue, len(t.queues))
+		for feed, q := range t.queues {
+			report.Queues[feed] = Queue{
+				LastReceive:       timePtr(q.lastReceive),
+				ConsecutiveErrors: q.errors,
+				LastError:         q.lastError,
+			}
+		}
+	}
+	report.FilterPolicy = FilterPolicy{
+		LastApplied: timePtr(t.policyApplied),
+		LastError:   t.policyError,
+	}
+	if t.canaryRan {
+		report.Canary = &Canary{
+			LastSuccess:         timePtr(t.canarySuccess),
+			ConsecutiveFailures: t.canaryErrors,
+			LastError:           t.canaryError,
+		}
+		if !t.canarySuccess.IsZero() {
+			report.Canary.Latency = t.canaryLatency.String()
+		}
+	}
+	return report
+}
+
+// Status is the service status clients are currently told.
+func (t *Tracker) Status() events.ServiceStatusEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evaluate()
+	return events.ServiceStatusEvent{
+		Type:   events.EventTypeServiceStatus,
+		Status: t.state.Service(),
+		Reason: t.reason,
+		Time:   t.since,
+	}
+}
+
+// Live reports whether the service is worth keeping. It only fails once the
+// listener has been unready for config.RestartAfter, since restarting
+// recreates the queues and subscriptions from scratch.
+func (t *Tracker) Live() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evaluate()
+	return t.state.Ready() || t.now().Sub(t.unreadySince) < time.Duration(t.config.RestartAfter)
+}
+
+// evaluate moves to the state the listener is now in. t.mu must be held.
+func (t *Tracker) evaluate() {
+	state, reason := t.assess(t.now())
+	if state == t.state && reason == t.reason {
+		return
+	}
+	if state != t.state {
+		t.since = t.now()
+		if t.state.Ready() && !state.Ready() {
+			t.unreadySince = t.since
+		}
+		if state == StateHealthy {
+			slog.Info("Listener is healthy", "previous", t.state)
+		} else {
+			slog.Warn("Listener health changed", "state", state, "previous", t.state, "reason", reason)
+		}
+	}
+	previous := t.state.Service()
+	t.state = state
+	t.reason = reason
+	if state.Service() != previous {
+		t.queue(events.ServiceStatusEvent{
+			Type:     events.EventTypeServiceStatus,
+			Status:   state.Service(),
+			Previous: previous,
+			Reason:   reason,
+			Time:     t.since,
+		})
+	}
+}
+
+func (t *Tracker) queue(event events.ServiceStatusEvent) {
+	if t.publish == nil || t.stopped.Load() {
+		return
+	}
+	select {
+	case t.pending <- event:
+	default:
+		slog.Warn("Dropping service status change", "status", event.Status)
+	}
+}
+
+// assess works out the state at now, worst problem first.
+func (t *Tracker) assess(now time.Time) (State, string) {
+	if t.shutdown {
+		return StateDown, "stopped"
+	}
+	// Without the queue's subscription nothing reaches it. In http mode the
+	// confirmation arrives through the server, so traffic must keep flowing
+	// until it does.
+	if t.mode == config.IngestModeSQS {
+		for _, feed := range t.feeds {
+			if !t.subscriptions[feed] {
+				return StateDown, fmt.Sprintf("%s subscription missing", feed)
+			}
+		}
+	}
+	staleAfter := time.Duration(t.config.StaleAfter)
+	for _, feed := range t.feeds {
+		q, ok := t.queues[feed]
+		if !ok {
+			continue
+		}
+		if q.errors >= t.config.ErrorThreshold {
+			return StateDown, fmt.Sprintf("%d %s receives failed in a row: %s", q.errors, feed, q.lastError)
+		}
+		last := q.lastReceive
+		if last.IsZero() {
+			last = t.started
+		}
+		if now.Sub(last) > staleAfter {
+			return StateDown, fmt.Sprintf("no successful %s receive in %s", feed, staleAfter)
+		}
+	}
+	// Receives can succeed while what they receive goes nowhere.
+	if t.canaryErrors >= t.config.ErrorThreshold {
+		return StateDown, fmt.Sprintf("%d canaries in a row failed: %s", t.canaryErrors, t.canaryError)
+	}
+	for _, feed := range t.feeds {
+		if q, ok := t.queues[feed]; ok && q.lastReceive.IsZero() {
+			return StateStarting, fmt.Sprintf("waiting for the first %s receive", feed)
+		}
+	}
+	for _, feed := range t.feeds {
+		if !t.subscriptions[feed] {
+			return StateDegraded, fmt.Sprintf("%s subscription not confirmed", feed)
+		}
+	}
+	for _, feed := range t.feeds {
+		if q, ok := t.queues[feed]; ok && q.errors > 0 {
+			return StateDegraded, fmt.Sprintf("%s receive failed: %s", feed, q.lastError)
+		}
+	}
+	if t.canaryErrors > 0 {
+		return StateDegraded, "canary failed: " + t.canaryError
+	}
+	if t.policyError != "" {
+		return StateDegraded, "filter policy update failed: " + t.policyError
+	}
+	return StateHealthy, ""
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
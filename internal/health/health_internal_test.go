@@ -0,0 +1,194 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+var errReceive = errors.New("connection reset")
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestTracker(mode config.IngestMode) (*Tracker, *clock) {
+	clk := &clock{now: time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)}
+	t := NewTracker(&config.Health{
+		StaleAfter:     config.Duration(time.Minute),
+		ErrorThreshold: 3,
+		RestartAfter:   config.Duration(10 * time.Minute),
+	}, mode, nil, "chunk", "archive")
+	t.now = clk.Now
+	t.started = clk.now
+	t.since = clk.now
+	t.unreadySince = clk.now
+	return t, clk
+}
+
+func wantState(t *testing.T, tracker *Tracker, want State) Report {
+	t.Helper()
+	report := tracker.Report()
+	if report.State != want {
+		t.Fatalf("state = %s (%s), want %s", report.State, report.Reason, want)
+	}
+	return report
+}
+
+func TestTransitions(t *testing.T) {
+	t.Parallel()
+	tracker, clk := newTestTracker(config.IngestModeSQS)
+	wantState(t, tracker, StateDown)
+
+	tracker.SetSubscribed("chunk", true)
+	tracker.SetSubscribed("archive", true)
+	wantState(t, tracker, StateStarting)
+
+	tracker.ReceiveSucceeded("chunk")
+	wantState(t, tracker, StateStarting)
+	tracker.ReceiveSucceeded("archive")
+	wantState(t, tracker, StateHealthy)
+
+	tracker.FilterPolicyApplied(errReceive)
+	wantState(t, tracker, StateDegraded)
+	tracker.FilterPolicyApplied(nil)
+
+	tracker.ReceiveFailed("chunk", errReceive)
+	report := wantState(t, tracker, StateDegraded)
+	if report.Queues["chunk"].ConsecutiveErrors != 1 || report.Queues["chunk"].LastError != errReceive.Error() {
+		t.Errorf("chunk queue = %+v, want the failure recorded", report.Queues["chunk"])
+	}
+	tracker.ReceiveFailed("chunk", errReceive)
+	tracker.ReceiveFailed("chunk", errReceive)
+	wantState(t, tracker, StateDown)
+
+	clk.now = clk.now.Add(time.Second)
+	tracker.ReceiveSucceeded("chunk")
+	report = wantState(t, tracker, StateHealthy)
+	if !report.Since.Equal(clk.now) {
+		t.Errorf("since = %v, want the time of the last transition", report.Since)
+	}
+
+	tracker.Stop()
+	wantState(t, tracker, StateDown)
+}
+
+// A receive loop that hangs reports nothing, so the state has to change with
+// time alone.
+func TestStale(t *testing.T) {
+	t.Parallel()
+	tracker, clk := newTestTracker(config.IngestModeSQS)
+	tracker.SetSubscribed("chunk", true)
+	tracker.SetSubscribed("archive", true)
+	tracker.ReceiveSucceeded("chunk")
+	tracker.ReceiveSucceeded("archive")
+
+	clk.now = clk.now.Add(30 * time.Second)
+	tracker.ReceiveSucceeded("chunk")
+	clk.now = clk.now.Add(45 * time.Second)
+	wantState(t, tracker, StateDown)
+
+	if !tracker.Live() {
+		t.Error("not live straight after going down")
+	}
+	clk.now = clk.now.Add(10 * time.Minute)
+	if tracker.Live() {
+		t.Error("still live after being down for restart_after")
+	}
+}
+
+func TestHTTPMode(t *testing.T) {
+	t.Parallel()
+	tracker, _ := newTestTracker(config.IngestModeHTTP)
+	// The confirmations come through the server, so it must stay ready.
+	report := wantState(t, tracker, StateDegraded)
+	if len(report.Queues) != 0 {
+		t.Errorf("queues = %v, want none in http mode", report.Queues)
+	}
+
+	tracker.SetSubscribed("chunk", true)
+	tracker.SetSubscribed("archive", true)
+	wantState(t, tracker, StateHealthy)
+
+	tracker.SetSubscribed("archive", false)
+	wantState(t, tracker, StateDegraded)
+}
+
+func TestCanary(t *testing.T) {
+	t.Parallel()
+	tracker, _ := newTestTracker(config.IngestModeSQS)
+	tracker.SetSubscribed("chunk", true)
+	tracker.SetSubscribed("archive", true)
+	tracker.ReceiveSucceeded("chunk")
+	tracker.ReceiveSucceeded("archive")
+	if report := wantState(t, tracker, StateHealthy); report.Canary != nil {
+		t.Errorf("canary = %+v, want none before one is sent", report.Canary)
+	}
+
+	tracker.CanaryFailed(errReceive)
+	wantState(t, tracker, StateDegraded)
+	tracker.CanaryFailed(errReceive)
+	tracker.CanaryFailed(errReceive)
+	wantState(t, tracker, StateDown)
+
+	tracker.CanarySucceeded(1500 * time.Millisecond)
+	report := wantState(t, tracker, StateHealthy)
+	if report.Canary.Latency != "1.5s" || report.Canary.ConsecutiveFailures != 0 || report.Canary.LastSuccess == nil {
+		t.Errorf("canary = %+v, want the success recorded", report.Canary)
+	}
+}
+
+func TestPublishesStatusChanges(t *testing.T) {
+	t.Parallel()
+	publish := make(chan events.Event, 8)
+	tracker := NewTracker(&config.Health{
+		StaleAfter:     config.Duration(time.Minute),
+		ErrorThreshold: 3,
+		RestartAfter:   config.Duration(10 * time.Minute),
+	}, config.IngestModeSQS, publish, "chunk", "archive")
+	t.Cleanup(tracker.Stop)
+
+	tracker.SetSubscribed("chunk", true)
+	tracker.SetSubscribed("archive", true)
+	tracker.ReceiveSucceeded("chunk")
+	tracker.ReceiveSucceeded("archive")
+	// Failures short of the threshold change the reason, not the status.
+	tracker.ReceiveFailed("chunk", errReceive)
+	tracker.ReceiveFailed("chunk", errReceive)
+
+	want := []struct {
+		status, previous events.ServiceState
+	}{
+		{events.ServiceDown, events.ServiceDegraded},
+		{events.ServiceDegraded, events.ServiceDown},
+		{events.ServiceHealthy, events.ServiceDegraded},
+		{events.ServiceDegraded, events.ServiceHealthy},
+	}
+	for i, w := range want {
+		select {
+		case event := <-publish:
+			status, ok := event.(events.ServiceStatusEvent)
+			if !ok || status.Status != w.status || status.Previous != w.previous || status.Type != events.EventTypeServiceStatus {
+				t.Errorf("change %d = %+v, want %s after %s", i, event, w.status, w.previous)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("change %d was not published", i)
+		}
+	}
+	select {
+	case event := <-publish:
+		t.Errorf("unexpected change %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if status := tracker.Status(); status.Status != events.ServiceDegraded || status.Reason == "" {
+		t.Errorf("Status() = %+v, want degraded with a reason", status)
+	}
+}
@@ -0,0 +1,188 @@
+package imagery
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+const (
+	// queueSize bounds sweeps waiting to be rendered. Beyond it new sweeps
+	// are skipped rather than stalling the event bus.
+	queueSize  = 16
+	latestName = "latest"
+)
+
+// Subscriptions reports which stations currently have clients.
+type Subscriptions interface {
+	Subscribed(station string) bool
+}
+
+// Imager renders a base reflectivity PNG of every lowest-tilt sweep, keeping
+// the latest per station on disk, and announces each with a NexradImageEvent.
+type Imager struct {
+	config        *config.Imagery
+	registry      *stations.Registry
+	subscriptions Subscriptions
+	publish       chan<- events.Event
+	jobs          chan events.NexradSweepEvent
+
+	consumer *events.Consumer
+}
+
+// NewImager starts rendering the sweeps announced on eventsChannel and
+// publishes the results to publish.
+func NewImager(config *config.Imagery, registry *stations.Registry, subscriptions Subscriptions, eventsChannel <-chan events.Event, publish chan<- events.Event) *Imager {
+	i := &Imager{
+		config:        config,
+		registry:      registry,
+		subscriptions: subscriptions,
+		publish:       publish,
+		jobs:          make(chan events.NexradSweepEvent, queueSize),
+		consumer:      events.NewConsumer(),
+	}
+	i.consumer.Go(i.worker)
+	i.consumer.Consume(eventsChannel, i.handle)
+	return i
+}
+
+// Stop waits for the image being rendered, if any.
+func (i *Imager) Stop() error {
+	i.consumer.Stop()
+	return nil
+}
+
+// LatestPath returns the latest image rendered for station, if there is one.
+func (i *Imager) LatestPath(station string) (string, bool) {
+	station = strings.ToUpper(station)
+	// Station IDs are four letters; anything else could escape the directory.
+	if len(station) != 4 || strings.IndexFunc(station, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return "", false
+	}
+	path := filepath.Join(i.config.Directory, station, latestName+".png")
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func (i *Imager) wanted(station string) bool {
+	if len(i.config.Stations) == 0 {
+		return i.subscriptions.Subscribed(station)
+	}
+	return slices.ContainsFunc(i.config.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+func (i *Imager) handle(event events.Event) {
+	sweep, ok := event.(events.NexradSweepEvent)
+	if !ok || !sweep.LowestTilt || !slices.Contains(sweep.Moments, "REF") || !i.wanted(sweep.Station) {
+		return
+	}
+	select {
+	case i.jobs <- sweep:
+	default:
+		slog.Warn("Image queue full, skipping sweep", "station", sweep.Station, "volume", sweep.VolumeNumber, "elevation", sweep.ElevationNumber)
+	}
+}
+
+func (i *Imager) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sweep := <-i.jobs:
+			i.render(sweep)
+		}
+	}
+}
+
+func (i *Imager) render(sweep events.NexradSweepEvent) {
+	station, ok := i.registry.Lookup(sweep.Station)
+	if !ok {
+		slog.Warn("Station location unknown, skipping image", "station", sweep.Station)
+		return
+	}
+	size := int(i.config.Size)
+	bounds := BoundsFor(station, i.config.Range)
+	img := Render(sweep.Radials, station, bounds, size)
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		slog.Warn("Failed to encode image", "station", sweep.Station, "error", err)
+		return
+	}
+	var world bytes.Buffer
+	if err := WriteWorldFile(&world, bounds, size); err != nil {
+		slog.Warn("Failed to write world file", "station", sweep.Station, "error", err)
+		return
+	}
+
+	dir := filepath.Join(i.config.Directory, station.ICAO)
+	localPath := filepath.Join(dir, latestName+".png")
+	// The world file goes first so the image is never out of place.
+	if err := writeFile(dir, latestName+".pgw", world.Bytes()); err != nil {
+		slog.Warn("Failed to write world file", "station", sweep.Station, "error", err)
+		return
+	}
+	if err := writeFile(dir, latestName+".png", data.Bytes()); err != nil {
+		slog.Warn("Failed to write image", "station", sweep.Station, "error", err)
+		return
+	}
+
+	var scanTime time.Time
+	if len(sweep.Radials) > 0 {
+		scanTime = sweep.Radials[0].Time
+	}
+	slog.Info("Rendered image", "station", station.ICAO, "volume", sweep.VolumeNumber, "elevation", sweep.ElevationNumber, "path", localPath)
+	if i.consumer.Stopped() {
+		return
+	}
+	i.publish <- events.NexradImageEvent{
+		Station:         station.ICAO,
+		VolumeNumber:    sweep.VolumeNumber,
+		VolumeStart:     sweep.VolumeStart,
+		ElevationNumber: sweep.ElevationNumber,
+		Angle:           sweep.Angle,
+		ScanTime:        scanTime,
+		LocalPath:       localPath,
+		URL:             "/api/images/" + station.ICAO + "/" + latestName + ".png",
+		Width:           size,
+		Height:          size,
+		Bounds:          bounds,
+	}
+}
+
+// writeFile replaces dir/name atomically, so readers never see half a file.
+func writeFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// A no-op once the rename has succeeded.
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
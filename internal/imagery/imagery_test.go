@@ -0,0 +1,181 @@
+package imagery_test
+
+import (
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/imagery"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+// lowestSweep decodes elevation 1 from the level2 fixtures, which spans
+// chunks 2 and 3. Its 55 dBZ cell covers azimuths 200-229 and gates 100-159.
+func lowestSweep(t *testing.T) ([]*level2.Radial, stations.Station) {
+	t.Helper()
+	var radials []*level2.Radial
+	for _, name := range []string{"002-I", "003-I"} {
+		data, err := os.ReadFile(filepath.Join("..", "level2", "testdata", "KTLX-20240418-033635-"+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := level2.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, radial := range chunk.Radials {
+			if radial.ElevationNumber == 1 {
+				radials = append(radials, radial)
+			}
+		}
+	}
+	station := stations.Station{ICAO: "KTLX", Latitude: float64(radials[0].Latitude), Longitude: float64(radials[0].Longitude)}
+	return radials, station
+}
+
+// pixel finds the pixel at azimuth degrees and rangeKm from the center of an
+// image of size pixels reaching imageRange.
+func pixel(azimuth, rangeKm, imageRange float64, size int) (int, int) {
+	scale := float64(size) / (2 * imageRange)
+	x := rangeKm * math.Sin(azimuth*math.Pi/180)
+	y := rangeKm * math.Cos(azimuth*math.Pi/180)
+	return int(float64(size)/2 + x*scale), int(float64(size)/2 - y*scale)
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	radials, station := lowestSweep(t)
+	const size, imageRange = 512, 100.0
+	img := imagery.Render(radials, station, imagery.BoundsFor(station, imageRange), size)
+
+	gateRange := func(gate int) float64 { return (2125 + 250*float64(gate)) / 1000 }
+	storm, _ := imagery.ReflectivityColor(55)
+	light, _ := imagery.ReflectivityColor(20)
+	tests := []struct {
+		name    string
+		azimuth float64
+		rangeKm float64
+		want    color.NRGBA
+	}{
+		{"storm cell", 215, gateRange(130), storm},
+		{"light echo", 90.5, gateRange(100), light},
+		{"clear air", 100.5, gateRange(130), color.NRGBA{}},
+		{"beyond the data", 45, 150, color.NRGBA{}},
+	}
+	for _, tt := range tests {
+		x, y := pixel(tt.azimuth, tt.rangeKm, imageRange, size)
+		if got := img.NRGBAAt(x, y); got != tt.want {
+			t.Errorf("%s at (%d, %d) = %v, want %v", tt.name, x, y, got, tt.want)
+		}
+	}
+}
+
+func TestReflectivityColor(t *testing.T) {
+	t.Parallel()
+	if _, ok := imagery.ReflectivityColor(4.5); ok {
+		t.Error("4.5 dBZ should be transparent")
+	}
+	if got, _ := imagery.ReflectivityColor(52); got != (color.NRGBA{0xfd, 0x00, 0x00, 0xff}) {
+		t.Errorf("52 dBZ = %v, want NWS red", got)
+	}
+	if got, _ := imagery.ReflectivityColor(90); got != (color.NRGBA{0xfd, 0xfd, 0xfd, 0xff}) {
+		t.Errorf("90 dBZ = %v, want the top of the table", got)
+	}
+}
+
+type subscribed map[string]bool
+
+func (s subscribed) Subscribed(station string) bool {
+	return s[station]
+}
+
+func TestImager(t *testing.T) {
+	t.Parallel()
+	radials, station := lowestSweep(t)
+	registry := stations.NewRegistry()
+	registry.Observe(station.ICAO, station.Latitude, station.Longitude)
+
+	dir := t.TempDir()
+	in := make(chan events.Event, 10)
+	out := make(chan events.Event, 10)
+	imager := imagery.NewImager(&config.Imagery{Directory: dir, Size: 256, Range: 230}, registry, subscribed{"KTLX": true}, in, out)
+	t.Cleanup(func() {
+		close(in)
+		_ = imager.Stop()
+	})
+
+	volumeStart := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+	sweep := events.NexradSweepEvent{
+		Station:         "KTLX",
+		VolumeNumber:    415,
+		VolumeStart:     volumeStart,
+		ElevationNumber: 1,
+		Angle:           0.48,
+		LowestTilt:      true,
+		Moments:         []string{"REF", "VEL"},
+		Radials:         radials,
+	}
+	// Higher tilts are not rendered.
+	in <- events.NexradSweepEvent{Station: "KTLX", VolumeStart: volumeStart, ElevationNumber: 2, Angle: 0.88, Moments: []string{"REF"}, Radials: radials}
+	in <- sweep
+
+	var got events.NexradImageEvent
+	select {
+	case event := <-out:
+		var ok bool
+		if got, ok = event.(events.NexradImageEvent); !ok {
+			t.Fatalf("got %T, want NexradImageEvent", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an image")
+	}
+	if got.ElevationNumber != 1 || got.URL != "/api/images/KTLX/latest.png" || got.Width != 256 {
+		t.Errorf("unexpected event %+v", got)
+	}
+	if got.Bounds.North <= station.Latitude || got.Bounds.West >= station.Longitude {
+		t.Errorf("Bounds = %+v do not surround the station", got.Bounds)
+	}
+
+	path, ok := imager.LatestPath("ktlx")
+	if !ok || path != got.LocalPath {
+		t.Fatalf("LatestPath = %q, %t, want %q", path, ok, got.LocalPath)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+		t.Errorf("image is %v, want 256x256", img.Bounds())
+	}
+
+	world, err := os.ReadFile(strings.TrimSuffix(path, ".png") + ".pgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(string(world)); len(lines) != 6 {
+		t.Errorf("world file has %d lines, want 6", len(lines))
+	}
+
+	select {
+	case event := <-out:
+		t.Errorf("unexpected second event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, ok := imager.LatestPath("../KTLX"); ok {
+		t.Error("LatestPath accepted a path outside the directory")
+	}
+}
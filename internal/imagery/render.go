@@ -0,0 +1,148 @@
+package imagery
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+const (
+	kmPerDegreeLatitude = 111.32
+	// azimuthBins is the resolution of the azimuth lookup, in bins per degree.
+	azimuthBins = 10
+	// minDBZ is where the color table starts; anything weaker is transparent.
+	minDBZ = 5
+)
+
+// reflectivityColors is the standard NWS base reflectivity table, one entry
+// per 5 dBZ step from minDBZ up.
+//
+//nolint:golint,gochecknoglobals
+var reflectivityColors = []color.NRGBA{
+	{0x04, 0xe9, 0xe7, 0xff}, // 5
+	{0x01, 0x9f, 0xf4, 0xff}, // 10
+	{0x03, 0x00, 0xf4, 0xff}, // 15
+	{0x02, 0xfd, 0x02, 0xff}, // 20
+	{0x01, 0xc5, 0x01, 0xff}, // 25
+	{0x00, 0x8e, 0x00, 0xff}, // 30
+	{0xfd, 0xf8, 0x02, 0xff}, // 35
+	{0xe5, 0xbc, 0x00, 0xff}, // 40
+	{0xfd, 0x95, 0x00, 0xff}, // 45
+	{0xfd, 0x00, 0x00, 0xff}, // 50
+	{0xd4, 0x00, 0x00, 0xff}, // 55
+	{0xbc, 0x00, 0x00, 0xff}, // 60
+	{0xf8, 0x00, 0xfd, 0xff}, // 65
+	{0x98, 0x54, 0xc6, 0xff}, // 70
+	{0xfd, 0xfd, 0xfd, 0xff}, // 75+
+}
+
+// ReflectivityColor returns the table color for dbz, and false below it.
+func ReflectivityColor(dbz float32) (color.NRGBA, bool) {
+	if dbz < minDBZ {
+		return color.NRGBA{}, false
+	}
+	i := min(int(dbz-minDBZ)/5, len(reflectivityColors)-1)
+	return reflectivityColors[i], true
+}
+
+// BoundsFor returns the extent of a square image reaching rangeKm from the
+// station in each direction.
+func BoundsFor(station stations.Station, rangeKm float64) events.ImageBounds {
+	dLat := rangeKm / kmPerDegreeLatitude
+	dLon := rangeKm / (kmPerDegreeLatitude * math.Cos(station.Latitude*math.Pi/180))
+	return events.ImageBounds{
+		North: station.Latitude + dLat,
+		South: station.Latitude - dLat,
+		East:  station.Longitude + dLon,
+		West:  station.Longitude - dLon,
+	}
+}
+
+// Render draws base reflectivity from radials onto a size×size image
+// covering bounds in an equirectangular (plate carrée) projection, so each
+// pixel is a fixed step of latitude and longitude.
+func Render(radials []*level2.Radial, station stations.Station, bounds events.ImageBounds, size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	lookup := azimuthLookup(radials)
+	cosLat := math.Cos(station.Latitude * math.Pi / 180)
+	dLat := (bounds.North - bounds.South) / float64(size)
+	dLon := (bounds.East - bounds.West) / float64(size)
+
+	for py := range size {
+		// Distances are from a local flat-earth approximation, which is
+		// well within a pixel over a radar's range.
+		y := (bounds.North - (float64(py)+0.5)*dLat - station.Latitude) * kmPerDegreeLatitude
+		for px := range size {
+			x := (bounds.West + (float64(px)+0.5)*dLon - station.Longitude) * kmPerDegreeLatitude * cosLat
+			azimuth := math.Atan2(x, y) * 180 / math.Pi
+			if azimuth < 0 {
+				azimuth += 360
+			}
+			index := lookup[int(azimuth*azimuthBins)%len(lookup)]
+			if index < 0 {
+				continue
+			}
+			ref := radials[index].Moments["REF"]
+			rangeM := math.Hypot(x, y) * 1000
+			gate := int(math.Round((rangeM - ref.FirstGate) / ref.GateSpacing))
+			dbz, ok := ref.Value(gate)
+			if !ok {
+				continue
+			}
+			if c, ok := ReflectivityColor(dbz); ok {
+				img.SetNRGBA(px, py, c)
+			}
+		}
+	}
+	return img
+}
+
+// azimuthLookup maps each azimuth bin to the index of the radial covering it,
+// or -1 where none does. Only radials with reflectivity are used.
+func azimuthLookup(radials []*level2.Radial) []int {
+	lookup := make([]int, 360*azimuthBins)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+	var indexes []int
+	for i, radial := range radials {
+		if radial.Moments["REF"] != nil {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return lookup
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		return radials[indexes[a]].Azimuth < radials[indexes[b]].Azimuth
+	})
+
+	// Each radial covers half the nominal spacing either side, so a missing
+	// radial leaves a gap rather than smearing its neighbours.
+	halfWidth := max(180/float64(len(indexes)), 0.25)
+	for _, i := range indexes {
+		center := float64(radials[i].Azimuth)
+		first := int(math.Floor((center - halfWidth) * azimuthBins))
+		last := int(math.Ceil((center + halfWidth) * azimuthBins))
+		for bin := first; bin < last; bin++ {
+			lookup[(bin%len(lookup)+len(lookup))%len(lookup)] = i
+		}
+	}
+	return lookup
+}
+
+// WriteWorldFile writes the ESRI world file that places an image of size
+// pixels square on bounds.
+func WriteWorldFile(w io.Writer, bounds events.ImageBounds, size int) error {
+	dLat := (bounds.North - bounds.South) / float64(size)
+	dLon := (bounds.East - bounds.West) / float64(size)
+	_, err := fmt.Fprintf(w, "%.10f\n0\n0\n%.10f\n%.10f\n%.10f\n", dLon, -dLat, bounds.West+dLon/2, bounds.North-dLat/2)
+	return err
+}
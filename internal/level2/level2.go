@@ -0,0 +1,367 @@
+package level2
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	volumeHeaderSize  = 24
+	ctmHeaderSize     = 12
+	messageHeaderSize = 16
+	// Messages other than 31 occupy fixed-size segments in the archive.
+	segmentSize = 2432
+
+	messageTypeVCP     = 5
+	messageTypeDigital = 31
+
+	// Message 5 holds an 11 halfword header, then a 23 halfword entry per
+	// elevation cut.
+	vcpHeaderSize = 22
+	vcpCutSize    = 46
+
+	// maxRecordSize caps one decompressed LDM record so a corrupt size word
+	// can't exhaust memory. Real records hold 120 radials, a few MiB at most.
+	maxRecordSize = 64 << 20
+)
+
+var (
+	ErrTruncated      = errors.New("level 2 data is truncated")
+	ErrInvalidRecord  = errors.New("invalid LDM record")
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// RadialStatus marks where a radial falls in its elevation and volume.
+type RadialStatus uint8
+
+const (
+	RadialStatusStartOfElevation     RadialStatus = 0
+	RadialStatusIntermediate         RadialStatus = 1
+	RadialStatusEndOfElevation       RadialStatus = 2
+	RadialStatusStartOfVolume        RadialStatus = 3
+	RadialStatusEndOfVolume          RadialStatus = 4
+	RadialStatusStartOfLastElevation RadialStatus = 5
+)
+
+// StartsElevation reports whether the radial is the first of its elevation cut.
+func (s RadialStatus) StartsElevation() bool {
+	return s == RadialStatusStartOfElevation || s == RadialStatusStartOfVolume || s == RadialStatusStartOfLastElevation
+}
+
+// EndsElevation reports whether the radial is the last of its elevation cut.
+func (s RadialStatus) EndsElevation() bool {
+	return s == RadialStatusEndOfElevation || s == RadialStatusEndOfVolume
+}
+
+// Waveform is how the radar samples an elevation cut.
+type Waveform uint8
+
+const (
+	WaveformContiguousSurveillance       Waveform = 1
+	WaveformContiguousDoppler            Waveform = 2
+	WaveformContiguousDopplerNoAmbiguity Waveform = 3
+	WaveformBatch                        Waveform = 4
+	WaveformStaggeredPulsePair           Waveform = 5
+)
+
+// Surveillance reports whether the cut is the surveillance half of a split
+// cut, rather than the Doppler half that repeats its angle.
+func (w Waveform) Surveillance() bool {
+	return w == WaveformContiguousSurveillance
+}
+
+// Cut is one elevation cut of the VCP, as listed in Message 5.
+type Cut struct {
+	// Angle is in degrees.
+	Angle    float64
+	Waveform Waveform
+}
+
+// VolumeHeader is the 24-byte Archive II header that starts every volume,
+// and so every S chunk.
+type VolumeHeader struct {
+	// Version is the tape filename, e.g. AR2V0006.
+	Version   string
+	Extension string
+	Time      time.Time
+	ICAO      string
+}
+
+// Moment is one data moment of a radial, e.g. reflectivity.
+type Moment struct {
+	Name string
+	// FirstGate and GateSpacing are in meters.
+	FirstGate   float64
+	GateSpacing float64
+	Gates       int
+	WordSize    int
+	Scale       float32
+	Offset      float32
+	data        []byte
+}
+
+// Value returns the decoded value of gate i. It reports false for gates that
+// are below threshold or range folded.
+func (m *Moment) Value(i int) (float32, bool) {
+	if i < 0 || i >= m.Gates {
+		return 0, false
+	}
+	var raw uint16
+	if m.WordSize == 16 {
+		raw = binary.BigEndian.Uint16(m.data[i*2:])
+	} else {
+		raw = uint16(m.data[i])
+	}
+	// 0 is below threshold and 1 is range folded.
+	if raw < 2 || m.Scale == 0 {
+		return 0, false
+	}
+	return (float32(raw) - m.Offset) / m.Scale, true
+}
+
+// Radial is a Message 31 digital radar data radial.
+type Radial struct {
+	ICAO            string
+	Time            time.Time
+	AzimuthNumber   int
+	Azimuth         float32
+	Status          RadialStatus
+	ElevationNumber int
+	Elevation       float32
+	// VCP, Latitude and Longitude come from the volume data block, which
+	// every radial should carry.
+	VCP       int
+	Latitude  float32
+	Longitude float32
+	Moments   map[string]*Moment
+}
+
+// Chunk is everything decoded from one real-time chunk or volume file.
+type Chunk struct {
+	// Header is only present in S chunks and whole volumes.
+	Header  *VolumeHeader
+	Radials []*Radial
+	// VCP is the volume coverage pattern from Message 5 or, failing that,
+	// the radials' volume data blocks.
+	VCP int
+	// Cuts are the VCP's elevation cuts, in order, from Message 5. Only S
+	// chunks and whole volumes carry it.
+	Cuts []Cut
+}
+
+// Decode parses an Archive II volume or a chunk of one: an optional volume
+// header followed by bzip2-compressed LDM records.
+func Decode(data []byte) (*Chunk, error) {
+	chunk := &Chunk{}
+	if bytes.HasPrefix(data, []byte("AR2V")) {
+		if len(data) < volumeHeaderSize {
+			return nil, ErrTruncated
+		}
+		header, err := parseVolumeHeader(data[:volumeHeaderSize])
+		if err != nil {
+			return nil, err
+		}
+		chunk.Header = header
+		data = data[volumeHeaderSize:]
+	}
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, ErrTruncated
+		}
+		// The sign of the control word only flags the last record.
+		size := int(int32(binary.BigEndian.Uint32(data)))
+		if size < 0 {
+			size = -size
+		}
+		data = data[4:]
+		if size == 0 || size > len(data) {
+			return nil, fmt.Errorf("%w: size %d with %d bytes left", ErrInvalidRecord, size, len(data))
+		}
+		record, err := io.ReadAll(io.LimitReader(bzip2.NewReader(bytes.NewReader(data[:size])), maxRecordSize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRecord, err)
+		}
+		data = data[size:]
+		if err := chunk.parseMessages(record); err != nil {
+			return nil, err
+		}
+	}
+
+	if chunk.VCP == 0 {
+		for _, radial := range chunk.Radials {
+			if radial.VCP != 0 {
+				chunk.VCP = radial.VCP
+				break
+			}
+		}
+	}
+	return chunk, nil
+}
+
+func parseVolumeHeader(data []byte) (*VolumeHeader, error) {
+	version, extension, ok := strings.Cut(string(data[:12]), ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed volume header", ErrInvalidRecord)
+	}
+	days := binary.BigEndian.Uint32(data[12:])
+	millis := binary.BigEndian.Uint32(data[16:])
+	return &VolumeHeader{
+		Version:   version,
+		Extension: extension,
+		Time:      julianTime(days, millis),
+		ICAO:      strings.TrimRight(string(data[20:24]), "\x00 "),
+	}, nil
+}
+
+// julianTime converts NEXRAD's modified Julian date, where day 1 is
+// 1970-01-01, and milliseconds past midnight.
+func julianTime(days, millis uint32) time.Time {
+	return time.Unix(int64(days-1)*86400, 0).UTC().Add(time.Duration(millis) * time.Millisecond)
+}
+
+func (c *Chunk) parseMessages(record []byte) error {
+	for offset := 0; offset+ctmHeaderSize+messageHeaderSize <= len(record); {
+		header := record[offset+ctmHeaderSize:]
+		size := int(binary.BigEndian.Uint16(header)) * 2
+		messageType := header[3]
+
+		advance := segmentSize
+		if messageType == messageTypeDigital {
+			if size < messageHeaderSize {
+				return fmt.Errorf("%w: message 31 of %d bytes", ErrInvalidMessage, size)
+			}
+			advance = ctmHeaderSize + size
+		}
+		if offset+advance > len(record) {
+			if messageType == messageTypeDigital {
+				return ErrTruncated
+			}
+			// The trailing segment of a record may be short.
+			advance = len(record) - offset
+		}
+		body := record[offset+ctmHeaderSize+messageHeaderSize : offset+advance]
+
+		switch messageType {
+		case messageTypeDigital:
+			radial, err := parseRadial(body)
+			if err != nil {
+				return err
+			}
+			c.Radials = append(c.Radials, radial)
+		case messageTypeVCP:
+			if len(body) >= 6 {
+				c.VCP = int(binary.BigEndian.Uint16(body[4:]))
+			}
+			c.Cuts = parseCuts(body)
+		}
+		offset += advance
+	}
+	return nil
+}
+
+// parseCuts reads the elevation table of a Message 5 body, or nothing if it
+// is missing or truncated.
+func parseCuts(body []byte) []Cut {
+	if len(body) < vcpHeaderSize {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(body[6:]))
+	if len(body) < vcpHeaderSize+n*vcpCutSize {
+		return nil
+	}
+	cuts := make([]Cut, n)
+	for i := range cuts {
+		entry := body[vcpHeaderSize+i*vcpCutSize:]
+		cuts[i] = Cut{
+			// Angles are coded in units of 360/65536 degrees.
+			Angle:    float64(binary.BigEndian.Uint16(entry)) * 360 / 65536,
+			Waveform: Waveform(entry[3]),
+		}
+	}
+	return cuts
+}
+
+func float32At(data []byte, offset int) float32 {
+	return math.Float32frombits(binary.BigEndian.Uint32(data[offset:]))
+}
+
+func parseRadial(body []byte) (*Radial, error) {
+	const fixedSize = 32
+	if len(body) < fixedSize {
+		return nil, fmt.Errorf("%w: radial header truncated", ErrInvalidMessage)
+	}
+	radial := &Radial{
+		ICAO:            strings.TrimRight(string(body[0:4]), "\x00 "),
+		Time:            julianTime(uint32(binary.BigEndian.Uint16(body[8:])), binary.BigEndian.Uint32(body[4:])),
+		AzimuthNumber:   int(binary.BigEndian.Uint16(body[10:])),
+		Azimuth:         float32At(body, 12),
+		Status:          RadialStatus(body[21]),
+		ElevationNumber: int(body[22]),
+		Elevation:       float32At(body, 24),
+		Moments:         make(map[string]*Moment),
+	}
+
+	blocks := int(binary.BigEndian.Uint16(body[30:]))
+	if len(body) < fixedSize+blocks*4 {
+		return nil, fmt.Errorf("%w: data block pointers truncated", ErrInvalidMessage)
+	}
+	for i := range blocks {
+		pointer := int(binary.BigEndian.Uint32(body[fixedSize+i*4:]))
+		if pointer == 0 {
+			continue
+		}
+		if pointer+4 > len(body) {
+			return nil, fmt.Errorf("%w: data block pointer %d out of range", ErrInvalidMessage, pointer)
+		}
+		block := body[pointer:]
+		name := strings.TrimSpace(string(block[1:4]))
+		switch block[0] {
+		case 'R':
+			if name == "VOL" && len(block) >= 44 {
+				radial.Latitude = float32At(block, 8)
+				radial.Longitude = float32At(block, 12)
+				radial.VCP = int(binary.BigEndian.Uint16(block[40:]))
+			}
+		case 'D':
+			moment, err := parseMoment(name, block)
+			if err != nil {
+				return nil, err
+			}
+			radial.Moments[name] = moment
+		}
+	}
+	return radial, nil
+}
+
+func parseMoment(name string, block []byte) (*Moment, error) {
+	const headerSize = 28
+	if len(block) < headerSize {
+		return nil, fmt.Errorf("%w: %s block truncated", ErrInvalidMessage, name)
+	}
+	moment := &Moment{
+		Name:        name,
+		Gates:       int(binary.BigEndian.Uint16(block[8:])),
+		FirstGate:   float64(binary.BigEndian.Uint16(block[10:])),
+		GateSpacing: float64(binary.BigEndian.Uint16(block[12:])),
+		WordSize:    int(block[19]),
+		Scale:       float32At(block, 20),
+		Offset:      float32At(block, 24),
+	}
+	if moment.WordSize != 8 && moment.WordSize != 16 {
+		return nil, fmt.Errorf("%w: %s word size %d", ErrInvalidMessage, name, moment.WordSize)
+	}
+	size := moment.Gates * moment.WordSize / 8
+	if len(block) < headerSize+size {
+		return nil, fmt.Errorf("%w: %s data truncated", ErrInvalidMessage, name)
+	}
+	moment.data = block[headerSize : headerSize+size]
+	return moment, nil
+}
@@ -0,0 +1,128 @@
+package level2_test
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+)
+
+// The fixtures are generated by testdata/generate.py.
+func decodeFixture(t *testing.T, name string) *level2.Chunk {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, err := level2.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode(%s) unexpected error: %v", name, err)
+	}
+	return chunk
+}
+
+func TestDecodeStartChunk(t *testing.T) {
+	t.Parallel()
+
+	chunk := decodeFixture(t, "KTLX-20240418-033635-001-S")
+	want := level2.VolumeHeader{
+		Version:   "AR2V0006",
+		Extension: "415",
+		Time:      time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		ICAO:      "KTLX",
+	}
+	if chunk.Header == nil || *chunk.Header != want {
+		t.Errorf("Header = %+v, want %+v", chunk.Header, want)
+	}
+	if chunk.VCP != 212 {
+		t.Errorf("VCP = %d, want 212 from Message 5", chunk.VCP)
+	}
+	if len(chunk.Cuts) != 2 {
+		t.Fatalf("got %d cuts, want 2", len(chunk.Cuts))
+	}
+	for i, angle := range []float64{0.5, 0.9} {
+		cut := chunk.Cuts[i]
+		if math.Abs(cut.Angle-angle) > 0.01 || !cut.Waveform.Surveillance() {
+			t.Errorf("cut %d = %+v, want surveillance at %v", i+1, cut, angle)
+		}
+	}
+	if len(chunk.Radials) != 0 {
+		t.Errorf("got %d radials, want none", len(chunk.Radials))
+	}
+}
+
+func TestDecodeRadials(t *testing.T) {
+	t.Parallel()
+
+	chunk := decodeFixture(t, "KTLX-20240418-033635-003-I")
+	if chunk.Header != nil {
+		t.Errorf("Header = %+v, want none in an I chunk", chunk.Header)
+	}
+	if chunk.VCP != 212 {
+		t.Errorf("VCP = %d, want 212 from the volume data blocks", chunk.VCP)
+	}
+	// 180 radials end elevation 1, then 120 start elevation 2.
+	if len(chunk.Radials) != 300 {
+		t.Fatalf("got %d radials, want 300", len(chunk.Radials))
+	}
+
+	first, last, next := chunk.Radials[0], chunk.Radials[179], chunk.Radials[180]
+	if first.ICAO != "KTLX" || first.ElevationNumber != 1 || first.AzimuthNumber != 181 || first.Status != level2.RadialStatusIntermediate {
+		t.Errorf("unexpected first radial %+v", first)
+	}
+	if last.ElevationNumber != 1 || !last.Status.EndsElevation() {
+		t.Errorf("radial 179 = elevation %d status %d, want the end of elevation 1", last.ElevationNumber, last.Status)
+	}
+	if next.ElevationNumber != 2 || !next.Status.StartsElevation() || next.Elevation < 0.87 || next.Elevation > 0.89 {
+		t.Errorf("radial 180 = elevation %d (%f) status %d, want the start of elevation 2", next.ElevationNumber, next.Elevation, next.Status)
+	}
+	if first.Latitude < 35.33 || first.Latitude > 35.34 || first.Longitude > -97.27 || first.Longitude < -97.28 {
+		t.Errorf("location = %f, %f, want KTLX", first.Latitude, first.Longitude)
+	}
+
+	// Azimuth 200 passes through the 55 dBZ cell at gates 100-159.
+	ref := chunk.Radials[20].Moments["REF"]
+	if ref == nil {
+		t.Fatal("radial has no reflectivity")
+	}
+	if ref.Gates != 460 || ref.FirstGate != 2125 || ref.GateSpacing != 250 {
+		t.Errorf("REF geometry = %d gates from %.0fm every %.0fm", ref.Gates, ref.FirstGate, ref.GateSpacing)
+	}
+	if v, ok := ref.Value(120); !ok || v != 55 {
+		t.Errorf("REF gate 120 = %f, %t, want 55", v, ok)
+	}
+	if _, ok := ref.Value(300); ok {
+		t.Error("REF gate 300 should be below threshold")
+	}
+	if v, ok := chunk.Radials[20].Moments["VEL"].Value(100); !ok || v != -5 {
+		t.Errorf("VEL gate 100 = %f, %t, want -5", v, ok)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "KTLX-20240418-033635-002-I"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"short volume header", []byte("AR2V0006.4"), level2.ErrTruncated},
+		{"short size word", []byte{0, 0}, level2.ErrTruncated},
+		{"size past end", data[:100], level2.ErrInvalidRecord},
+		{"not bzip2", []byte{0, 0, 0, 4, 'n', 'o', 'p', 'e'}, level2.ErrInvalidRecord},
+	}
+	for _, tt := range tests {
+		if _, err := level2.Decode(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+#!/usr/bin/env python3
+"""Generates the synthetic KTLX real-time chunks used as test fixtures.
+
+They follow the Archive II layout closely enough for the decoder: a volume
+header in the S chunk, then bzip2-compressed LDM records holding Message 5
+and Message 31 radials. Elevation 1 (0.5 deg) spans chunks 2 and 3, elevation
+2 (0.9 deg) spans chunks 3 and 4. A 55 dBZ cell sits at azimuths 200-229,
+gates 100-159 of both elevations.
+
+Run from this directory: python3 generate.py
+"""
+
+import bz2
+import struct
+
+STATION = b"KTLX"
+VCP = 212
+LATITUDE = 35.3331
+LONGITUDE = -97.2778
+# 2024-04-18 03:36:35 UTC as NEXRAD modified Julian days and milliseconds.
+DAYS = 19831 + 1
+MILLIS = (3 * 3600 + 36 * 60 + 35) * 1000
+PREFIX = "KTLX-20240418-033635-"
+
+GATES = 460
+FIRST_GATE = 2125
+GATE_SPACING = 250
+REF_SCALE, REF_OFFSET = 2.0, 66.0
+VEL_SCALE, VEL_OFFSET = 2.0, 129.0
+
+
+def message_header(size, msg_type, seq):
+    # size is in halfwords and includes this 16 byte header.
+    return struct.pack(">HBBHHIHH", size // 2, 0, msg_type, seq, DAYS, MILLIS, 1, 1)
+
+
+def vcp_message():
+    # Both cuts are contiguous surveillance (waveform 1), with angles coded
+    # in units of 360/65536 degrees.
+    cuts = b"".join(struct.pack(">HBB", round(angle * 65536 / 360), 0, 1) + bytes(42) for angle in (0.5, 0.9))
+    body = struct.pack(">HHHH", (22 + len(cuts)) // 2, 2, VCP, 2) + bytes(14) + cuts
+    header = message_header(16 + len(body), 5, 0)
+    segment = bytes(12) + header + body
+    return segment + bytes(2432 - len(segment))
+
+
+def moment(name, values, scale, offset):
+    header = b"D" + name + struct.pack(
+        ">IHHHHhBBff", 0, GATES, FIRST_GATE, GATE_SPACING, 0, 0, 0, 8, scale, offset
+    )
+    return header + bytes(values)
+
+
+def reflectivity(azimuth):
+    values = []
+    for gate in range(GATES):
+        dbz = None
+        if 200 <= azimuth < 230 and 100 <= gate < 160:
+            dbz = 55.0
+        elif 60 <= gate < 200 and azimuth % 3 == 0:
+            dbz = 20.0
+        values.append(0 if dbz is None else int(dbz * REF_SCALE + REF_OFFSET))
+    return values
+
+
+def velocity():
+    return [int(-5.0 * VEL_SCALE + VEL_OFFSET) if 60 <= gate < 200 else 0 for gate in range(GATES)]
+
+
+def radial(azimuth, status, elevation_number, elevation, seq):
+    vol = b"RVOL" + struct.pack(
+        ">HBBffhHfffffHH", 44, 1, 0, LATITUDE, LONGITUDE, 370, 20, 0, 0, 0, 0, 0, VCP, 0
+    )
+    blocks = [
+        vol,
+        moment(b"REF", reflectivity(azimuth), REF_SCALE, REF_OFFSET),
+        moment(b"VEL", velocity(), VEL_SCALE, VEL_OFFSET),
+    ]
+    fixed = 32 + 4 * len(blocks)
+    pointers = []
+    offset = fixed
+    for block in blocks:
+        pointers.append(offset)
+        offset += len(block)
+    body = STATION + struct.pack(
+        ">IHHfBBHBBBBfBBH",
+        MILLIS + azimuth * 50,
+        DAYS,
+        azimuth + 1,
+        azimuth + 0.5,
+        0,
+        0,
+        offset,
+        1,
+        status,
+        elevation_number,
+        0,
+        elevation,
+        0,
+        0,
+        len(blocks),
+    )
+    body += b"".join(struct.pack(">I", p) for p in pointers) + b"".join(blocks)
+    return bytes(12) + message_header(16 + len(body), 31, seq) + body
+
+
+def record(messages):
+    data = bz2.compress(b"".join(messages))
+    return struct.pack(">i", len(data)) + data
+
+
+def sweep(elevation_number, elevation, azimuths, first, last):
+    out = []
+    for azimuth in azimuths:
+        status = 1
+        if azimuth == 0:
+            status = first
+        elif azimuth == 359:
+            status = last
+        out.append(radial(azimuth, status, elevation_number, elevation, azimuth))
+    return out
+
+
+def records(radials):
+    # Real-time chunks hold up to 120 radials per LDM record.
+    return b"".join(record(radials[i : i + 120]) for i in range(0, len(radials), 120))
+
+
+def main():
+    header = b"AR2V0006." + b"415" + struct.pack(">II", DAYS, MILLIS) + STATION
+    chunks = {
+        "001-S": header + record([vcp_message()]),
+        "002-I": records(sweep(1, 0.48, range(0, 180), 3, 2)),
+        "003-I": records(sweep(1, 0.48, range(180, 360), 3, 2) + sweep(2, 0.88, range(0, 120), 0, 4)),
+        "004-E": records(sweep(2, 0.88, range(120, 360), 0, 4)),
+    }
+    for suffix, data in chunks.items():
+        with open(PREFIX + suffix, "wb") as f:
+            f.write(data)
+
+
+if __name__ == "__main__":
+    main()
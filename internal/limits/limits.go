@@ -0,0 +1,139 @@
+package limits
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// pruneInterval is how often the connect rates of clients that have stopped
+// connecting are forgotten.
+const pruneInterval = time.Minute
+
+var (
+	ErrRateLimited   = errors.New("connecting too often")
+	ErrServerFull    = errors.New("too many connections")
+	ErrTooManyFromIP = errors.New("too many connections from this address")
+	ErrTooManyForKey = errors.New("too many subscriptions for this key")
+)
+
+// Reason labels for rejected connections.
+const (
+	reasonRate  = "rate"
+	reasonTotal = "total"
+	reasonIP    = "ip"
+	reasonKey   = "key"
+)
+
+// Limiter counts the websocket connections open, by client IP and by API key,
+// and how often each client IP connects, turning away those over the
+// configured limits.
+type Limiter struct {
+	config *config.Limits
+
+	mu     sync.Mutex
+	total  uint
+	perIP  map[string]uint
+	perKey map[string]uint
+	// rates are by client IP, and only kept while a client's burst is being
+	// refilled.
+	rates     map[string]*rate.Limiter
+	lastPrune time.Time
+}
+
+func NewLimiter(cfg *config.Limits) *Limiter {
+	return &Limiter{
+		config:    cfg,
+		perIP:     make(map[string]uint),
+		perKey:    make(map[string]uint),
+		rates:     make(map[string]*rate.Limiter),
+		lastPrune: time.Now(),
+	}
+}
+
+// Connect records a connection attempt from ip. When ip has used up its burst
+// it returns ErrRateLimited and how long until it may try again.
+func (l *Limiter) Connect(ip string) (time.Duration, error) {
+	if l.config.ConnectRate <= 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	limiter, ok := l.rates[ip]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(l.config.ConnectRate), int(l.config.ConnectBurst))
+		l.rates[ip] = limiter
+	}
+	reservation := limiter.ReserveN(now, 1)
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		// A refused attempt doesn't count against the next one.
+		reservation.CancelAt(now)
+		metrics.WebsocketRejections.WithLabelValues(reasonRate).Inc()
+		return wait, ErrRateLimited
+	}
+	return 0, nil
+}
+
+// prune forgets the clients whose burst has refilled, as a new limiter would
+// treat them the same.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for ip, limiter := range l.rates {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.rates, ip)
+		}
+	}
+}
+
+// Acquire counts a connection from ip, subscribing with key, until release is
+// called. key is empty when auth is disabled, and isn't limited.
+func (l *Limiter) Acquire(ip, key string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit := l.config.MaxConnections; limit > 0 && l.total >= limit {
+		metrics.WebsocketRejections.WithLabelValues(reasonTotal).Inc()
+		return nil, ErrServerFull
+	}
+	if limit := l.config.MaxConnectionsPerIP; limit > 0 && l.perIP[ip] >= limit {
+		metrics.WebsocketRejections.WithLabelValues(reasonIP).Inc()
+		return nil, ErrTooManyFromIP
+	}
+	if limit := l.config.MaxSubscriptionsPerKey; limit > 0 && key != "" && l.perKey[key] >= limit {
+		metrics.WebsocketRejections.WithLabelValues(reasonKey).Inc()
+		return nil, ErrTooManyForKey
+	}
+
+	l.total++
+	l.perIP[ip]++
+	if key != "" {
+		l.perKey[key]++
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(ip, key) })
+	}, nil
+}
+
+func (l *Limiter) release(ip, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] == 0 {
+		delete(l.perIP, ip)
+	}
+	if key != "" {
+		if l.perKey[key]--; l.perKey[key] == 0 {
+			delete(l.perKey, key)
+		}
+	}
+}
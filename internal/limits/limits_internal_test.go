@@ -0,0 +1,86 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(&config.Limits{MaxConnections: 4, MaxConnectionsPerIP: 2, MaxSubscriptionsPerKey: 2})
+
+	release, err := l.Acquire("192.0.2.1", "dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire("192.0.2.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire("192.0.2.1", ""); !errors.Is(err, ErrTooManyFromIP) {
+		t.Errorf("third connection from one IP error = %v, want ErrTooManyFromIP", err)
+	}
+	if _, err := l.Acquire("192.0.2.2", "dashboard"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire("192.0.2.3", "dashboard"); !errors.Is(err, ErrTooManyForKey) {
+		t.Errorf("third subscription for one key error = %v, want ErrTooManyForKey", err)
+	}
+	if _, err := l.Acquire("192.0.2.3", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire("192.0.2.4", ""); !errors.Is(err, ErrServerFull) {
+		t.Errorf("fifth connection error = %v, want ErrServerFull", err)
+	}
+
+	// Releasing twice must not free a second slot.
+	release()
+	release()
+	if _, err := l.Acquire("192.0.2.1", "dashboard"); err != nil {
+		t.Errorf("connection after release error = %v", err)
+	}
+	if _, err := l.Acquire("192.0.2.4", ""); !errors.Is(err, ErrServerFull) {
+		t.Errorf("connection after a double release error = %v, want ErrServerFull", err)
+	}
+}
+
+func TestAcquireUnlimited(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(&config.Limits{})
+	for range 100 {
+		if _, err := l.Acquire("192.0.2.1", "dashboard"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 100 {
+		if _, err := l.Connect("192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(&config.Limits{ConnectRate: 1, ConnectBurst: 2})
+
+	for range 2 {
+		if _, err := l.Connect("192.0.2.1"); err != nil {
+			t.Fatalf("connect within burst error = %v", err)
+		}
+	}
+	wait, err := l.Connect("192.0.2.1")
+	if !errors.Is(err, ErrRateLimited) || wait <= 0 || wait > time.Second {
+		t.Errorf("connect past burst = %s, %v, want ErrRateLimited within a second", wait, err)
+	}
+	if _, err := l.Connect("192.0.2.2"); err != nil {
+		t.Errorf("connect from another IP error = %v", err)
+	}
+
+	// Clients whose burst has refilled are forgotten.
+	l.prune(time.Now().Add(time.Hour))
+	if len(l.rates) != 0 {
+		t.Errorf("rates = %v, want none left after pruning", l.rates)
+	}
+}
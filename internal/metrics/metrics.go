@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "nexrad_aws_notifier"
+
+// Queue labels name the feed a message came from, whether it was received
+// from an SQS queue or delivered over HTTP by SNS.
+const (
+	QueueChunk   = "chunk"
+	QueueArchive = "archive"
+)
+
+// Result labels.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+//nolint:golint,gochecknoglobals
+var (
+	SQSReceives = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sqs",
+		Name:      "receives_total",
+		Help:      "ReceiveMessage calls by queue and result.",
+	}, []string{"queue", "result"})
+
+	SQSMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sqs",
+		Name:      "messages_total",
+		Help:      "Notifications received by queue.",
+	}, []string{"queue"})
+
+	SQSParseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sqs",
+		Name:      "parse_failures_total",
+		Help:      "Notifications, or records within them, that could not be turned into events, by queue.",
+	}, []string{"queue"})
+
+	SQSDeleteFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sqs",
+		Name:      "delete_failures_total",
+		Help:      "DeleteMessage calls that failed, by queue.",
+	}, []string{"queue"})
+
+	FilterPolicyUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sns",
+		Name:      "set_subscription_attributes_total",
+		Help:      "SetSubscriptionAttributes calls made to update the chunk filter policy, by result.",
+	}, []string{"result"})
+
+	FilterPolicyLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sns",
+		Name:      "set_subscription_attributes_duration_seconds",
+		Help:      "How long SetSubscriptionAttributes calls take.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	EventQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "queue_depth",
+		Help:      "Events waiting to be fanned out by the event bus.",
+	})
+
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "published_total",
+		Help:      "Events published on the event bus, by type and station.",
+	}, []string{"type", "station"})
+
+	WebsocketSubscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "subscribers",
+		Help:      "Connected websocket clients, by event type and station.",
+	}, []string{"type", "station"})
+
+	WebsocketDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "dropped_events_total",
+		Help:      "Events dropped because a client's buffer was full, by event type and station.",
+	}, []string{"type", "station"})
+
+	DeliveryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "delivery_latency_seconds",
+		Help:      "Time from SNS publishing a notification to its event being written to a websocket client, by event type.",
+		// 50ms to about 100s; decoding and NOAA's own delays dominate.
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"type"})
+
+	WebsocketRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "rejected_connections_total",
+		Help:      "Websocket connections turned away by the connection limits, by the limit reached.",
+	}, []string{"reason"})
+
+	TLSCertificateExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tls",
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "When the certificate a listener serves expires, as a Unix timestamp, by listener.",
+	}, []string{"listener"})
+
+	CanaryRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "canary",
+		Name:      "runs_total",
+		Help:      "Canary notifications sent through the chunk queue, by whether they reached the websocket hub in time.",
+	}, []string{"result"})
+
+	CanaryLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "canary",
+		Name:      "round_trip_seconds",
+		Help:      "Time from sending a canary notification to it reaching the websocket hub.",
+		// 50ms to about 25s; most of it is waiting on the next receive.
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+
+	CanaryLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "canary",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "When a canary notification last reached the websocket hub, as a Unix timestamp.",
+	})
+)
+
+// Station normalizes a station for use as a label, so clients asking for
+// ktlx and KTLX share a series.
+func Station(station string) string {
+	return strings.ToUpper(station)
+}
@@ -0,0 +1,118 @@
+package nexrad
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ArchiveBucket holds complete volume scans.
+	ArchiveBucket = "unidata-nexrad-level2"
+	// ChunkBucket holds volume scans in real-time chunks.
+	ChunkBucket = "unidata-nexrad-level2-chunks"
+)
+
+type ArchiveKind string
+
+const (
+	// ArchiveKindVolume is a complete Level II volume scan.
+	ArchiveKindVolume ArchiveKind = "volume"
+	// ArchiveKindMDM is the metadata-only file published alongside a volume.
+	ArchiveKindMDM ArchiveKind = "mdm"
+)
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+// archiveKeyPattern matches yyyy/mm/dd/STATION/STATIONyyyymmdd_hhmmss_V06,
+// optionally suffixed with _MDM. Older volumes may lack the version or be
+// gzipped.
+//
+//nolint:golint,gochecknoglobals
+var archiveKeyPattern = regexp.MustCompile(`^\d{4}/\d{2}/\d{2}/([A-Z0-9]{4})/([A-Z0-9]{4})(\d{8}_\d{6})(?:_(V\d{2}))?(_MDM)?(?:\.gz)?$`)
+
+// ArchiveKey is the metadata encoded in an archive bucket object key.
+type ArchiveKey struct {
+	Station  string
+	ScanTime time.Time
+	Version  string
+	Kind     ArchiveKind
+}
+
+// ParseArchiveKey parses an object key from the Level II archive bucket.
+func ParseArchiveKey(key string) (ArchiveKey, error) {
+	match := archiveKeyPattern.FindStringSubmatch(key)
+	if match == nil || match[1] != match[2] {
+		return ArchiveKey{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	scanTime, err := time.ParseInLocation("20060102_150405", match[3], time.UTC)
+	if err != nil {
+		return ArchiveKey{}, fmt.Errorf("%w: %q: %w", ErrInvalidKey, key, err)
+	}
+	kind := ArchiveKindVolume
+	if match[5] != "" {
+		kind = ArchiveKindMDM
+	}
+	return ArchiveKey{
+		Station:  match[1],
+		ScanTime: scanTime,
+		Version:  match[4],
+		Kind:     kind,
+	}, nil
+}
+
+// ObjectURL returns the public HTTPS URL of an object in a NOAA open data
+// bucket.
+func ObjectURL(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, strings.Join(segments, "/"))
+}
+
+// chunkKeyPattern matches SITE/VOLUME/yyyymmdd-hhmmss-NNN-T.
+//
+//nolint:golint,gochecknoglobals
+var chunkKeyPattern = regexp.MustCompile(`^([A-Z0-9]{4})/(\d+)/(\d{8}-\d{6})-(\d{3})-([SIE])$`)
+
+// ChunkKey is the metadata encoded in a real-time chunk bucket object key.
+type ChunkKey struct {
+	Station string
+	Volume  int
+	// VolumeStart is when the volume scan the chunk belongs to began.
+	VolumeStart time.Time
+	Sequence    int
+	Type        string
+}
+
+// ParseChunkKey parses an object key from the Level II chunk bucket.
+func ParseChunkKey(key string) (ChunkKey, error) {
+	match := chunkKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return ChunkKey{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	volume, err := strconv.Atoi(match[2])
+	if err != nil {
+		return ChunkKey{}, fmt.Errorf("%w: %q: %w", ErrInvalidKey, key, err)
+	}
+	volumeStart, err := time.ParseInLocation("20060102-150405", match[3], time.UTC)
+	if err != nil {
+		return ChunkKey{}, fmt.Errorf("%w: %q: %w", ErrInvalidKey, key, err)
+	}
+	sequence, err := strconv.Atoi(match[4])
+	if err != nil {
+		return ChunkKey{}, fmt.Errorf("%w: %q: %w", ErrInvalidKey, key, err)
+	}
+	return ChunkKey{
+		Station:     match[1],
+		Volume:      volume,
+		VolumeStart: volumeStart,
+		Sequence:    sequence,
+		Type:        match[5],
+	}, nil
+}
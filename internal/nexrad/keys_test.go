@@ -0,0 +1,85 @@
+package nexrad_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+)
+
+func TestParseArchiveKey(t *testing.T) {
+	t.Parallel()
+
+	scanTime := time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)
+	tests := []struct {
+		key  string
+		want nexrad.ArchiveKey
+	}{
+		{"2024/04/18/KTLX/KTLX20240418_033635_V06", nexrad.ArchiveKey{Station: "KTLX", ScanTime: scanTime, Version: "V06", Kind: nexrad.ArchiveKindVolume}},
+		{"2024/04/18/TBOS/TBOS20240418_033635_V08", nexrad.ArchiveKey{Station: "TBOS", ScanTime: scanTime, Version: "V08", Kind: nexrad.ArchiveKindVolume}},
+		{"2024/04/18/KTLX/KTLX20240418_033635_V06_MDM", nexrad.ArchiveKey{Station: "KTLX", ScanTime: scanTime, Version: "V06", Kind: nexrad.ArchiveKindMDM}},
+		{"2004/04/18/KTLX/KTLX20040418_033635.gz", nexrad.ArchiveKey{Station: "KTLX", ScanTime: time.Date(2004, 4, 18, 3, 36, 35, 0, time.UTC), Kind: nexrad.ArchiveKindVolume}},
+	}
+	for _, tt := range tests {
+		got, err := nexrad.ParseArchiveKey(tt.key)
+		if err != nil {
+			t.Errorf("ParseArchiveKey(%q) unexpected error: %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseArchiveKey(%q) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+
+	for _, key := range []string{
+		"",
+		"KTLX20240418_033635_V06",
+		"2024/04/18/KTLX/KFWS20240418_033635_V06",
+		"2024/04/18/KTLX/KTLX20241318_033635_V06",
+		"2024/04/18/KTLX/NWS_NEXRAD_NXL2DP_KTLX_20240418030000_20240418035959.tar",
+	} {
+		if _, err := nexrad.ParseArchiveKey(key); !errors.Is(err, nexrad.ErrInvalidKey) {
+			t.Errorf("ParseArchiveKey(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	t.Parallel()
+	got := nexrad.ObjectURL("unidata-nexrad-level2", "2024/04/18/KTLX/KTLX20240418_033635_V06")
+	want := "https://unidata-nexrad-level2.s3.amazonaws.com/2024/04/18/KTLX/KTLX20240418_033635_V06"
+	if got != want {
+		t.Errorf("ObjectURL() = %q, want %q", got, want)
+	}
+}
+
+func TestParseChunkKey(t *testing.T) {
+	t.Parallel()
+	got, err := nexrad.ParseChunkKey("KJAX/415/20240418-033635-025-I")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := nexrad.ChunkKey{
+		Station:     "KJAX",
+		Volume:      415,
+		VolumeStart: time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		Sequence:    25,
+		Type:        "I",
+	}
+	if got != want {
+		t.Errorf("ParseChunkKey() = %+v, want %+v", got, want)
+	}
+
+	for _, key := range []string{
+		"",
+		"KJAX/415/20240418-033635-025",
+		"KJAX/415/20240418-033635-025-X",
+		"KJAX/abc/20240418-033635-025-I",
+		"KJAX/415/20241318-033635-025-I",
+	} {
+		if _, err := nexrad.ParseChunkKey(key); !errors.Is(err, nexrad.ErrInvalidKey) {
+			t.Errorf("ParseChunkKey(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package polling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+const (
+	// queueSize bounds volumes waiting to be added. Beyond it new volumes
+	// are skipped rather than stalling the event bus.
+	queueSize = 16
+	// IndexName is the index GRLevelX clients read to find the volumes.
+	IndexName = "dir.list"
+)
+
+type entry struct {
+	name string
+	size int64
+}
+
+// Directory keeps a GRLevelX polling directory per configured station,
+// holding hard links to (or copies of) the latest assembled volumes and a
+// dir.list index of them.
+type Directory struct {
+	config *config.Polling
+	jobs   chan events.NexradVolumeEvent
+
+	mu sync.RWMutex
+	// entries are each station's volumes, oldest first.
+	entries map[string][]entry
+
+	consumer *events.Consumer
+}
+
+// NewDirectory picks up what is already in the configured directory and
+// starts adding the volumes announced on eventsChannel.
+func NewDirectory(config *config.Polling, eventsChannel <-chan events.Event) *Directory {
+	d := &Directory{
+		config:   config,
+		jobs:     make(chan events.NexradVolumeEvent, queueSize),
+		entries:  make(map[string][]entry),
+		consumer: events.NewConsumer(),
+	}
+	for _, station := range config.Stations {
+		if err := d.load(strings.ToUpper(station)); err != nil {
+			slog.Warn("Failed to load polling directory", "station", station, "error", err)
+		}
+	}
+	d.consumer.Go(d.worker)
+	d.consumer.Consume(eventsChannel, d.handle)
+	return d
+}
+
+// Stop waits for the volume being added, if any.
+func (d *Directory) Stop() error {
+	d.consumer.Stop()
+	return nil
+}
+
+// Path returns where name is kept in station's polling directory, if it is
+// the index or one of the volumes it lists.
+func (d *Directory) Path(station, name string) (string, bool) {
+	station = strings.ToUpper(station)
+	// Station IDs are four letters; anything else could escape the directory.
+	if len(station) != 4 || strings.IndexFunc(station, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return "", false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entries, ok := d.entries[station]
+	if !ok {
+		return "", false
+	}
+	if name != IndexName && !slices.ContainsFunc(entries, func(e entry) bool { return e.name == name }) {
+		return "", false
+	}
+	return filepath.Join(d.config.Directory, station, name), true
+}
+
+func (d *Directory) wanted(station string) bool {
+	return slices.ContainsFunc(d.config.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+func (d *Directory) handle(event events.Event) {
+	volume, ok := event.(events.NexradVolumeEvent)
+	// Clients expect whole volumes.
+	if !ok || volume.Partial || !d.wanted(volume.Station) {
+		return
+	}
+	select {
+	case d.jobs <- volume:
+	default:
+		slog.Warn("Polling queue full, skipping volume", "station", volume.Station, "volume", volume.VolumeNumber)
+	}
+}
+
+func (d *Directory) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case volume := <-d.jobs:
+			if err := d.add(volume); err != nil {
+				slog.Warn("Failed to add volume to polling directory", "station", volume.Station, "volume", volume.VolumeNumber, "error", err)
+			}
+		}
+	}
+}
+
+// load indexes the volumes left in station's directory by an earlier run.
+func (d *Directory) load(station string) error {
+	dir := filepath.Join(d.config.Directory, station)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	for _, file := range files {
+		if !file.Type().IsRegular() || file.Name() == IndexName || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name: file.Name(), size: info.Size()})
+	}
+	return d.update(station, entries)
+}
+
+// add links the volume into its station's directory and drops the oldest
+// volumes beyond the configured count.
+func (d *Directory) add(volume events.NexradVolumeEvent) error {
+	station := strings.ToUpper(volume.Station)
+	name := filepath.Base(volume.LocalPath)
+	dir := filepath.Join(d.config.Directory, station)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := link(volume.LocalPath, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	entries := slices.DeleteFunc(slices.Clone(d.entries[station]), func(e entry) bool { return e.name == name })
+	d.mu.RUnlock()
+	entries = append(entries, entry{name: name, size: volume.Size})
+	if err := d.update(station, entries); err != nil {
+		return err
+	}
+	slog.Debug("Added volume to polling directory", "station", station, "volume", volume.VolumeNumber, "name", name)
+	return nil
+}
+
+// update rewrites station's index to list entries, then removes the files
+// that fell off it, so the index never lists a missing file.
+func (d *Directory) update(station string, entries []entry) error {
+	// Volumes are named after their start time, so name order is time order.
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.name, b.name) })
+	keep := max(0, len(entries)-int(d.config.Volumes))
+	evicted := entries[:keep]
+	entries = entries[keep:]
+
+	var index bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintf(&index, "%d %s\n", e.size, e.name)
+	}
+	dir := filepath.Join(d.config.Directory, station)
+	if err := writeFile(dir, IndexName, index.Bytes()); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries[station] = entries
+	d.mu.Unlock()
+
+	for _, e := range evicted {
+		if err := os.Remove(filepath.Join(dir, e.name)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove old polling volume", "station", station, "name", e.name, "error", err)
+		}
+	}
+	return nil
+}
+
+// link hard links src to dst, replacing dst, and copies it instead when the
+// two are on different filesystems.
+func link(src, dst string) error {
+	_ = os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Dir(dst), filepath.Base(dst), data)
+}
+
+// writeFile replaces dir/name atomically, so readers never see half a file.
+func writeFile(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// A no-op once the rename has succeeded.
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
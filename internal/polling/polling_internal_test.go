@@ -0,0 +1,112 @@
+package polling
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+func newTestDirectory(t *testing.T, volumes uint) *Directory {
+	t.Helper()
+	return &Directory{
+		config:  &config.Polling{Directory: t.TempDir(), Stations: []string{"KTLX"}, Volumes: volumes},
+		entries: make(map[string][]entry),
+	}
+}
+
+// assembled writes a volume where the assembler would.
+func assembled(t *testing.T, dir string, start time.Time, data string) events.NexradVolumeEvent {
+	t.Helper()
+	path := filepath.Join(dir, "KTLX"+start.Format("20060102_150405")+"_V06")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return events.NexradVolumeEvent{Station: "ktlx", VolumeStart: start, LocalPath: path, Size: int64(len(data))}
+}
+
+func TestAdd(t *testing.T) {
+	t.Parallel()
+	d := newTestDirectory(t, 2)
+	source := t.TempDir()
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+
+	for i := range 3 {
+		volume := assembled(t, source, start.Add(time.Duration(i)*5*time.Minute), fmt.Sprintf("volume %d", i))
+		if err := d.add(volume); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(d.config.Directory, "KTLX", IndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "8 KTLX20240418_030500_V06\n8 KTLX20240418_031000_V06\n"
+	if string(index) != want {
+		t.Errorf("index = %q, want %q", index, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(d.config.Directory, "KTLX", "KTLX20240418_030000_V06")); !os.IsNotExist(err) {
+		t.Errorf("oldest volume not removed: %v", err)
+	}
+	if _, ok := d.Path("KTLX", "KTLX20240418_030000_V06"); ok {
+		t.Error("Path found the removed volume")
+	}
+	path, ok := d.Path("ktlx", "KTLX20240418_031000_V06")
+	if !ok {
+		t.Fatal("Path did not find the latest volume")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "volume 2" {
+		t.Errorf("latest volume = %q, %v", data, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	d := newTestDirectory(t, 2)
+	source := t.TempDir()
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	for i := range 2 {
+		if err := d.add(assembled(t, source, start.Add(time.Duration(i)*5*time.Minute), "volume")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restart picks up where the last run left off.
+	restarted := &Directory{config: d.config, entries: make(map[string][]entry)}
+	if err := restarted.load("KTLX"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.Path("KTLX", "KTLX20240418_030500_V06"); !ok {
+		t.Error("Path did not find a volume from the last run")
+	}
+	if got := len(restarted.entries["KTLX"]); got != 2 {
+		t.Errorf("loaded %d volumes, want 2", got)
+	}
+}
+
+func TestPathRejectsOtherFiles(t *testing.T) {
+	t.Parallel()
+	d := newTestDirectory(t, 2)
+	if err := d.load("KTLX"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Path("KTLX", IndexName); !ok {
+		t.Error("Path did not find the index")
+	}
+	for _, tc := range []struct{ station, name string }{
+		{"KTLX", "../../etc/passwd"},
+		{"KTLX", ".dir.list.123"},
+		{"../x", IndexName},
+		{"KFWS", IndexName},
+	} {
+		if path, ok := d.Path(tc.station, tc.name); ok {
+			t.Errorf("Path(%q, %q) = %q, want nothing", tc.station, tc.name, path)
+		}
+	}
+}
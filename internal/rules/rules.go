@@ -0,0 +1,292 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+const (
+	ConditionVCPChange = "vcp_change"
+	ConditionSAILS     = "sails"
+	ConditionCadence   = "cadence"
+	ConditionSilence   = "silence"
+
+	// queueSize bounds alerts waiting to be published. Beyond it they are
+	// dropped rather than stalling the event bus.
+	queueSize = 64
+	// maxSilenceCheck caps how late a silence alert may be.
+	maxSilenceCheck = 30 * time.Second
+)
+
+// stationState is what the event stream has told us about one station.
+type stationState struct {
+	lastSeen time.Time
+	vcp      int
+	volume   time.Time
+	// cuts is how many times the current volume has repeated its lowest
+	// tilt after the first cut.
+	cuts int
+	// inSAILS holds the sails rules that have fired and have not seen a
+	// volume fall short of their threshold since.
+	inSAILS map[string]bool
+	// silenced holds the silence rules that have fired since lastSeen.
+	silenced map[string]bool
+}
+
+// Engine evaluates the configured rules against per-station state derived
+// from the event stream, and raises a NexradAlertEvent for each match.
+type Engine struct {
+	rules    []config.Rule
+	publish  chan<- events.Event
+	pending  chan events.Event
+	stations map[string]*stationState
+	// mu guards stations between handle and the silence checks.
+	mu sync.Mutex
+
+	consumer *events.Consumer
+}
+
+// NewEngine starts evaluating rules against eventsChannel and publishes
+// alerts to publish.
+func NewEngine(rules []config.Rule, eventsChannel <-chan events.Event, publish chan<- events.Event) *Engine {
+	e := &Engine{
+		rules:    rules,
+		publish:  publish,
+		pending:  make(chan events.Event, queueSize),
+		stations: make(map[string]*stationState),
+		consumer: events.NewConsumer(),
+	}
+	e.consumer.Go(e.send)
+	e.consumer.Go(e.silenceLoop)
+	e.consumer.Consume(eventsChannel, func(event events.Event) {
+		e.handle(event, time.Now())
+	})
+	return e
+}
+
+// Stop discards alerts that have not been published yet.
+func (e *Engine) Stop() error {
+	e.consumer.Stop()
+	return nil
+}
+
+func (e *Engine) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-e.pending:
+			e.publish <- event
+		}
+	}
+}
+
+func (e *Engine) silenceLoop(ctx context.Context) {
+	interval := maxSilenceCheck
+	for _, rule := range e.rules {
+		if rule.Silence != nil {
+			interval = min(interval, max(time.Duration(rule.Silence.After)/4, time.Second))
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.checkSilence(now)
+		}
+	}
+}
+
+func (e *Engine) handle(event events.Event, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch ev := event.(type) {
+	case events.NexradChunkEvent:
+		e.onChunk(ev, now)
+	case events.NexradSweepEvent:
+		e.onSweep(ev, now)
+	}
+}
+
+func (e *Engine) state(station string) *stationState {
+	station = strings.ToUpper(station)
+	state, ok := e.stations[station]
+	if !ok {
+		state = &stationState{inSAILS: make(map[string]bool), silenced: make(map[string]bool)}
+		e.stations[station] = state
+	}
+	return state
+}
+
+func (e *Engine) onChunk(chunk events.NexradChunkEvent, now time.Time) {
+	station := strings.ToUpper(chunk.Station)
+	state := e.state(station)
+	state.lastSeen = now
+	clear(state.silenced)
+
+	if !chunk.VolumeStart.IsZero() && chunk.VolumeStart.After(state.volume) {
+		if !state.volume.IsZero() {
+			e.checkCadence(station, chunk, chunk.VolumeStart.Sub(state.volume), now)
+		}
+		e.endSAILS(state)
+		state.volume = chunk.VolumeStart
+		state.cuts = 0
+	}
+
+	// Only decoded chunks know their VCP, and a straggler from the previous
+	// volume must not flip it back.
+	if chunk.VCP != 0 && chunk.VCP != state.vcp && chunk.VolumeStart.Equal(state.volume) {
+		if state.vcp != 0 {
+			e.checkVCPChange(station, chunk, state.vcp, now)
+		}
+		state.vcp = chunk.VCP
+	}
+}
+
+func (e *Engine) onSweep(sweep events.NexradSweepEvent, now time.Time) {
+	station := strings.ToUpper(sweep.Station)
+	state := e.state(station)
+	if !sweep.VolumeStart.Equal(state.volume) || !sweep.LowestTilt || sweep.ElevationNumber == 1 {
+		return
+	}
+	state.cuts++
+	for _, rule := range e.rules {
+		// Only the first volume to reach the threshold alerts; the station
+		// stays in SAILS until a volume ends short of it.
+		if rule.SAILS == nil || !applies(rule, station) || state.cuts < rule.SAILS.MinCuts || state.inSAILS[rule.Name] {
+			continue
+		}
+		state.inSAILS[rule.Name] = true
+		e.alert(rule, station, ConditionSAILS, now,
+			fmt.Sprintf("%s repeated its %.2f° lowest tilt %d times in volume %d", station, sweep.Angle, state.cuts, sweep.VolumeNumber),
+			map[string]any{
+				"cuts":            state.cuts,
+				"angle":           sweep.Angle,
+				"elevationNumber": sweep.ElevationNumber,
+				"volumeNumber":    sweep.VolumeNumber,
+				"volumeStart":     sweep.VolumeStart,
+				"vcp":             state.vcp,
+			})
+	}
+}
+
+// endSAILS takes the station out of SAILS for each sails rule whose
+// threshold the volume ending now fell short of.
+func (e *Engine) endSAILS(state *stationState) {
+	for _, rule := range e.rules {
+		if rule.SAILS != nil && state.cuts < rule.SAILS.MinCuts {
+			delete(state.inSAILS, rule.Name)
+		}
+	}
+}
+
+func (e *Engine) checkVCPChange(station string, chunk events.NexradChunkEvent, from int, now time.Time) {
+	for _, rule := range e.rules {
+		if rule.VCPChange == nil || !applies(rule, station) {
+			continue
+		}
+		if !matchesVCP(rule.VCPChange.From, from) || !matchesVCP(rule.VCPChange.To, chunk.VCP) {
+			continue
+		}
+		e.alert(rule, station, ConditionVCPChange, now,
+			fmt.Sprintf("%s switched from VCP %d to VCP %d", station, from, chunk.VCP),
+			map[string]any{
+				"from":         from,
+				"to":           chunk.VCP,
+				"volumeNumber": chunk.VolumeNumber,
+				"volumeStart":  chunk.VolumeStart,
+				"path":         chunk.Path,
+			})
+	}
+}
+
+func (e *Engine) checkCadence(station string, chunk events.NexradChunkEvent, cadence time.Duration, now time.Time) {
+	for _, rule := range e.rules {
+		if rule.Cadence == nil || !applies(rule, station) {
+			continue
+		}
+		above, below := time.Duration(rule.Cadence.Above), time.Duration(rule.Cadence.Below)
+		var message string
+		switch {
+		case above > 0 && cadence > above:
+			message = fmt.Sprintf("%s took %s between volumes, more than %s", station, cadence, above)
+		case below > 0 && cadence < below:
+			message = fmt.Sprintf("%s took %s between volumes, less than %s", station, cadence, below)
+		default:
+			continue
+		}
+		e.alert(rule, station, ConditionCadence, now, message, map[string]any{
+			"cadence":      cadence.String(),
+			"volumeNumber": chunk.VolumeNumber,
+			"volumeStart":  chunk.VolumeStart,
+			"vcp":          e.state(station).vcp,
+		})
+	}
+}
+
+// checkSilence alerts once for each station that has gone quiet for longer
+// than a silence rule allows, until it is heard from again.
+func (e *Engine) checkSilence(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for station, state := range e.stations {
+		if state.lastSeen.IsZero() {
+			continue
+		}
+		silentFor := now.Sub(state.lastSeen)
+		for _, rule := range e.rules {
+			if rule.Silence == nil || !applies(rule, station) || state.silenced[rule.Name] || silentFor <= time.Duration(rule.Silence.After) {
+				continue
+			}
+			state.silenced[rule.Name] = true
+			e.alert(rule, station, ConditionSilence, now,
+				fmt.Sprintf("%s has sent no chunks for %s", station, silentFor.Truncate(time.Second)),
+				map[string]any{
+					"lastSeen":    state.lastSeen,
+					"silentFor":   silentFor.Truncate(time.Second).String(),
+					"volumeStart": state.volume,
+				})
+		}
+	}
+}
+
+func (e *Engine) alert(rule config.Rule, station, condition string, now time.Time, message string, evidence map[string]any) {
+	slog.Info("Rule matched", "rule", rule.Name, "station", station, "condition", condition, "message", message)
+	alert := events.NexradAlertEvent{
+		Station:   station,
+		Rule:      rule.Name,
+		Condition: condition,
+		Message:   message,
+		Evidence:  evidence,
+		Time:      now,
+	}
+	select {
+	case e.pending <- alert:
+	default:
+		slog.Warn("Alert queue full, dropping alert", "rule", rule.Name, "station", station)
+	}
+}
+
+func applies(rule config.Rule, station string) bool {
+	if len(rule.Stations) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(rule.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+func matchesVCP(vcps []int, vcp int) bool {
+	return len(vcps) == 0 || slices.Contains(vcps, vcp)
+}
@@ -0,0 +1,155 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+func newTestEngine(rules ...config.Rule) *Engine {
+	return &Engine{
+		rules:    rules,
+		pending:  make(chan events.Event, queueSize),
+		stations: make(map[string]*stationState),
+	}
+}
+
+func alerts(e *Engine) []events.NexradAlertEvent {
+	var got []events.NexradAlertEvent
+	for {
+		select {
+		case event := <-e.pending:
+			got = append(got, event.(events.NexradAlertEvent))
+		default:
+			return got
+		}
+	}
+}
+
+func TestVCPChange(t *testing.T) {
+	t.Parallel()
+	e := newTestEngine(
+		config.Rule{Name: "precip", Stations: []string{"KTLX"}, VCPChange: &config.VCPChangeCondition{From: []int{35}, To: []int{212, 215}}},
+		config.Rule{Name: "any-change", VCPChange: &config.VCPChangeCondition{}},
+	)
+	first := time.Date(2024, 4, 18, 3, 30, 0, 0, time.UTC)
+	second := first.Add(10 * time.Minute)
+	now := time.Now()
+
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: first, VolumeNumber: 414, VCP: 35}, now)
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: second, VolumeNumber: 415, VCP: 212}, now)
+	// A straggler from the previous volume is not a change back.
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: first, VolumeNumber: 414, VCP: 35}, now)
+	e.handle(events.NexradChunkEvent{Station: "KFWS", VolumeStart: first, VolumeNumber: 9, VCP: 35}, now)
+	e.handle(events.NexradChunkEvent{Station: "KFWS", VolumeStart: second, VolumeNumber: 10, VCP: 212}, now)
+
+	got := alerts(e)
+	if len(got) != 3 {
+		t.Fatalf("got %d alerts, want 3: %+v", len(got), got)
+	}
+	if got[0].Rule != "precip" || got[0].Station != "KTLX" || got[0].Condition != ConditionVCPChange {
+		t.Errorf("first alert = %+v, want precip for KTLX", got[0])
+	}
+	if got[0].Evidence["from"] != 35 || got[0].Evidence["to"] != 212 {
+		t.Errorf("evidence = %v, want from 35 to 212", got[0].Evidence)
+	}
+	if got[1].Rule != "any-change" || got[2].Station != "KFWS" {
+		t.Errorf("unexpected alerts %+v", got[1:])
+	}
+}
+
+func TestSAILS(t *testing.T) {
+	t.Parallel()
+	e := newTestEngine(
+		config.Rule{Name: "sails", SAILS: &config.SAILSCondition{MinCuts: 1}},
+		config.Rule{Name: "meso-sails", SAILS: &config.SAILSCondition{MinCuts: 2}},
+	)
+	volume := time.Date(2024, 4, 18, 3, 30, 0, 0, time.UTC)
+	now := time.Now()
+
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: volume, VCP: 212}, now)
+	e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: 1, Angle: 0.48, LowestTilt: true}, now)
+	e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: 2, Angle: 0.88}, now)
+	e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: 4, Angle: 0.48, LowestTilt: true}, now)
+	if got := alerts(e); len(got) != 1 || got[0].Rule != "sails" || got[0].Evidence["cuts"] != 1 {
+		t.Fatalf("after one repeat got %+v, want only the sails alert", got)
+	}
+	e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: 7, Angle: 0.49, LowestTilt: true}, now)
+	if got := alerts(e); len(got) != 1 || got[0].Rule != "meso-sails" {
+		t.Fatalf("after two repeats got %+v, want only the meso-sails alert", got)
+	}
+
+	// Staying in MESO-SAILS is no news.
+	volume = volume.Add(5 * time.Minute)
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: volume, VCP: 212}, now)
+	for _, elevation := range []int{4, 7} {
+		e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: elevation, Angle: 0.48, LowestTilt: true}, now)
+	}
+	if got := alerts(e); len(got) != 0 {
+		t.Fatalf("in the second SAILS volume in a row got %+v, want none", got)
+	}
+
+	// Dropping to one repeat leaves MESO-SAILS but not SAILS, so only
+	// meso-sails alerts when the next volume has two again.
+	volume = volume.Add(5 * time.Minute)
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: volume, VCP: 212}, now)
+	e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: 4, Angle: 0.48, LowestTilt: true}, now)
+	volume = volume.Add(5 * time.Minute)
+	e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: volume, VCP: 212}, now)
+	for _, elevation := range []int{4, 7} {
+		e.handle(events.NexradSweepEvent{Station: "KTLX", VolumeStart: volume, ElevationNumber: elevation, Angle: 0.48, LowestTilt: true}, now)
+	}
+	if got := alerts(e); len(got) != 1 || got[0].Rule != "meso-sails" {
+		t.Fatalf("re-entering MESO-SAILS got %+v, want only the meso-sails alert", got)
+	}
+}
+
+func TestCadence(t *testing.T) {
+	t.Parallel()
+	e := newTestEngine(config.Rule{Name: "cadence", Cadence: &config.CadenceCondition{
+		Above: config.Duration(8 * time.Minute),
+		Below: config.Duration(3 * time.Minute),
+	}})
+	start := time.Date(2024, 4, 18, 3, 30, 0, 0, time.UTC)
+	now := time.Now()
+
+	for _, offset := range []time.Duration{0, 5 * time.Minute, 15 * time.Minute, 17 * time.Minute} {
+		e.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: start.Add(offset)}, now)
+	}
+	got := alerts(e)
+	if len(got) != 2 {
+		t.Fatalf("got %d alerts, want 2: %+v", len(got), got)
+	}
+	if got[0].Evidence["cadence"] != "10m0s" || got[1].Evidence["cadence"] != "2m0s" {
+		t.Errorf("cadences = %v and %v, want 10m0s and 2m0s", got[0].Evidence["cadence"], got[1].Evidence["cadence"])
+	}
+}
+
+func TestSilence(t *testing.T) {
+	t.Parallel()
+	e := newTestEngine(config.Rule{Name: "quiet", Stations: []string{"ktlx"}, Silence: &config.SilenceCondition{After: config.Duration(10 * time.Minute)}})
+	now := time.Now()
+
+	e.handle(events.NexradChunkEvent{Station: "KTLX"}, now)
+	e.handle(events.NexradChunkEvent{Station: "KFWS"}, now)
+	e.checkSilence(now.Add(5 * time.Minute))
+	if got := alerts(e); len(got) != 0 {
+		t.Fatalf("got %+v before the station went silent", got)
+	}
+
+	e.checkSilence(now.Add(11 * time.Minute))
+	e.checkSilence(now.Add(12 * time.Minute))
+	got := alerts(e)
+	if len(got) != 1 || got[0].Station != "KTLX" || got[0].Condition != ConditionSilence {
+		t.Fatalf("got %+v, want one silence alert for KTLX", got)
+	}
+
+	// Hearing from the station re-arms the rule.
+	e.handle(events.NexradChunkEvent{Station: "KTLX"}, now.Add(13*time.Minute))
+	e.checkSilence(now.Add(24 * time.Minute))
+	if got := alerts(e); len(got) != 1 {
+		t.Errorf("got %d alerts after a second silence, want 1", len(got))
+	}
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// StatusError is returned for any other unexpected response status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// Getter reads whole objects. A Client is one, and so is a chunk cache, which
+// keeps the chunks it reads so they are fetched once however many read them.
+type Getter interface {
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+}
+
+// fetchTimeout bounds a single object request. Chunks are small and archive
+// volumes are tens of megabytes.
+const fetchTimeout = 2 * time.Minute
+
+// Client fetches objects anonymously from the public NOAA buckets, or from an
+// S3-compatible endpoint standing in for them.
+type Client struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewClient returns a Client. An empty endpoint uses AWS virtual-hosted URLs;
+// otherwise objects are requested path-style from endpoint.
+func NewClient(endpoint string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+// URL returns where the client fetches bucket/key from.
+func (c *Client) URL(bucket, key string) string {
+	if c.endpoint == "" {
+		return nexrad.ObjectURL(bucket, key)
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/%s/%s", c.endpoint, url.PathEscape(bucket), strings.Join(segments, "/"))
+}
+
+// Do requests an object, passing header through so callers can make
+// conditional and range requests. Any 2xx or 304 response is returned for the
+// caller to close; anything else is an error.
+func (c *Client) Do(ctx context.Context, bucket, key string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	// S3 answers 403 rather than 404 for missing keys in buckets that can't
+	// be listed anonymously.
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+	}
+	return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// Get reads a whole object into memory.
+func (c *Client) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	resp, err := c.Do(ctx, bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
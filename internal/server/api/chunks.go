@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/chunkcache"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// GETChunk serves the chunk named by a chunk event's path from the cache,
+// with conditional and range requests handled by http.ServeContent.
+func GETChunk(c *gin.Context) {
+	cache, ok := c.MustGet("chunkCache").(*chunkcache.Cache)
+	if !ok {
+		slog.Error("Failed to get chunk cache")
+		c.String(http.StatusInternalServerError, "chunk cache unavailable")
+		return
+	}
+	if cache == nil {
+		c.String(http.StatusNotFound, "the chunk proxy is disabled")
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("path"), "/")
+	file, entry, err := cache.Open(c.Request.Context(), key)
+	switch {
+	case errors.Is(err, nexrad.ErrInvalidKey):
+		c.String(http.StatusBadRequest, "not a chunk path")
+		return
+	case errors.Is(err, s3.ErrNotFound):
+		c.String(http.StatusNotFound, "no such chunk")
+		return
+	case err != nil:
+		if c.Request.Context().Err() == nil {
+			slog.Warn("Failed to fetch chunk", "key", key, "error", err)
+		}
+		c.String(http.StatusBadGateway, "failed to fetch chunk")
+		return
+	}
+	defer file.Close()
+
+	// A chunk never changes once it is written.
+	c.Header("Cache-Control", "public, max-age=86400, immutable")
+	c.Header("ETag", entry.ETag)
+	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(c.Writer, c.Request, path.Base(key), entry.ModTime, file)
+}
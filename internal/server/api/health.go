@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/gin-gonic/gin"
+)
+
+// GETHealthz is the liveness probe. It only fails once the listener has been
+// unready for long enough that a restart is the likeliest fix.
+func GETHealthz(c *gin.Context) {
+	sqsListener, ok := c.MustGet("sqsListener").(*sqs.Listener)
+	if !ok {
+		slog.Error("Failed to get sqsListener")
+		c.String(http.StatusInternalServerError, "SQS listener unavailable")
+		return
+	}
+
+	if !sqsListener.Health().Live() {
+		c.String(http.StatusServiceUnavailable, "unhealthy")
+		return
+	}
+	c.String(http.StatusOK, "OK")
+}
+
+// GETReadyz is the readiness probe. It reports the listener's health either
+// way, failing unless notifications are being received.
+func GETReadyz(c *gin.Context) {
+	sqsListener, ok := c.MustGet("sqsListener").(*sqs.Listener)
+	if !ok {
+		slog.Error("Failed to get sqsListener")
+		c.String(http.StatusInternalServerError, "SQS listener unavailable")
+		return
+	}
+
+	report := sqsListener.Health().Report()
+	status := http.StatusOK
+	if !report.State.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/imagery"
+	"github.com/gin-gonic/gin"
+)
+
+// GETLatestImage serves the most recent reflectivity image for a station.
+func GETLatestImage(c *gin.Context) {
+	imager, ok := c.MustGet("imager").(*imagery.Imager)
+	if !ok {
+		slog.Error("Failed to get imager")
+		c.String(http.StatusInternalServerError, "imager unavailable")
+		return
+	}
+	if imager == nil {
+		c.String(http.StatusNotFound, "imagery is disabled")
+		return
+	}
+
+	path, ok := imager.LatestPath(c.Param("station"))
+	if !ok {
+		c.String(http.StatusNotFound, "no image for station")
+		return
+	}
+	// The file is replaced with every new sweep.
+	c.Header("Cache-Control", "no-cache")
+	c.File(path)
+}
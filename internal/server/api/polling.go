@@ -0,0 +1,53 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/polling"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minPollingRate is the slowest, in bytes a second, a client may fetch a
+	// polling file at. The server's write timeout is sized for small
+	// responses, and volumes run to tens of megabytes.
+	minPollingRate = 32 * 1024
+	// pollingSlack is added to the time a file takes at minPollingRate.
+	pollingSlack = 30 * time.Second
+)
+
+// GETPollingFile serves a station's GRLevelX polling index or one of the
+// volumes it lists.
+func GETPollingFile(c *gin.Context) {
+	pollingDirectory, ok := c.MustGet("pollingDirectory").(*polling.Directory)
+	if !ok {
+		slog.Error("Failed to get polling directory")
+		c.String(http.StatusInternalServerError, "polling directory unavailable")
+		return
+	}
+	if pollingDirectory == nil {
+		c.String(http.StatusNotFound, "polling is disabled")
+		return
+	}
+
+	file := c.Param("file")
+	path, ok := pollingDirectory.Path(c.Param("station"), file)
+	if !ok {
+		c.String(http.StatusNotFound, "no such file for station")
+		return
+	}
+	if file == polling.IndexName {
+		// The index is rewritten with every new volume.
+		c.Header("Cache-Control", "no-cache")
+	}
+	if info, err := os.Stat(path); err == nil {
+		deadline := time.Now().Add(pollingSlack + time.Duration(info.Size()/minPollingRate)*time.Second)
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+			slog.Warn("Failed to extend the write deadline", "path", path, "error", err)
+		}
+	}
+	c.File(path)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/gin-gonic/gin"
+)
+
+// maxSNSBody is the largest message SNS will deliver.
+const maxSNSBody = 256 * 1024
+
+// POSTSNS receives SNS deliveries when the listener runs in http ingest mode.
+func POSTSNS(c *gin.Context) {
+	sqsListener, ok := c.MustGet("sqsListener").(*sqs.Listener)
+	if !ok {
+		slog.Error("Failed to get sqsListener")
+		c.String(http.StatusInternalServerError, "SQS listener unavailable")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSNSBody))
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		c.String(http.StatusRequestEntityTooLarge, "message too large")
+		return
+	case err != nil:
+		c.String(http.StatusBadRequest, "failed to read message")
+		return
+	}
+
+	err = sqsListener.HandleSNS(c.Request.Context(), body)
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, sqs.ErrHTTPIngestDisabled):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, snshttp.ErrUntrustedCertURL),
+		errors.Is(err, snshttp.ErrInvalidSignature),
+		errors.Is(err, snshttp.ErrInvalidCertificate),
+		errors.Is(err, snshttp.ErrUnsupportedSignatureVersion),
+		errors.Is(err, sqs.ErrUnknownTopic):
+		slog.Warn("Rejected SNS message", "error", err, "remote", c.ClientIP())
+		c.String(http.StatusForbidden, "message rejected")
+	default:
+		// Anything else may be transient, so let SNS retry.
+		slog.Warn("Failed to handle SNS message", "error", err)
+		c.String(http.StatusInternalServerError, "failed to handle message")
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/eta"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/status"
+	"github.com/gin-gonic/gin"
+)
+
+// GETStationStatus reports whether a station's real-time feed is online.
+func GETStationStatus(c *gin.Context) {
+	statusTracker, ok := c.MustGet("statusTracker").(*status.Tracker)
+	if !ok || statusTracker == nil {
+		slog.Error("Failed to get status tracker")
+		c.String(http.StatusInternalServerError, "status tracker unavailable")
+		return
+	}
+
+	stationStatus, ok := statusTracker.Status(c.Param("station"))
+	if !ok {
+		c.String(http.StatusNotFound, "no status for station")
+		return
+	}
+	c.JSON(http.StatusOK, stationStatus)
+}
+
+// GETStationETA estimates when a station's next volume will arrive.
+func GETStationETA(c *gin.Context) {
+	estimator, ok := c.MustGet("estimator").(*eta.Estimator)
+	if !ok || estimator == nil {
+		slog.Error("Failed to get estimator")
+		c.String(http.StatusInternalServerError, "estimator unavailable")
+		return
+	}
+
+	estimate, ok := estimator.Estimate(c.Param("station"))
+	if !ok {
+		c.String(http.StatusNotFound, "not enough volumes seen for station")
+		return
+	}
+	c.JSON(http.StatusOK, estimate)
+}
@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/eta"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/server/api"
+	"github.com/gin-gonic/gin"
+)
+
+func etaRouter(estimator *eta.Estimator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("estimator", estimator)
+		c.Next()
+	})
+	r.GET("/api/stations/:station/eta", api.GETStationETA)
+	return r
+}
+
+func getETA(r *gin.Engine, station string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/stations/"+station+"/eta", nil))
+	return w
+}
+
+func TestGETStationETA(t *testing.T) {
+	t.Parallel()
+	eventsChannel := make(chan events.Event)
+	estimator := eta.NewEstimator(eventsChannel)
+	t.Cleanup(func() {
+		_ = estimator.Stop()
+		close(eventsChannel)
+	})
+	r := etaRouter(estimator)
+
+	if w := getETA(r, "KTLX"); w.Code != http.StatusNotFound {
+		t.Errorf("status before any volumes = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		eventsChannel <- events.NexradChunkEvent{Station: "KTLX", ChunkType: "S", VCP: 212, VolumeStart: start.Add(time.Duration(i) * 5 * time.Minute)}
+	}
+	// The estimator takes each event from the channel before handling it.
+	deadline := time.Now().Add(5 * time.Second)
+	w := getETA(r, "ktlx")
+	for w.Code == http.StatusNotFound && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		w = getETA(r, "ktlx")
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("status after three volumes = %d, want %d", w.Code, http.StatusOK)
+	}
+	var got events.VolumeETA
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(15 * time.Minute); got.Station != "KTLX" || got.VCP != 212 || !got.NextVolumeStart.Equal(want) {
+		t.Errorf("estimate = %+v, want KTLX VCP 212 starting at %v", got, want)
+	}
+}
+
+func TestGETStationETAWithoutEstimator(t *testing.T) {
+	t.Parallel()
+	if w := getETA(etaRouter(nil), "KTLX"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
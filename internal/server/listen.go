@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/systemd"
+)
+
+// listen opens every address cfg lists, closing those already open if one
+// fails.
+func listen(cfg *config.HTTPListener) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range cfg.Listen {
+		opened, err := listenAddress(address, cfg.SocketMode)
+		if err != nil {
+			for _, listener := range listeners {
+				_ = listener.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		listeners = append(listeners, opened...)
+	}
+	return listeners, nil
+}
+
+func listenAddress(address, socketMode string) ([]net.Listener, error) {
+	if name, ok := strings.CutPrefix(address, config.ListenSystemdPrefix); ok {
+		return systemd.Listeners(name)
+	}
+	if path, ok := strings.CutPrefix(address, config.ListenUnixPrefix); ok {
+		listener, err := listenUnix(path, socketMode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{listener}, nil
+	}
+	// Without a host this is both IPv4 and IPv6 where the host has them.
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{listener}, nil
+}
+
+// listenUnix creates a Unix socket at path with socketMode permissions. A
+// socket left behind by a previous run is replaced, but not one still in use.
+func listenUnix(path, socketMode string) (net.Listener, error) {
+	mode, err := config.ParseSocketMode(socketMode)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// The socket is created with the umask's permissions, so it is made in
+	// a directory only we can enter, and only linked into place once it has
+	// socketMode. Linking, unlike renaming, won't replace whatever may have
+	// appeared at path since it was checked.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	if err := os.Link(tmp, path); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: listener, path: path}, nil
+}
+
+// unixListener is a Unix socket linked into place at path, which it removes
+// once closed as net.UnixListener does the path it was created at.
+type unixListener struct {
+	net.Listener
+	path      string
+	closeOnce sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	// Only once, so a later listener's socket at path is left alone.
+	l.closeOnce.Do(func() {
+		_ = os.Remove(l.path)
+	})
+	return err
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "api.sock")
+	cfg := &config.HTTPListener{Listen: []string{"127.0.0.1:0", "unix:" + path}, SocketMode: "0600"}
+
+	listeners, err := listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 2 || listeners[0].Addr().Network() != "tcp" || listeners[1].Addr().Network() != "unix" {
+		t.Fatalf("listen() = %v, want a TCP and a Unix listener", listeners)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %o, want 600", info.Mode().Perm())
+	}
+	if got := listeners[1].Addr().String(); got != path {
+		t.Errorf("Addr() = %s, want %s", got, path)
+	}
+	// The directory the socket was made in is gone.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("socket directory holds %v, want only the socket", entries)
+	}
+
+	// The socket is in use, so it isn't taken over, and the TCP listener
+	// opened before it is closed again.
+	second := &config.HTTPListener{Listen: []string{"127.0.0.1:0", "unix:" + path}, SocketMode: "0600"}
+	if _, err := listen(second); err == nil {
+		t.Error("listen() took over a socket in use")
+	}
+
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after Close: %v", err)
+	}
+}
+
+func TestListenUnixStale(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "api.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the socket file behind, as a crash would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	listener, err := listenUnix(path, "0660")
+	if err != nil {
+		t.Fatalf("listenUnix() over a stale socket error = %v", err)
+	}
+	_ = listener.Close()
+
+	notSocket := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(notSocket, "0660"); err == nil {
+		t.Error("listenUnix() replaced a regular file")
+	}
+}
@@ -1,23 +1,46 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/chunkcache"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/eta"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/imagery"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/limits"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/polling"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/status"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/websocket"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func applyMiddleware(r *gin.Engine, config *config.HTTP, otelComponent string, sqsListener *sqs.Listener) {
+func applyMiddleware(r *gin.Engine, config *config.HTTP, otelComponent string, sqsListener *sqs.Listener, imager *imagery.Imager, statusTracker *status.Tracker, estimator *eta.Estimator, pollingDirectory *polling.Directory, chunkCache *chunkcache.Cache) {
 	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
-	r.TrustedPlatform = "X-Real-IP"
+	r.Use(gin.LoggerWithFormatter(logFormatter))
+	r.TrustedPlatform = config.TrustedPlatform
 
 	if otelComponent == "api" {
 		r.Use(sqsListenerProvider(sqsListener))
+		r.Use(imagerProvider(imager))
+		r.Use(statusTrackerProvider(statusTracker))
+		r.Use(estimatorProvider(estimator))
+		r.Use(pollingDirectoryProvider(pollingDirectory))
+		r.Use(chunkCacheProvider(chunkCache))
 	}
 
 	err := r.SetTrustedProxies(config.TrustedProxies)
@@ -27,22 +50,223 @@ func applyMiddleware(r *gin.Engine, config *config.HTTP, otelComponent string, s
 
 	if config.Tracing.Enabled {
 		r.Use(otelgin.Middleware(otelComponent))
-		r.Use(tracingProvider(config))
+		r.Use(tracingProvider())
 	}
 }
 
-func tracingProvider(config *config.HTTP) gin.HandlerFunc {
+// logFormatter is gin's default access log line, with any credential in the
+// query redacted.
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactCredential(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactCredential hides the credential auth.QueryParam carries in path. A
+// query that can't be parsed is dropped, as the credential can't be found in
+// it.
+func redactCredential(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base
+	}
+	if !query.Has(auth.QueryParam) {
+		return path
+	}
+	query.Set(auth.QueryParam, "REDACTED")
+	return base + "?" + query.Encode()
+}
+
+func tracingProvider() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := trace.SpanFromContext(c.Request.Context())
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.path", c.Request.URL.Path),
+			)
+		}
+		c.Next()
+	}
+}
+
+// imagerProvider provides the imager, which is nil when imagery is disabled.
+func imagerProvider(imager *imagery.Imager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("imager", imager)
+		c.Next()
+	}
+}
+
+func statusTrackerProvider(statusTracker *status.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("statusTracker", statusTracker)
+		c.Next()
+	}
+}
+
+func estimatorProvider(estimator *eta.Estimator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("estimator", estimator)
+		c.Next()
+	}
+}
+
+// pollingDirectoryProvider provides the polling directory, which is nil when
+// polling is disabled.
+func pollingDirectoryProvider(pollingDirectory *polling.Directory) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("pollingDirectory", pollingDirectory)
+		c.Next()
+	}
+}
+
+// chunkCacheProvider provides the chunk cache, which is nil when the chunk
+// proxy is disabled.
+func chunkCacheProvider(chunkCache *chunkcache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("chunkCache", chunkCache)
+		c.Next()
+	}
+}
+
+// corsMiddleware lets browsers on the configured CORS hosts read the
+// response, including the headers range and conditional requests rely on,
+// and answers their preflight requests.
+func corsMiddleware(config *config.HTTP) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin != "" && websocket.OriginAllowed(origin, config.CORSHosts) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Authorization, X-API-Key, Range, If-None-Match, If-Modified-Since, If-Range")
+			c.Header("Access-Control-Expose-Headers", "Accept-Ranges, Content-Length, Content-Range, ETag, Last-Modified")
+			c.Header("Access-Control-Max-Age", "86400")
+		}
+		c.Header("Vary", "Origin")
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authMiddleware turns away requests without a valid credential, and
+// provides the principal it belongs to to the rest. authenticator is nil when
+// auth is disabled, and every request is let through.
+func authMiddleware(authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticator == nil {
+			c.Next()
+			return
+		}
+		principal, err := authenticator.Authenticate(auth.Credential(c.Request))
+		if err != nil {
+			if !errors.Is(err, auth.ErrNoCredential) {
+				slog.Warn("Rejected credential", "path", c.Request.URL.Path, "remote", c.ClientIP(), "error", err)
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="nexrad-aws-notifier"`)
+			c.String(http.StatusUnauthorized, "unauthorized")
+			c.Abort()
+			return
+		}
+		c.Set("principal", principal)
+		c.Next()
+	}
+}
+
+// allowMiddleware turns away principals that may not subscribe to eventType
+// events for the station the request is for, as a websocket subscription
+// would be. It runs after authMiddleware.
+func allowMiddleware(eventType events.EventType, station func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only set when auth is enabled.
+		if principal, ok := c.Value("principal").(*auth.Principal); ok {
+			requested := station(c)
+			if !principal.Allows(eventType, requested) {
+				slog.Warn("Request not allowed", "principal", principal.Name, "path", c.Request.URL.Path, "type", eventType, "station", requested)
+				c.String(http.StatusForbidden, "not allowed to read %s for %s", eventType, requested)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func stationParam(c *gin.Context) string {
+	return c.Param("station")
+}
+
+// chunkStation is the station of the chunk key in the path. A path that
+// isn't a chunk key has no station, which only an unrestricted principal is
+// allowed, and GETChunk turns it away.
+func chunkStation(c *gin.Context) string {
+	key, err := nexrad.ParseChunkKey(strings.TrimPrefix(c.Param("path"), "/"))
+	if err != nil {
+		return ""
+	}
+	return key.Station
+}
+
+// connectRateMiddleware turns away clients connecting more often than the
+// connect rate allows. It runs before authMiddleware so guessing credentials
+// is rate limited too.
+func connectRateMiddleware(limiter *limits.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if config.Tracing.OTLPEndpoint != "" {
-			ctx := c.Request.Context()
-			span := trace.SpanFromContext(ctx)
-			if span.IsRecording() {
-				span.SetAttributes(
-					attribute.String("http.method", c.Request.Method),
-					attribute.String("http.path", c.Request.URL.Path),
-				)
+		if wait, err := limiter.Connect(c.ClientIP()); err != nil {
+			slog.Debug("Websocket connection limited", "remote", c.ClientIP(), "error", err)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.String(http.StatusTooManyRequests, err.Error())
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// connectionLimitMiddleware holds one of the limited connections for as
+// long as the rest of the request, which for a websocket is for as long as
+// it is open. It runs after authMiddleware so it knows the principal.
+func connectionLimitMiddleware(limiter *limits.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var key string
+		if principal, ok := c.Value("principal").(*auth.Principal); ok {
+			key = principal.ID
+		}
+		release, err := limiter.Acquire(c.ClientIP(), key)
+		if err != nil {
+			slog.Debug("Websocket connection limited", "remote", c.ClientIP(), "key", key, "error", err)
+			status := http.StatusTooManyRequests
+			if errors.Is(err, limits.ErrServerFull) {
+				// Not the client's doing, so another replica may take it.
+				status = http.StatusServiceUnavailable
 			}
+			c.String(status, err.Error())
+			c.Abort()
+			return
 		}
+		defer release()
 		c.Next()
 	}
 }
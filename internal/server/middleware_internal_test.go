@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactCredential(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/ws/events/nexrad-chunk/KTLX", "/ws/events/nexrad-chunk/KTLX"},
+		{"/ws/events/nexrad-chunk/KTLX?since=1", "/ws/events/nexrad-chunk/KTLX?since=1"},
+		{"/ws/events/nexrad-chunk/KTLX?token=secret", "/ws/events/nexrad-chunk/KTLX?token=REDACTED"},
+		{"/api/chunks/KTLX/1?a=1&token=secret&token=again", "/api/chunks/KTLX/1?a=1&token=REDACTED"},
+		{"/api/chunks/KTLX/1?token=secret;%zz", "/api/chunks/KTLX/1"},
+	}
+	for _, tt := range tests {
+		if got := redactCredential(tt.path); got != tt.want {
+			t.Errorf("redactCredential(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRESTRoutesAllowedStationsAndTypes(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.HTTP{}
+	authenticator, err := auth.NewAuthenticator(&config.Auth{
+		Enabled: true,
+		APIKeys: []config.APIKey{
+			{Name: "ktlx", Key: "ktlx-key", Stations: []string{"KTLX"}},
+			{Name: "chunks", Key: "chunks-key", Types: []string{string(events.EventTypeNexradChunk)}},
+			{Name: "all", Key: "all-key"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventsChannel := make(chan events.Event)
+	t.Cleanup(func() { close(eventsChannel) })
+	r := gin.New()
+	applyMiddleware(r, cfg, "api", nil, nil, nil, nil, nil, nil)
+	applyRoutes(r, cfg, eventsChannel, nil, authenticator)
+
+	paths := map[string]string{
+		"image":   "/api/images/%s/latest.png",
+		"status":  "/api/stations/%s/status",
+		"eta":     "/api/stations/%s/eta",
+		"polling": "/polling/%s/dir.list",
+		"chunk":   "/api/chunks/%s/123/20240501-120000-001-S",
+	}
+	tests := []struct {
+		route   string
+		key     string
+		station string
+		allowed bool
+	}{
+		{"image", "ktlx-key", "KTLX", true},
+		{"image", "ktlx-key", "KFDR", false},
+		{"image", "chunks-key", "KTLX", false},
+		{"status", "ktlx-key", "KTLX", true},
+		{"status", "ktlx-key", "KFDR", false},
+		{"status", "chunks-key", "KTLX", false},
+		{"eta", "ktlx-key", "KTLX", true},
+		{"eta", "ktlx-key", "KFDR", false},
+		{"eta", "chunks-key", "KTLX", false},
+		{"polling", "ktlx-key", "KTLX", true},
+		{"polling", "ktlx-key", "KFDR", false},
+		{"polling", "chunks-key", "KTLX", false},
+		{"chunk", "ktlx-key", "KTLX", true},
+		{"chunk", "ktlx-key", "KFDR", false},
+		{"chunk", "chunks-key", "KFDR", true},
+		{"chunk", "all-key", "KFDR", true},
+	}
+	for _, tt := range tests {
+		path := fmt.Sprintf(paths[tt.route], tt.station)
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", tt.key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if forbidden := w.Code == http.StatusForbidden; forbidden == tt.allowed {
+			t.Errorf("GET %s with %s: status %d, want allowed %v", path, tt.key, w.Code, tt.allowed)
+		}
+	}
+
+	// A path that isn't a chunk key has no station to allow.
+	req := httptest.NewRequest(http.MethodGet, "/api/chunks/not-a-chunk", nil)
+	req.Header.Set("X-API-Key", "ktlx-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("GET /api/chunks/not-a-chunk with a restricted key: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -3,22 +3,56 @@ package server
 import (
 	"net/http"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/canary"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/limits"
+	apiControllers "github.com/USA-RedDragon/nexrad-aws-notifier/internal/server/api"
 	websocketControllers "github.com/USA-RedDragon/nexrad-aws-notifier/internal/server/websocket"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/websocket"
 	"github.com/gin-gonic/gin"
 )
 
-func applyRoutes(r *gin.Engine, config *config.HTTP, eventsChannel chan events.Event) {
+func applyRoutes(r *gin.Engine, config *config.HTTP, eventsChannel <-chan events.Event, canary *canary.Canary, authenticator *auth.Authenticator) {
 	r.GET("/health", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
+	r.GET("/healthz", apiControllers.GETHealthz)
+	r.GET("/readyz", apiControllers.GETReadyz)
 
 	// One hub broadcasts to every connection; CreateHandler builds the
 	// per-connection state itself.
-	hub := websocketControllers.NewEventsHub(eventsChannel)
+	hub := websocketControllers.NewEventsHub(eventsChannel, canary)
 
-	ws := r.Group("/ws")
+	// SNS signs its own messages, and can't present a credential.
+	r.POST("/api/sns", apiControllers.POSTSNS)
+
+	// Routes in groups with authMiddleware need a credential when auth is
+	// enabled, and allowMiddleware holds the principal to the stations and
+	// types it may subscribe to.
+	api := r.Group("/api", authMiddleware(authenticator))
+	api.GET("/images/:station/latest.png", allowMiddleware(events.EventTypeNexradImage, stationParam), apiControllers.GETLatestImage)
+	api.GET("/stations/:station/status", allowMiddleware(events.EventTypeStationStatus, stationParam), apiControllers.GETStationStatus)
+	// Volume events carry the same estimate.
+	api.GET("/stations/:station/eta", allowMiddleware(events.EventTypeVolumeAssembled, stationParam), apiControllers.GETStationETA)
+
+	// Browsers send preflight requests without credentials, so corsMiddleware
+	// answers them before authMiddleware sees them.
+	chunks := r.Group("/api/chunks", corsMiddleware(config), authMiddleware(authenticator), allowMiddleware(events.EventTypeNexradChunk, chunkStation))
+	chunks.GET("/*path", apiControllers.GETChunk)
+	chunks.HEAD("/*path", apiControllers.GETChunk)
+	// Answered by corsMiddleware.
+	chunks.OPTIONS("/*path", func(*gin.Context) {})
+
+	// GRLevelX clients are pointed at /polling/<station>/ and fetch dir.list
+	// and the volumes it lists from there.
+	polling := r.Group("/polling", authMiddleware(authenticator), allowMiddleware(events.EventTypeVolumeAssembled, stationParam))
+	polling.GET("/:station/:file", apiControllers.GETPollingFile)
+
+	// Websockets are limited both before and after authMiddleware; see the
+	// middleware.
+	limiter := limits.NewLimiter(&config.Limits)
+	ws := r.Group("/ws", connectRateMiddleware(limiter), authMiddleware(authenticator), connectionLimitMiddleware(limiter))
 	ws.GET("/events/:type/:station", websocket.CreateHandler(hub.NewConnection, config))
 }
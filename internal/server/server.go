@@ -6,13 +6,20 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/canary"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/certs"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/chunkcache"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/eta"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/imagery"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/polling"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/status"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -20,17 +27,19 @@ import (
 )
 
 type Server struct {
-	ipv4Server        *http.Server
-	ipv6Server        *http.Server
-	metricsIPV4Server *http.Server
-	metricsIPV6Server *http.Server
-	stopped           atomic.Bool
-	config            *config.HTTP
+	apiServer     *http.Server
+	metricsServer *http.Server
+	stopped       atomic.Bool
+	config        *config.HTTP
+	// reloaders keep the TLS listeners' certificates up to date.
+	reloaders []*certs.Reloader
+	// listeners are every address being served on.
+	listeners []net.Listener
 }
 
 const defTimeout = 5 * time.Second
 
-func NewServer(config *config.HTTP, eventsChannel chan events.Event, sqsListener *sqs.Listener) *Server {
+func NewServer(config *config.HTTP, eventsChannel <-chan events.Event, sqsListener *sqs.Listener, imager *imagery.Imager, statusTracker *status.Tracker, estimator *eta.Estimator, pollingDirectory *polling.Directory, chunkCache *chunkcache.Cache, canary *canary.Canary, authenticator *auth.Authenticator) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	if config.PProf.Enabled {
 		gin.SetMode(gin.DebugMode)
@@ -47,25 +56,16 @@ func NewServer(config *config.HTTP, eventsChannel chan events.Event, sqsListener
 		writeTimeout = 60 * time.Second
 	}
 
-	applyMiddleware(r, config, "api", sqsListener)
-	applyRoutes(r, config, eventsChannel)
-
-	var metricsIPV4Server *http.Server
-	var metricsIPV6Server *http.Server
+	applyMiddleware(r, config, "api", sqsListener, imager, statusTracker, estimator, pollingDirectory, chunkCache)
+	applyRoutes(r, config, eventsChannel, canary, authenticator)
 
+	var metricsServer *http.Server
 	if config.Metrics.Enabled {
 		metricsRouter := gin.New()
-		applyMiddleware(metricsRouter, config, "metrics", sqsListener)
+		applyMiddleware(metricsRouter, config, "metrics", sqsListener, imager, statusTracker, estimator, pollingDirectory, chunkCache)
 
 		metricsRouter.GET("/metrics", gin.WrapH(promhttp.Handler()))
-		metricsIPV4Server = &http.Server{
-			Addr:              fmt.Sprintf("%s:%d", config.Metrics.IPV4Host, config.Metrics.Port),
-			ReadHeaderTimeout: defTimeout,
-			WriteTimeout:      writeTimeout,
-			Handler:           metricsRouter,
-		}
-		metricsIPV6Server = &http.Server{
-			Addr:              fmt.Sprintf("[%s]:%d", config.Metrics.IPV6Host, config.Metrics.Port),
+		metricsServer = &http.Server{
 			ReadHeaderTimeout: defTimeout,
 			WriteTimeout:      defTimeout,
 			Handler:           metricsRouter,
@@ -73,92 +73,85 @@ func NewServer(config *config.HTTP, eventsChannel chan events.Event, sqsListener
 	}
 
 	return &Server{
-		ipv4Server: &http.Server{
-			Addr:              fmt.Sprintf("%s:%d", config.IPV4Host, config.Port),
+		apiServer: &http.Server{
 			ReadHeaderTimeout: defTimeout,
 			WriteTimeout:      writeTimeout,
 			Handler:           r,
 		},
-		ipv6Server: &http.Server{
-			Addr:              fmt.Sprintf("[%s]:%d", config.IPV6Host, config.Port),
-			ReadHeaderTimeout: defTimeout,
-			WriteTimeout:      defTimeout,
-			Handler:           r,
-		},
-		metricsIPV4Server: metricsIPV4Server,
-		metricsIPV6Server: metricsIPV6Server,
-		config:            config,
+		metricsServer: metricsServer,
+		config:        config,
 	}
 }
 
-func (s *Server) Start() error {
-	waitGrp := sync.WaitGroup{}
-	if s.ipv4Server != nil {
-		ipv4Listener, err := net.Listen("tcp4", s.ipv4Server.Addr)
-		if err != nil {
-			return err
-		}
-		waitGrp.Add(1)
-		go func() {
-			defer waitGrp.Done()
-			if err := s.ipv4Server.Serve(ipv4Listener); err != nil && !s.stopped.Load() {
-				slog.Error("HTTP IPv4 server error", "error", err.Error())
-			}
-		}()
+// serve serves srv on listener, over TLS when srv has a TLS config.
+func serve(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(listener, "", "")
 	}
+	return srv.Serve(listener)
+}
 
-	if s.ipv6Server != nil {
-		ipv6Listener, err := net.Listen("tcp6", s.ipv6Server.Addr)
+// start serves srv on every address cfg lists. listener names it in logs.
+func (s *Server) start(srv *http.Server, cfg *config.HTTPListener, listener string) error {
+	if cfg.TLS.CertFile != "" {
+		reloader, err := certs.NewReloader(&cfg.TLS, listener)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to load %s TLS certificate: %w", listener, err)
 		}
-		waitGrp.Add(1)
+		s.reloaders = append(s.reloaders, reloader)
+		srv.TLSConfig = reloader.TLSConfig()
+	}
+
+	listeners, err := listen(cfg)
+	if err != nil {
+		return err
+	}
+	s.listeners = append(s.listeners, listeners...)
+	// One server serves every listener, so Shutdown closes them all.
+	for _, l := range listeners {
 		go func() {
-			defer waitGrp.Done()
-			if err := s.ipv6Server.Serve(ipv6Listener); err != nil && !s.stopped.Load() {
-				slog.Error("HTTP IPv6 server error", "error", err.Error())
+			if err := serve(srv, l); err != nil && !s.stopped.Load() {
+				slog.Error("HTTP server error", "listener", listener, "address", l.Addr().String(), "error", err.Error())
 			}
 		}()
 	}
-	slog.Info("HTTP server started", "ipv4", s.config.IPV4Host, "ipv6", s.config.IPV6Host, "port", s.config.Port)
-
-	if s.config.Metrics.Enabled {
-		if s.metricsIPV4Server != nil {
-			metricsIPV4Listener, err := net.Listen("tcp4", s.metricsIPV4Server.Addr)
-			if err != nil {
-				return err
-			}
-			waitGrp.Add(1)
-			go func() {
-				defer waitGrp.Done()
-				if err := s.metricsIPV4Server.Serve(metricsIPV4Listener); err != nil && !s.stopped.Load() {
-					slog.Error("Metrics IPv4 server error", "error", err.Error())
-				}
-			}()
-		}
+	slog.Info("HTTP server started", "listener", listener, "listen", cfg.Listen, "tls", cfg.TLS.CertFile != "")
+	return nil
+}
 
-		if s.metricsIPV6Server != nil {
-			metricsIPV6Listener, err := net.Listen("tcp6", s.metricsIPV6Server.Addr)
-			if err != nil {
-				return err
-			}
-			waitGrp.Add(1)
-			go func() {
-				defer waitGrp.Done()
-				if err := s.metricsIPV6Server.Serve(metricsIPV6Listener); err != nil && !s.stopped.Load() {
-					slog.Error("Metrics IPv6 server error", "error", err.Error())
-				}
-			}()
-		}
-		slog.Info("Metrics server started", "ipv4", s.config.Metrics.IPV4Host, "ipv6", s.config.Metrics.IPV6Host, "port", s.config.Metrics.Port)
+// Start serves the API and, when enabled, metrics. If either fails to
+// start, whatever had started is closed again.
+func (s *Server) Start() error {
+	err := s.start(s.apiServer, &s.config.HTTPListener, "api")
+	if err == nil && s.metricsServer != nil {
+		err = s.start(s.metricsServer, &s.config.Metrics.HTTPListener, "metrics")
+	}
+	if err != nil {
+		s.close()
+		return err
 	}
-
-	go func() {
-		waitGrp.Wait()
-	}()
 	return nil
 }
 
+// close closes the servers and their listeners at once, without waiting for
+// requests to finish.
+func (s *Server) close() {
+	s.stopped.Store(true)
+	_ = s.apiServer.Close()
+	if s.metricsServer != nil {
+		_ = s.metricsServer.Close()
+	}
+	// The servers only close the listeners they have begun serving.
+	for _, listener := range s.listeners {
+		_ = listener.Close()
+	}
+	s.listeners = nil
+	for _, reloader := range s.reloaders {
+		_ = reloader.Stop()
+	}
+	s.reloaders = nil
+}
+
 func (s *Server) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -166,26 +159,18 @@ func (s *Server) Stop() error {
 	s.stopped.Store(true)
 
 	errGrp := errgroup.Group{}
-	if s.ipv4Server != nil {
-		errGrp.Go(func() error {
-			return s.ipv4Server.Shutdown(ctx)
-		})
-	}
-	if s.ipv6Server != nil {
+	errGrp.Go(func() error {
+		return s.apiServer.Shutdown(ctx)
+	})
+	if s.metricsServer != nil {
 		errGrp.Go(func() error {
-			return s.ipv6Server.Shutdown(ctx)
-		})
-	}
-	if s.metricsIPV4Server != nil {
-		errGrp.Go(func() error {
-			return s.metricsIPV4Server.Shutdown(ctx)
-		})
-	}
-	if s.metricsIPV6Server != nil {
-		errGrp.Go(func() error {
-			return s.metricsIPV6Server.Shutdown(ctx)
+			return s.metricsServer.Shutdown(ctx)
 		})
 	}
 
-	return errGrp.Wait()
+	err := errGrp.Wait()
+	for _, reloader := range s.reloaders {
+		_ = reloader.Stop()
+	}
+	return err
 }
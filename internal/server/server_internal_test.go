@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/polling"
+)
+
+func TestStartClosesOnFailure(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	apiSocket := filepath.Join(dir, "api.sock")
+	notSocket := filepath.Join(dir, "file")
+	if err := os.WriteFile(notSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.HTTP{
+		HTTPListener: config.HTTPListener{Listen: []string{"unix:" + apiSocket}, SocketMode: "0600"},
+		Metrics: config.Metrics{
+			HTTPListener: config.HTTPListener{Listen: []string{"unix:" + notSocket}, SocketMode: "0600"},
+			Enabled:      true,
+		},
+	}
+	s := &Server{apiServer: &http.Server{}, metricsServer: &http.Server{}, config: cfg}
+
+	if err := s.Start(); err == nil {
+		_ = s.Stop()
+		t.Fatal("Start() succeeded with metrics unable to listen")
+	}
+	if conn, err := net.Dial("unix", apiSocket); err == nil {
+		_ = conn.Close()
+		t.Error("API listener still open after Start() failed")
+	}
+}
+
+func TestPollingVolumeOutlastsWriteTimeout(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "KTLX"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	volume := bytes.Repeat([]byte("AR2V0006."), 2*1024*1024)
+	if err := os.WriteFile(filepath.Join(dir, "KTLX", "KTLX20240418_033635_V06"), volume, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	eventsChannel := make(chan events.Event)
+	t.Cleanup(func() { close(eventsChannel) })
+	pollingDirectory := polling.NewDirectory(&config.Polling{Directory: dir, Stations: []string{"KTLX"}, Volumes: 10}, eventsChannel)
+	t.Cleanup(func() { _ = pollingDirectory.Stop() })
+
+	cfg := &config.HTTP{HTTPListener: config.HTTPListener{Listen: []string{"127.0.0.1:0"}}}
+	s := NewServer(cfg, make(chan events.Event), nil, nil, nil, nil, pollingDirectory, nil, nil, nil)
+	// Far less than the volume takes to read below.
+	s.apiServer.WriteTimeout = 100 * time.Millisecond
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Stop() })
+
+	resp, err := http.Get("http://" + s.listeners[0].Addr().String() + "/polling/KTLX/KTLX20240418_033635_V06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// A slow client: the volume is more than the socket buffers hold, so the
+	// server is still writing it once the write timeout has passed.
+	time.Sleep(500 * time.Millisecond)
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read %d of %d bytes: %v", len(got), len(volume), err)
+	}
+	if !bytes.Equal(got, volume) {
+		t.Errorf("read %d bytes, want the %d byte volume", len(got), len(volume))
+	}
+}
@@ -6,31 +6,48 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/canary"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/websocket"
 	gorillaWebsocket "github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // subscriberBuffer bounds how far behind a slow client may fall before its
 // events start being dropped instead of stalling the hub.
 const subscriberBuffer = 16
 
+//nolint:golint,gochecknoglobals
+var tracer = otel.Tracer("github.com/USA-RedDragon/nexrad-aws-notifier/internal/server/websocket")
+
 // EventsHub fans events from the SQS listener out to every connected client.
 // One hub is shared by the route; each connection gets its own EventsWebsocket.
 type EventsHub struct {
-	eventsChannel chan events.Event
+	eventsChannel <-chan events.Event
+	// canary is told of the canaries that reach the hub, which go no further.
+	canary *canary.Canary
 
 	mu          sync.RWMutex
 	subscribers map[*EventsWebsocket]struct{}
 }
 
-func NewEventsHub(eventsChannel chan events.Event) *EventsHub {
+// NewEventsHub broadcasts the events from eventsChannel. canary is nil unless
+// the canary is enabled.
+func NewEventsHub(eventsChannel <-chan events.Event, canary *canary.Canary) *EventsHub {
 	hub := &EventsHub{
 		eventsChannel: eventsChannel,
+		canary:        canary,
 		subscribers:   make(map[*EventsWebsocket]struct{}),
 	}
 	go hub.run()
@@ -41,7 +58,7 @@ func NewEventsHub(eventsChannel chan events.Event) *EventsHub {
 func (h *EventsHub) NewConnection() websocket.Websocket {
 	return &EventsWebsocket{
 		hub:    h,
-		events: make(chan events.Event, subscriberBuffer),
+		events: make(chan delivery, subscriberBuffer),
 	}
 }
 
@@ -57,6 +74,22 @@ func (h *EventsHub) broadcast(event events.Event) {
 	if event == nil {
 		return
 	}
+	if c, ok := event.(events.CanaryEvent); ok {
+		// The end of the canary's path; it is never sent to clients.
+		if h.canary != nil {
+			h.canary.Delivered(c)
+		}
+		return
+	}
+	// Events straight from a notification continue its trace.
+	ctx := trace.ContextWithSpanContext(context.Background(), events.MetaOf(event).Span)
+	_, span := tracer.Start(ctx, "websocket.broadcast", trace.WithAttributes(
+		attribute.String("event.type", string(event.GetType())),
+		attribute.String("station", event.GetStation()),
+	))
+	defer span.End()
+
+	var delivered, dropped int
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	for sub := range h.subscribers {
@@ -64,24 +97,52 @@ func (h *EventsHub) broadcast(event events.Event) {
 			continue
 		}
 		select {
-		case sub.events <- event:
+		case sub.events <- delivery{event: event, span: span.SpanContext()}:
+			delivered++
 		default:
+			dropped++
+			metrics.WebsocketDrops.WithLabelValues(string(sub.messageType), metrics.Station(sub.station)).Inc()
 			slog.Warn("Dropping event for slow websocket client",
 				"type", sub.messageType, "station", sub.station)
 		}
 	}
+	span.SetAttributes(attribute.Int("websocket.delivered", delivered), attribute.Int("websocket.dropped", dropped))
 }
 
-func (h *EventsHub) add(sub *EventsWebsocket) {
+// add registers sub, first queueing it the current service status. The status
+// is read under the lock broadcast holds, so a change cannot reach sub ahead
+// of the status it replaced.
+func (h *EventsHub) add(sub *EventsWebsocket, status func() events.ServiceStatusEvent) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if status != nil {
+		sub.events <- delivery{event: status()}
+	}
 	h.subscribers[sub] = struct{}{}
+	metrics.WebsocketSubscribers.WithLabelValues(string(sub.messageType), metrics.Station(sub.station)).Inc()
 }
 
 func (h *EventsHub) remove(sub *EventsWebsocket) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	delete(h.subscribers, sub)
+	messageType, station := string(sub.messageType), metrics.Station(sub.station)
+	for other := range h.subscribers {
+		if string(other.messageType) == messageType && metrics.Station(other.station) == station {
+			metrics.WebsocketSubscribers.WithLabelValues(messageType, station).Dec()
+			return
+		}
+	}
+	// Clients choose the station, so series for ones nobody watches any
+	// more are dropped rather than left at zero.
+	metrics.WebsocketSubscribers.DeleteLabelValues(messageType, station)
+}
+
+// delivery is an event queued for one client, with the broadcast span its
+// write is traced under.
+type delivery struct {
+	event events.Event
+	span  trace.SpanContext
 }
 
 // EventsWebsocket serves exactly one websocket connection. Its filter fields
@@ -89,47 +150,97 @@ func (h *EventsHub) remove(sub *EventsWebsocket) {
 // while it is registered, so the hub's mutex covers them.
 type EventsWebsocket struct {
 	hub    *EventsHub
-	events chan events.Event
+	events chan delivery
 
 	messageType events.EventType
 	station     string
+	// excludeMDM drops archive events for metadata-only files.
+	excludeMDM bool
 
 	cancel     context.CancelFunc
 	subscribed bool
 }
 
 func (c *EventsWebsocket) wants(event events.Event) bool {
+	// Control messages go to every connection.
+	if event.GetType() == events.EventTypeServiceStatus {
+		return true
+	}
 	if event.GetType() != c.messageType {
 		return false
 	}
-	switch e := event.(type) {
-	case events.NexradArchiveEvent:
-		return strings.EqualFold(e.Station, c.station)
-	case events.NexradChunkEvent:
-		return strings.EqualFold(e.Station, c.station)
-	default:
+	if archive, ok := event.(events.NexradArchiveEvent); ok && c.excludeMDM && archive.Kind == nexrad.ArchiveKindMDM {
 		return false
 	}
+	return strings.EqualFold(event.GetStation(), c.station)
+}
+
+// upstream maps an event type to the NOAA feeds it is derived from, which
+// are the feeds a connection for it has to keep subscribed.
+func upstream(messageType events.EventType) ([]events.EventType, error) {
+	switch messageType {
+	case events.EventTypeNexradChunk, events.EventTypeNexradDownloaded,
+		events.EventTypeVolumeAssembled, events.EventTypeVolumePartial,
+		events.EventTypeSweepComplete, events.EventTypeNexradImage,
+		events.EventTypeNexradAlert, events.EventTypeStationStatus:
+		return []events.EventType{events.EventTypeNexradChunk}, nil
+	case events.EventTypeNexradArchive:
+		return []events.EventType{events.EventTypeNexradArchive}, nil
+	case events.EventTypeVolumeArchived:
+		return []events.EventType{events.EventTypeNexradChunk, events.EventTypeNexradArchive}, nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", messageType)
+	}
+}
+
+func listen(ctx context.Context, sqsListener *sqs.Listener, feed events.EventType, station string) error {
+	if feed == events.EventTypeNexradChunk {
+		if err := sqsListener.ListenChunk(ctx, station); err != nil {
+			return fmt.Errorf("failed to listen for chunk events: %w", err)
+		}
+		return nil
+	}
+	if err := sqsListener.ListenArchive(ctx, station); err != nil {
+		return fmt.Errorf("failed to listen for archive events: %w", err)
+	}
+	return nil
+}
+
+func unlisten(ctx context.Context, sqsListener *sqs.Listener, feed events.EventType, station string) error {
+	if feed == events.EventTypeNexradChunk {
+		return sqsListener.UnlistenChunk(ctx, station)
+	}
+	return sqsListener.UnlistenArchive(ctx, station)
 }
 
 func (c *EventsWebsocket) OnMessage(_ context.Context, _ *http.Request, _ websocket.Writer, _ []byte, _ int) {
 }
 
-func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w websocket.Writer, messageType events.EventType, station string, sqsListener *sqs.Listener) error {
+func (c *EventsWebsocket) OnConnect(ctx context.Context, r *http.Request, w websocket.Writer, messageType events.EventType, station string, sqsListener *sqs.Listener) error {
 	c.messageType = messageType
 	c.station = station
-
-	switch messageType {
-	case events.EventTypeNexradChunk:
-		if err := sqsListener.ListenChunk(ctx, station); err != nil {
-			return fmt.Errorf("failed to listen for chunk events: %w", err)
+	if mdm := r.URL.Query().Get("mdm"); mdm != "" {
+		include, err := strconv.ParseBool(mdm)
+		if err != nil {
+			return fmt.Errorf("invalid mdm filter %q: %w", mdm, err)
 		}
-	case events.EventTypeNexradArchive:
-		if err := sqsListener.ListenArchive(ctx, station); err != nil {
-			return fmt.Errorf("failed to listen for archive events: %w", err)
+		c.excludeMDM = !include
+	}
+
+	feeds, err := upstream(messageType)
+	if err != nil {
+		return err
+	}
+	for i, feed := range feeds {
+		if err := listen(ctx, sqsListener, feed, station); err != nil {
+			// Release the feeds already taken, as OnDisconnect will not.
+			for _, taken := range feeds[:i] {
+				if err := unlisten(ctx, sqsListener, taken, station); err != nil {
+					slog.Warn("Error stopping SQS listener", "error", err)
+				}
+			}
+			return err
 		}
-	default:
-		return fmt.Errorf("unknown event type %q", messageType)
 	}
 	// Only now is an Unlisten owed, so only now may OnDisconnect do work.
 	c.subscribed = true
@@ -138,23 +249,15 @@ func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w webs
 
 	sendCtx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
-	c.hub.add(c)
+	c.hub.add(c, sqsListener.Health().Status)
 
 	go func() {
 		for {
 			select {
 			case <-sendCtx.Done():
 				return
-			case event := <-c.events:
-				eventDataJSON, err := json.Marshal(event)
-				if err != nil {
-					slog.Warn("Error marshalling event data", "error", err)
-					continue
-				}
-				w.WriteMessage(websocket.Message{
-					Type: gorillaWebsocket.TextMessage,
-					Data: eventDataJSON,
-				})
+			case d := <-c.events:
+				c.send(trace.ContextWithSpanContext(sendCtx, d.span), w, d.event)
 			}
 		}
 	}()
@@ -162,6 +265,26 @@ func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w webs
 	return nil
 }
 
+func (c *EventsWebsocket) send(ctx context.Context, w websocket.Writer, event events.Event) {
+	_, span := tracer.Start(ctx, "websocket.write", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	eventDataJSON, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("Error marshalling event data", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	w.WriteMessage(websocket.Message{
+		Type: gorillaWebsocket.TextMessage,
+		Data: eventDataJSON,
+	})
+	if published := events.MetaOf(event).Published; !published.IsZero() {
+		metrics.DeliveryLatency.WithLabelValues(string(event.GetType())).Observe(time.Since(published).Seconds())
+	}
+}
+
 func (c *EventsWebsocket) OnDisconnect(ctx context.Context, _ *http.Request, messageType events.EventType, station string, sqsListener *sqs.Listener) {
 	if !c.subscribed {
 		return
@@ -175,14 +298,11 @@ func (c *EventsWebsocket) OnDisconnect(ctx context.Context, _ *http.Request, mes
 
 	slog.Info("Websocket disconnected", "type", messageType, "station", station)
 
-	var err error
-	switch messageType {
-	case events.EventTypeNexradChunk:
-		err = sqsListener.UnlistenChunk(ctx, station)
-	case events.EventTypeNexradArchive:
-		err = sqsListener.UnlistenArchive(ctx, station)
-	}
-	if err != nil {
-		slog.Warn("Error stopping SQS listener", "error", err)
+	// OnConnect only subscribed if the type was known.
+	feeds, _ := upstream(messageType)
+	for _, feed := range feeds {
+		if err := unlisten(ctx, sqsListener, feed, station); err != nil {
+			slog.Warn("Error stopping SQS listener", "error", err)
+		}
 	}
 }
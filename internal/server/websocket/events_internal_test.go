@@ -1,9 +1,20 @@
 package websocket
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func newTestHub() *EventsHub {
@@ -13,19 +24,19 @@ func newTestHub() *EventsHub {
 func newTestSub(hub *EventsHub, messageType events.EventType, station string) *EventsWebsocket {
 	sub := &EventsWebsocket{
 		hub:         hub,
-		events:      make(chan events.Event, subscriberBuffer),
+		events:      make(chan delivery, subscriberBuffer),
 		messageType: messageType,
 		station:     station,
 	}
-	hub.add(sub)
+	hub.add(sub, nil)
 	return sub
 }
 
 func received(t *testing.T, sub *EventsWebsocket) (events.Event, bool) {
 	t.Helper()
 	select {
-	case event := <-sub.events:
-		return event, true
+	case d := <-sub.events:
+		return d.event, true
 	default:
 		return nil, false
 	}
@@ -49,7 +60,7 @@ func TestBroadcastReachesEverySubscriber(t *testing.T) {
 			t.Errorf("%s subscriber received nothing", name)
 			continue
 		}
-		if got != events.Event(event) {
+		if !reflect.DeepEqual(got, events.Event(event)) {
 			t.Errorf("%s subscriber got %v, want %v", name, got, event)
 		}
 	}
@@ -75,6 +86,14 @@ func TestBroadcastFilters(t *testing.T) {
 			events.NexradChunkEvent{Station: "KFCX"}, false},
 		{"matching archive", events.EventTypeNexradArchive, "KFCX",
 			events.NexradArchiveEvent{Station: "KFCX"}, true},
+		{"matching sweep", events.EventTypeSweepComplete, "kfcx",
+			events.NexradSweepEvent{Station: "KFCX"}, true},
+		{"sweep for another station", events.EventTypeSweepComplete, "KFCX",
+			events.NexradSweepEvent{Station: "KTLX"}, false},
+		{"matching volume archived", events.EventTypeVolumeArchived, "KFCX",
+			events.VolumeArchivedEvent{Station: "KFCX", Match: events.VolumeChunkOnly}, true},
+		{"service status", events.EventTypeNexradArchive, "KFCX",
+			events.ServiceStatusEvent{Status: events.ServiceDown}, true},
 	}
 
 	for _, tt := range tests {
@@ -90,6 +109,27 @@ func TestBroadcastFilters(t *testing.T) {
 	}
 }
 
+func TestBroadcastExcludesMDM(t *testing.T) {
+	t.Parallel()
+	hub := newTestHub()
+	all := newTestSub(hub, events.EventTypeNexradArchive, "KTLX")
+	volumesOnly := newTestSub(hub, events.EventTypeNexradArchive, "KTLX")
+	volumesOnly.excludeMDM = true
+
+	hub.broadcast(events.NexradArchiveEvent{Station: "KTLX", Kind: nexrad.ArchiveKindMDM})
+	if _, ok := received(t, all); !ok {
+		t.Error("unfiltered subscriber did not receive the MDM event")
+	}
+	if _, ok := received(t, volumesOnly); ok {
+		t.Error("subscriber excluding MDM received the MDM event")
+	}
+
+	hub.broadcast(events.NexradArchiveEvent{Station: "KTLX", Kind: nexrad.ArchiveKindVolume})
+	if _, ok := received(t, volumesOnly); !ok {
+		t.Error("subscriber excluding MDM did not receive the volume event")
+	}
+}
+
 // A client that stops reading must not wedge the hub for everyone else.
 func TestBroadcastDropsForSlowSubscriber(t *testing.T) {
 	t.Parallel()
@@ -112,6 +152,48 @@ func TestBroadcastDropsForSlowSubscriber(t *testing.T) {
 	}
 }
 
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	hub := newTestHub()
+	// The metrics are global, so this station is used by no other test.
+	first := newTestSub(hub, events.EventTypeNexradAlert, "kmet")
+	second := newTestSub(hub, events.EventTypeNexradAlert, "KMET")
+	subscribers := metrics.WebsocketSubscribers.WithLabelValues(string(events.EventTypeNexradAlert), "KMET")
+	if got := testutil.ToFloat64(subscribers); got != 2 {
+		t.Errorf("subscribers = %v, want 2", got)
+	}
+
+	for range subscriberBuffer + 3 {
+		hub.broadcast(events.NexradAlertEvent{Station: "KMET"})
+	}
+	drops := metrics.WebsocketDrops.WithLabelValues(string(events.EventTypeNexradAlert), "KMET")
+	if got := testutil.ToFloat64(drops); got != 6 {
+		t.Errorf("drops = %v, want 3 for each subscriber", got)
+	}
+
+	hub.remove(first)
+	if got := testutil.ToFloat64(subscribers); got != 1 {
+		t.Errorf("subscribers = %v after a disconnect, want 1", got)
+	}
+	hub.remove(second)
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "nexrad_aws_notifier_websocket_subscribers" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "station" && label.GetValue() == "KMET" {
+					t.Error("subscriber series kept after the last subscriber left")
+				}
+			}
+		}
+	}
+}
+
 func TestRemoveStopsDelivery(t *testing.T) {
 	t.Parallel()
 	hub := newTestHub()
@@ -124,3 +206,98 @@ func TestRemoveStopsDelivery(t *testing.T) {
 		t.Error("removed subscriber still received an event")
 	}
 }
+
+func TestUpstream(t *testing.T) {
+	t.Parallel()
+	feeds, err := upstream(events.EventTypeVolumeArchived)
+	if err != nil || !reflect.DeepEqual(feeds, []events.EventType{events.EventTypeNexradChunk, events.EventTypeNexradArchive}) {
+		t.Errorf("upstream(volume-archived) = %v, %v, want both feeds", feeds, err)
+	}
+	feeds, err = upstream(events.EventTypeSweepComplete)
+	if err != nil || !reflect.DeepEqual(feeds, []events.EventType{events.EventTypeNexradChunk}) {
+		t.Errorf("upstream(sweep-complete) = %v, %v, want the chunk feed", feeds, err)
+	}
+	if _, err := upstream("nexrad-bogus"); err == nil {
+		t.Error("upstream accepted an unknown type")
+	}
+}
+
+// Every connection hears about the service status, starting with the one
+// current when it connects.
+func TestServiceStatus(t *testing.T) {
+	t.Parallel()
+	hub := newTestHub()
+	sub := &EventsWebsocket{
+		hub:         hub,
+		events:      make(chan delivery, subscriberBuffer),
+		messageType: events.EventTypeNexradArchive,
+		station:     "KFCX",
+	}
+	hub.add(sub, func() events.ServiceStatusEvent {
+		return events.ServiceStatusEvent{Type: events.EventTypeServiceStatus, Status: events.ServiceDegraded}
+	})
+	chunks := newTestSub(hub, events.EventTypeNexradChunk, "KTLX")
+
+	got, ok := received(t, sub)
+	if status, isStatus := got.(events.ServiceStatusEvent); !ok || !isStatus || status.Status != events.ServiceDegraded {
+		t.Fatalf("first message = %+v, want the current service status", got)
+	}
+
+	hub.broadcast(events.ServiceStatusEvent{Type: events.EventTypeServiceStatus, Status: events.ServiceDown, Previous: events.ServiceDegraded})
+	for name, s := range map[string]*EventsWebsocket{"archive": sub, "chunk": chunks} {
+		got, ok := received(t, s)
+		if status, isStatus := got.(events.ServiceStatusEvent); !ok || !isStatus || status.Status != events.ServiceDown {
+			t.Errorf("%s subscriber got %+v, want the status change", name, got)
+		}
+	}
+}
+
+type discardWriter struct{}
+
+func (discardWriter) WriteMessage(websocket.Message) {}
+func (discardWriter) Error(string)                   {}
+
+func TestCanaryNotBroadcast(t *testing.T) {
+	t.Parallel()
+	hub := newTestHub()
+	sub := newTestSub(hub, events.EventTypeCanary, "")
+	hub.broadcast(events.CanaryEvent{ID: "0192f1c4-7b1a-7c3e-9a51-3f6b2d1e8a90"})
+	if got, ok := received(t, sub); ok {
+		t.Errorf("client received %+v", got)
+	}
+}
+
+// An event's broadcast and each client's write must join the trace of the
+// notification it came from. The tracer provider is global, so this test
+// does not run in parallel.
+func TestTraceLinksDelivery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, publish := otel.Tracer("test").Start(context.Background(), "events.publish")
+	publish.End()
+
+	hub := newTestHub()
+	sub := newTestSub(hub, events.EventTypeNexradChunk, "KTRC")
+	hub.broadcast(events.NexradChunkEvent{Station: "KTRC", Meta: events.Meta{Span: publish.SpanContext()}})
+	d := <-sub.events
+	sub.send(trace.ContextWithSpanContext(context.Background(), d.span), discardWriter{}, d.event)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	broadcast, write := spans["websocket.broadcast"], spans["websocket.write"]
+	if broadcast == nil || write == nil {
+		t.Fatalf("got spans %v, want a broadcast and a write", spans)
+	}
+	if broadcast.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Error("broadcast span is not a child of the publish span")
+	}
+	if write.Parent().SpanID() != broadcast.SpanContext().SpanID() {
+		t.Error("write span is not a child of the broadcast span")
+	}
+	if write.SpanContext().TraceID() != publish.SpanContext().TraceID() {
+		t.Error("write span is in a different trace")
+	}
+}
@@ -0,0 +1,229 @@
+package snshttp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SignatureVersion 1 is SHA1withRSA by definition.
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+const (
+	TypeNotification             = "Notification"
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// maxCertSize caps the signing certificate download. Real ones are ~2KiB.
+const maxCertSize = 64 * 1024
+
+var (
+	ErrUntrustedCertURL            = errors.New("signing certificate URL is not trusted")
+	ErrUnsupportedSignatureVersion = errors.New("unsupported signature version")
+	ErrUnknownMessageType          = errors.New("unknown message type")
+	ErrInvalidSignature            = errors.New("invalid signature")
+	ErrInvalidCertificate          = errors.New("invalid signing certificate")
+)
+
+// Message is the JSON envelope SNS POSTs to HTTP(S) subscribers. It is the
+// same document SNS writes into an SQS queue body.
+type Message struct {
+	Type              string                      `json:"Type"`
+	MessageID         string                      `json:"MessageId"`
+	Token             string                      `json:"Token"`
+	TopicArn          string                      `json:"TopicArn"`
+	Subject           string                      `json:"Subject"`
+	Message           string                      `json:"Message"`
+	Timestamp         string                      `json:"Timestamp"`
+	SignatureVersion  string                      `json:"SignatureVersion"`
+	Signature         string                      `json:"Signature"`
+	SigningCertURL    string                      `json:"SigningCertURL"`
+	SubscribeURL      string                      `json:"SubscribeURL"`
+	UnsubscribeURL    string                      `json:"UnsubscribeURL"`
+	MessageAttributes map[string]MessageAttribute `json:"MessageAttributes"`
+}
+
+type MessageAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// stringToSign builds the canonical form SNS signs, which differs between
+// notifications and the two subscription messages.
+func (m *Message) stringToSign() (string, error) {
+	var fields [][2]string
+	switch m.Type {
+	case TypeNotification:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+		}
+		// Subject is only signed when SNS included one.
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields,
+			[2]string{"Timestamp", m.Timestamp},
+			[2]string{"TopicArn", m.TopicArn},
+			[2]string{"Type", m.Type},
+		)
+	case TypeSubscriptionConfirmation, TypeUnsubscribeConfirmation:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+			{"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp},
+			{"Token", m.Token},
+			{"TopicArn", m.TopicArn},
+			{"Type", m.Type},
+		}
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownMessageType, m.Type)
+	}
+
+	var sb strings.Builder
+	for _, field := range fields {
+		sb.WriteString(field[0])
+		sb.WriteByte('\n')
+		sb.WriteString(field[1])
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// Verifier checks SNS message signatures. Signing certificates are only
+// fetched over HTTPS from an allowlisted host and are cached by URL until
+// they expire.
+type Verifier struct {
+	client *http.Client
+	hosts  []string
+	certs  *xsync.MapOf[string, *x509.Certificate]
+}
+
+// NewVerifier returns a Verifier that trusts certificates served by hosts. A
+// nil client uses http.DefaultClient.
+func NewVerifier(hosts []string, client *http.Client) *Verifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(host)))
+	}
+	return &Verifier{
+		client: client,
+		hosts:  normalized,
+		certs:  xsync.NewMapOf[string, *x509.Certificate](),
+	}
+}
+
+// Verify reports whether msg carries a valid SNS signature.
+func (v *Verifier) Verify(ctx context.Context, msg *Message) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedSignatureVersion, msg.SignatureVersion)
+	}
+
+	toSign, err := msg.stringToSign()
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	cert, err := v.certificate(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: not an RSA key", ErrInvalidCertificate)
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(toSign)) //nolint:gosec // See import.
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(toSign))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+func (v *Verifier) trusted(certURL string) bool {
+	parsed, err := url.Parse(certURL)
+	if err != nil || parsed.Scheme != "https" {
+		return false
+	}
+	if !strings.HasSuffix(parsed.Path, ".pem") {
+		return false
+	}
+	return slices.Contains(v.hosts, strings.ToLower(parsed.Host))
+}
+
+func (v *Verifier) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if !v.trusted(certURL) {
+		return nil, fmt.Errorf("%w: %q", ErrUntrustedCertURL, certURL)
+	}
+	if cert, ok := v.certs.Load(certURL); ok && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCertSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data", ErrInvalidCertificate)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w: outside its validity period", ErrInvalidCertificate)
+	}
+
+	v.certs.Store(certURL, cert)
+	return cert, nil
+}
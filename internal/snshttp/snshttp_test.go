@@ -0,0 +1,199 @@
+package snshttp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SignatureVersion 1 is SHA1withRSA by definition.
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+)
+
+type signer struct {
+	key     *rsa.PrivateKey
+	server  *httptest.Server
+	fetches atomic.Int32
+}
+
+func newSigner(t *testing.T) *signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.us-east-1.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	s := &signer{key: key}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.fetches.Add(1)
+		_, _ = w.Write(certPEM)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *signer) host(t *testing.T) string {
+	t.Helper()
+	parsed, err := url.Parse(s.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Host
+}
+
+func (s *signer) sign(t *testing.T, msg *snshttp.Message, toSign string) {
+	t.Helper()
+	var (
+		hash   crypto.Hash
+		digest []byte
+	)
+	switch msg.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(toSign)) //nolint:gosec // See import.
+		hash, digest = crypto.SHA1, sum[:]
+	default:
+		sum := sha256.Sum256([]byte(toSign))
+		hash, digest = crypto.SHA256, sum[:]
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	msg.SigningCertURL = s.server.URL + "/SimpleNotificationService-test.pem"
+}
+
+func notification(version string) *snshttp.Message {
+	return &snshttp.Message{
+		Type:             snshttp.TypeNotification,
+		MessageID:        "1f3c0f2b-0000-0000-0000-000000000000",
+		TopicArn:         "arn:aws:sns:us-east-1:684042711724:NewNEXRADLevel2Archive",
+		Message:          `{"Records":[]}`,
+		Timestamp:        "2024-04-18T03:36:35.000Z",
+		SignatureVersion: version,
+	}
+}
+
+func notificationString(m *snshttp.Message) string {
+	return strings.Join([]string{
+		"Message", m.Message,
+		"MessageId", m.MessageID,
+		"Timestamp", m.Timestamp,
+		"TopicArn", m.TopicArn,
+		"Type", m.Type,
+	}, "\n") + "\n"
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	s := newSigner(t)
+	verifier := snshttp.NewVerifier([]string{s.host(t)}, s.server.Client())
+
+	for _, version := range []string{"1", "2"} {
+		msg := notification(version)
+		s.sign(t, msg, notificationString(msg))
+		if err := verifier.Verify(context.Background(), msg); err != nil {
+			t.Errorf("SignatureVersion %s: unexpected error: %v", version, err)
+		}
+	}
+
+	if got := s.fetches.Load(); got != 1 {
+		t.Errorf("certificate fetched %d times, want it cached after the first", got)
+	}
+}
+
+func TestVerifySubscriptionConfirmation(t *testing.T) {
+	t.Parallel()
+	s := newSigner(t)
+	verifier := snshttp.NewVerifier([]string{s.host(t)}, s.server.Client())
+
+	msg := &snshttp.Message{
+		Type:             snshttp.TypeSubscriptionConfirmation,
+		MessageID:        "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:            "2336412f37f",
+		TopicArn:         "arn:aws:sns:us-east-1:684042711724:NewNEXRADLevel2Archive",
+		Message:          "You have chosen to subscribe to the topic.",
+		SubscribeURL:     "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription",
+		Timestamp:        "2024-04-18T03:36:35.000Z",
+		SignatureVersion: "1",
+	}
+	s.sign(t, msg, strings.Join([]string{
+		"Message", msg.Message,
+		"MessageId", msg.MessageID,
+		"SubscribeURL", msg.SubscribeURL,
+		"Timestamp", msg.Timestamp,
+		"Token", msg.Token,
+		"TopicArn", msg.TopicArn,
+		"Type", msg.Type,
+	}, "\n")+"\n")
+
+	if err := verifier.Verify(context.Background(), msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	t.Parallel()
+	s := newSigner(t)
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		mutate  func(*snshttp.Message)
+		wantErr error
+	}{
+		{"tampered message", nil, func(m *snshttp.Message) { m.Message = `{"Records":[{}]}` }, snshttp.ErrInvalidSignature},
+		{"tampered topic", nil, func(m *snshttp.Message) { m.TopicArn += "x" }, snshttp.ErrInvalidSignature},
+		{"host not allowlisted", []string{"sns.us-east-1.amazonaws.com"}, func(*snshttp.Message) {}, snshttp.ErrUntrustedCertURL},
+		{"plain http cert url", nil, func(m *snshttp.Message) {
+			m.SigningCertURL = strings.Replace(m.SigningCertURL, "https://", "http://", 1)
+		}, snshttp.ErrUntrustedCertURL},
+		{"not a pem path", nil, func(m *snshttp.Message) { m.SigningCertURL = strings.TrimSuffix(m.SigningCertURL, ".pem") + ".txt" }, snshttp.ErrUntrustedCertURL},
+		{"unknown signature version", nil, func(m *snshttp.Message) { m.SignatureVersion = "3" }, snshttp.ErrUnsupportedSignatureVersion},
+		{"unknown type", nil, func(m *snshttp.Message) { m.Type = "Other" }, snshttp.ErrUnknownMessageType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hosts := tt.hosts
+			if hosts == nil {
+				hosts = []string{s.host(t)}
+			}
+			verifier := snshttp.NewVerifier(hosts, s.server.Client())
+
+			msg := notification("2")
+			s.sign(t, msg, notificationString(msg))
+			tt.mutate(msg)
+
+			if err := verifier.Verify(context.Background(), msg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const (
+	// canaryAttribute tags a chunk notification as one we sent ourselves. Its
+	// value is the canary's ID.
+	canaryAttribute = "NexradAwsNotifierCanary"
+	// canaryStation is a station that does not exist, so the canary can't be
+	// mistaken for a real chunk even if it escapes.
+	canaryStation = "ZZZZ"
+)
+
+// SendCanary puts a notification shaped like one from the chunk topic on the
+// chunk queue, tagged with id. When it is received it is published as a
+// CanaryEvent rather than a chunk event.
+func (l *Listener) SendCanary(ctx context.Context, id string) error {
+	body, err := canaryNotification(id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	l.resourceMu.RLock()
+	queueURL := l.chunkQueueURL
+	l.resourceMu.RUnlock()
+	_, err = l.awsSqs.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send canary: %w", err)
+	}
+	return nil
+}
+
+// canaryNotification builds the body of a canary sent at now. It passes the
+// same checks as a real chunk notification.
+func canaryNotification(id string, now time.Time) (string, error) {
+	message := ChunkNotificationMessage{
+		S3Bucket:  nexrad.ChunkBucket,
+		Key:       fmt.Sprintf("%s/1/%s-001-S", canaryStation, now.Format("20060102-150405")),
+		SiteID:    canaryStation,
+		DateTime:  now.Format("2006-01-02T15:04:05"),
+		VolumeID:  "1",
+		ChunkID:   "1",
+		ChunkType: "S",
+		L2Version: "V06",
+	}
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	var notification ChunkNotification
+	notification.Type = snshttp.TypeNotification
+	notification.MessageID = id
+	notification.TopicArn = nexradChunkTopicARN
+	notification.Message = string(messageJSON)
+	notification.Timestamp = now.Format(time.RFC3339Nano)
+	notification.MessageAttributes = map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	}{
+		"SiteID":        {Type: "String", Value: message.SiteID},
+		"VolumeID":      {Type: "Number", Value: message.VolumeID},
+		"ChunkID":       {Type: "Number", Value: message.ChunkID},
+		"ChunkType":     {Type: "String", Value: message.ChunkType},
+		"L2Version":     {Type: "String", Value: message.L2Version},
+		canaryAttribute: {Type: "String", Value: id},
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// canaryID returns the ID a canary notification was tagged with, or "" if
+// notification is a real one.
+func canaryID(notification ChunkNotification) string {
+	return notification.MessageAttributes[canaryAttribute].Value
+}
+
+// onCanary publishes a canary that made it through parsing. It goes on the
+// bus like any other event, so it takes the same path to the websocket hub.
+func (l *Listener) onCanary(ctx context.Context, id string, published time.Time) {
+	event := events.CanaryEvent{ID: id, Meta: events.Meta{Published: published}}
+	if l.running.Load() {
+		_, publish := startPublish(ctx, event)
+		event.Meta.Span = publish.SpanContext()
+		l.eventChan <- event
+		publish.End()
+	}
+}
@@ -0,0 +1,37 @@
+package sqs
+
+import (
+	"context"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/health"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+const (
+	ArchiveTopicARN = nexradArchiveTopicARN
+	ChunkTopicARN   = nexradChunkTopicARN
+)
+
+// NewHTTPTestListener is a running listener in http ingest mode that calls
+// snsClient and checks signatures with verifier, without the AWS credentials
+// NewListener needs.
+func NewHTTPTestListener(ingest *config.Ingest, eventChan chan events.Event, snsClient *sns.Client, verifier *snshttp.Verifier, workers int) *Listener {
+	l := &Listener{
+		config:       ingest,
+		eventChan:    eventChan,
+		archiveSites: xsync.NewMapOf[string, uint](),
+		chunkSites:   xsync.NewMapOf[string, uint](),
+		awsSns:       snsClient,
+		verifier:     verifier,
+		chunkWorkers: make(chan struct{}, workers),
+		health:       health.NewTracker(&ingest.Health, ingest.Mode, nil, metrics.QueueChunk, metrics.QueueArchive),
+	}
+	l.running.Store(true)
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l
+}
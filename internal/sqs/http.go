@@ -0,0 +1,146 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+var (
+	ErrHTTPIngestDisabled = errors.New("http ingest mode is not enabled")
+	ErrUnknownTopic       = errors.New("message is not from a NEXRAD topic")
+)
+
+// subscribeEndpoint asks SNS to deliver both topics to our public URL. The
+// subscriptions stay pending until HandleSNS accepts their confirmations.
+func (l *Listener) subscribeEndpoint() error {
+	if err := l.subscribeEndpointTopic(nexradArchiveTopicARN); err != nil {
+		return err
+	}
+	if err := l.subscribeEndpointTopic(nexradChunkTopicARN); err != nil {
+		_ = l.destroyArchiveSubscription()
+		return err
+	}
+	slog.Info("Subscribed SNS endpoint, waiting for confirmation", "endpoint", l.config.SNS.EndpointURL)
+	return nil
+}
+
+// subscribeEndpointTopic asks SNS to deliver topicARN to our public URL.
+func (l *Listener) subscribeEndpointTopic(topicARN string) error {
+	endpoint, err := url.Parse(l.config.SNS.EndpointURL)
+	if err != nil {
+		return fmt.Errorf("invalid SNS endpoint URL: %w", err)
+	}
+
+	input := &sns.SubscribeInput{
+		Protocol:              aws.String(endpoint.Scheme),
+		TopicArn:              aws.String(topicARN),
+		Endpoint:              aws.String(endpoint.String()),
+		ReturnSubscriptionArn: true,
+	}
+	if topicARN == nexradChunkTopicARN {
+		input.Attributes = map[string]string{
+			"FilterPolicy": `{
+				"SiteID": ["nonsense"]
+			}`,
+		}
+	}
+	resp, err := l.awsSns.Subscribe(context.TODO(), input)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topicARN, err)
+	}
+
+	l.resourceMu.Lock()
+	defer l.resourceMu.Unlock()
+	if topicARN == nexradChunkTopicARN {
+		l.nexradChunkSubscriptionARN = *resp.SubscriptionArn
+	} else {
+		l.nexradArchiveSubscriptionARN = *resp.SubscriptionArn
+	}
+	return nil
+}
+
+// HandleSNS processes one message POSTed by SNS in http ingest mode. The
+// signature is verified before anything in the message is acted on.
+func (l *Listener) HandleSNS(ctx context.Context, body []byte) error {
+	if l.config.Mode != config.IngestModeHTTP {
+		return ErrHTTPIngestDisabled
+	}
+
+	var msg snshttp.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return fmt.Errorf("failed to unmarshal SNS message: %w", err)
+	}
+	if msg.TopicArn != nexradArchiveTopicARN && msg.TopicArn != nexradChunkTopicARN {
+		return fmt.Errorf("%w: %q", ErrUnknownTopic, msg.TopicArn)
+	}
+	if err := l.verifier.Verify(ctx, &msg); err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case snshttp.TypeSubscriptionConfirmation:
+		return l.confirmSubscription(ctx, &msg)
+	case snshttp.TypeUnsubscribeConfirmation:
+		slog.Warn("SNS subscription removed", "topic", msg.TopicArn)
+		feed := metrics.QueueArchive
+		if msg.TopicArn == nexradChunkTopicARN {
+			feed = metrics.QueueChunk
+			l.confirmedChunkARN.Store(nil)
+		} else {
+			l.confirmedArchiveARN.Store(nil)
+		}
+		l.health.SetSubscribed(feed, false)
+		// Unless it was us, on the way out, subscribe again.
+		if l.running.Load() {
+			go func() {
+				if err := l.resubscribe(feed); err != nil {
+					slog.Warn("Failed to recreate subscription", "feed", feed, "error", err)
+				}
+			}()
+		}
+	case snshttp.TypeNotification:
+		if msg.TopicArn == nexradChunkTopicARN {
+			// Decoding the chunk can take a while; SNS shouldn't wait on it,
+			// unless every worker is busy. Then it waits for one, and if the
+			// request ends first, SNS is told to deliver it again.
+			if err := l.goChunk(ctx, string(body)); err != nil {
+				return fmt.Errorf("no chunk worker free: %w", err)
+			}
+		} else {
+			l.onArchiveMessage(ctx, string(body))
+		}
+	}
+	return nil
+}
+
+func (l *Listener) confirmSubscription(ctx context.Context, msg *snshttp.Message) error {
+	resp, err := l.awsSns.ConfirmSubscription(ctx, &sns.ConfirmSubscriptionInput{
+		TopicArn:                  aws.String(msg.TopicArn),
+		Token:                     aws.String(msg.Token),
+		AuthenticateOnUnsubscribe: aws.String("true"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to confirm subscription: %w", err)
+	}
+	slog.Info("Confirmed SNS subscription", "topic", msg.TopicArn, "subscription", *resp.SubscriptionArn)
+
+	if msg.TopicArn == nexradArchiveTopicARN {
+		l.confirmedArchiveARN.Store(resp.SubscriptionArn)
+		l.health.SetSubscribed(metrics.QueueArchive, true)
+		return nil
+	}
+	l.confirmedChunkARN.Store(resp.SubscriptionArn)
+	l.health.SetSubscribed(metrics.QueueChunk, true)
+	// Stations may have been requested while the subscription was pending.
+	return l.updateFilterPolicy(ctx)
+}
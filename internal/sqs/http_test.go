@@ -0,0 +1,416 @@
+package sqs_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/server/api"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/gin-gonic/gin"
+)
+
+// snsStandIn answers the SNS API calls the listener makes in http ingest
+// mode, and serves the certificate messages are signed with.
+type snsStandIn struct {
+	key     *rsa.PrivateKey
+	certs   *httptest.Server
+	api     *httptest.Server
+	actions chan url.Values
+}
+
+func newSNSStandIn(t *testing.T) *snsStandIn {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.us-east-1.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	s := &snsStandIn{key: key, actions: make(chan url.Values, 10)}
+	s.certs = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(certPEM)
+	}))
+	t.Cleanup(s.certs.Close)
+	s.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.actions <- r.PostForm
+		action := r.PostForm.Get("Action")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<%[1]sResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/"><%[1]sResult><SubscriptionArn>%[2]s:subscription</SubscriptionArn></%[1]sResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></%[1]sResponse>`,
+			action, r.PostForm.Get("TopicArn"))
+	}))
+	t.Cleanup(s.api.Close)
+	return s
+}
+
+func (s *snsStandIn) listener(t *testing.T, eventChan chan events.Event, workers int) *sqs.Listener {
+	t.Helper()
+	certURL, err := url.Parse(s.certs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := sns.New(sns.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(s.api.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	ingest := &config.Ingest{
+		Mode: config.IngestModeHTTP,
+		SNS:  config.SNS{EndpointURL: "https://notifier.example.com/api/sns"},
+	}
+	return sqs.NewHTTPTestListener(ingest, eventChan, client, snshttp.NewVerifier([]string{certURL.Host}, s.certs.Client()), workers)
+}
+
+// sign signs msg the way SNS does with SignatureVersion 2.
+func (s *snsStandIn) sign(t *testing.T, msg *snshttp.Message) {
+	t.Helper()
+	fields := []string{"Message", msg.Message, "MessageId", msg.MessageID}
+	if msg.Type == snshttp.TypeNotification {
+		fields = append(fields, "Timestamp", msg.Timestamp, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	} else {
+		fields = append(fields, "SubscribeURL", msg.SubscribeURL, "Timestamp", msg.Timestamp, "Token", msg.Token, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n") + "\n"))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.SignatureVersion = "2"
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	msg.SigningCertURL = s.certs.URL + "/SimpleNotificationService-test.pem"
+}
+
+func newRouter(listener *sqs.Listener) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("sqsListener", listener)
+		c.Next()
+	})
+	r.POST("/api/sns", api.POSTSNS)
+	return r
+}
+
+func post(ctx context.Context, t *testing.T, r *gin.Engine, msg *snshttp.Message) int {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/sns", bytes.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func message(msgType, topicARN string) *snshttp.Message {
+	return &snshttp.Message{
+		Type:      msgType,
+		MessageID: "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		TopicArn:  topicARN,
+		Timestamp: "2024-04-18T03:36:35.000Z",
+	}
+}
+
+func confirmation(msgType, topicARN string) *snshttp.Message {
+	msg := message(msgType, topicARN)
+	msg.Token = "2336412f37f"
+	msg.Message = "You have chosen to subscribe to the topic."
+	msg.SubscribeURL = "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription"
+	return msg
+}
+
+func chunkMessage() *snshttp.Message {
+	msg := message(snshttp.TypeNotification, sqs.ChunkTopicARN)
+	msg.Message = `{"S3Bucket":"unidata-nexrad-level2-chunks","Key":"KJAX/415/20240418-033635-025-I","SiteID":"KJAX","DateTime":"2024-04-18T03:36:35","VolumeID":"415","ChunkID":"25","ChunkType":"I","L2Version":"V06"}`
+	msg.MessageAttributes = map[string]snshttp.MessageAttribute{
+		"SiteID":    {Type: "String", Value: "KJAX"},
+		"VolumeID":  {Type: "String", Value: "415"},
+		"ChunkID":   {Type: "String", Value: "25"},
+		"ChunkType": {Type: "String", Value: "I"},
+		"L2Version": {Type: "String", Value: "V06"},
+	}
+	return msg
+}
+
+func waitForAction(t *testing.T, s *snsStandIn, want string) url.Values {
+	t.Helper()
+	select {
+	case form := <-s.actions:
+		if got := form.Get("Action"); got != want {
+			t.Fatalf("SNS got %s, want %s", got, want)
+		}
+		return form
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SNS never got %s", want)
+	}
+	return nil
+}
+
+func waitForEvent(t *testing.T, eventChan chan events.Event) events.Event {
+	t.Helper()
+	select {
+	case event := <-eventChan:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event published")
+	}
+	return nil
+}
+
+func TestPOSTSNSRejectsUnknownTopic(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	r := newRouter(s.listener(t, make(chan events.Event, 10), 1))
+
+	msg := confirmation(snshttp.TypeSubscriptionConfirmation, "arn:aws:sns:us-east-1:123456789012:Other")
+	s.sign(t, msg)
+	if code := post(context.Background(), t, r, msg); code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+	}
+	select {
+	case form := <-s.actions:
+		t.Errorf("SNS got %s for another topic's message", form.Get("Action"))
+	default:
+	}
+}
+
+func TestPOSTSNSRejectsBadSignature(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	r := newRouter(s.listener(t, make(chan events.Event, 10), 1))
+
+	msg := confirmation(snshttp.TypeSubscriptionConfirmation, sqs.ArchiveTopicARN)
+	s.sign(t, msg)
+	msg.Token = "forged"
+	if code := post(context.Background(), t, r, msg); code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestPOSTSNSSubscriptionConfirmation(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	listener := s.listener(t, make(chan events.Event, 10), 1)
+	r := newRouter(listener)
+
+	msg := confirmation(snshttp.TypeSubscriptionConfirmation, sqs.ArchiveTopicARN)
+	s.sign(t, msg)
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	form := waitForAction(t, s, "ConfirmSubscription")
+	if form.Get("Token") != msg.Token || form.Get("TopicArn") != sqs.ArchiveTopicARN {
+		t.Errorf("confirmed %v, want the message's token and topic", form)
+	}
+	if !listener.Health().Report().Subscriptions[metrics.QueueArchive] {
+		t.Error("archive subscription not reported as confirmed")
+	}
+}
+
+func TestPOSTSNSUnsubscribeConfirmation(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	listener := s.listener(t, make(chan events.Event, 10), 1)
+	r := newRouter(listener)
+
+	msg := confirmation(snshttp.TypeSubscriptionConfirmation, sqs.ArchiveTopicARN)
+	s.sign(t, msg)
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	waitForAction(t, s, "ConfirmSubscription")
+
+	msg = confirmation(snshttp.TypeUnsubscribeConfirmation, sqs.ArchiveTopicARN)
+	s.sign(t, msg)
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	// Someone else removed the subscription, so it is made again.
+	form := waitForAction(t, s, "Subscribe")
+	if form.Get("TopicArn") != sqs.ArchiveTopicARN || form.Get("Endpoint") != "https://notifier.example.com/api/sns" {
+		t.Errorf("subscribed %v, want the archive topic to the endpoint", form)
+	}
+	if listener.Health().Report().Subscriptions[metrics.QueueArchive] {
+		t.Error("archive subscription still reported as confirmed")
+	}
+}
+
+func TestPOSTSNSNotification(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	eventChan := make(chan events.Event, 10)
+	r := newRouter(s.listener(t, eventChan, 1))
+
+	archive := message(snshttp.TypeNotification, sqs.ArchiveTopicARN)
+	archive.Message = `{"Records":[{"eventTime":"2024-04-18T03:42:11.537Z","s3":{"bucket":{"name":"unidata-nexrad-level2"},"object":{"key":"2024/04/18/KTLX/KTLX20240418_033635_V06","size":8316412}}}]}`
+	s.sign(t, archive)
+	if code := post(context.Background(), t, r, archive); code != http.StatusOK {
+		t.Fatalf("archive status = %d, want %d", code, http.StatusOK)
+	}
+	if event, ok := waitForEvent(t, eventChan).(events.NexradArchiveEvent); !ok || event.Station != "KTLX" {
+		t.Errorf("published %v, want a KTLX archive event", event)
+	}
+
+	chunk := chunkMessage()
+	s.sign(t, chunk)
+	if code := post(context.Background(), t, r, chunk); code != http.StatusOK {
+		t.Fatalf("chunk status = %d, want %d", code, http.StatusOK)
+	}
+	if event, ok := waitForEvent(t, eventChan).(events.NexradChunkEvent); !ok || event.Station != "KJAX" {
+		t.Errorf("published %v, want a KJAX chunk event", event)
+	}
+}
+
+func TestPOSTSNSNotificationWaitsForWorker(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	// Unbuffered, so the one worker is held until its event is taken.
+	eventChan := make(chan events.Event)
+	r := newRouter(s.listener(t, eventChan, 1))
+	msg := chunkMessage()
+	s.sign(t, msg)
+
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if code := post(ctx, t, r, msg); code != http.StatusInternalServerError {
+		t.Errorf("status with every worker busy = %d, want %d so SNS retries", code, http.StatusInternalServerError)
+	}
+
+	waitForEvent(t, eventChan)
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Errorf("status once the worker is free = %d, want %d", code, http.StatusOK)
+	}
+	waitForEvent(t, eventChan)
+}
+
+// blockingEnricher holds each chunk until its context ends.
+type blockingEnricher struct {
+	started chan struct{}
+}
+
+func (e blockingEnricher) Enrich(ctx context.Context, _ *events.NexradChunkEvent) error {
+	e.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStopWaitsForChunkWorkers(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	eventChan := make(chan events.Event, 10)
+	listener := s.listener(t, eventChan, 2)
+	enricher := blockingEnricher{started: make(chan struct{}, 1)}
+	listener.SetChunkEnricher(enricher, time.Minute)
+	r := newRouter(listener)
+	msg := chunkMessage()
+	s.sign(t, msg)
+
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	<-enricher.started
+
+	// Stop cancels the decode rather than waiting out its timeout, and is
+	// done with the worker by the time it returns.
+	stopped := make(chan error, 1)
+	go func() { stopped <- listener.Stop() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not cancel the chunk worker")
+	}
+	close(eventChan)
+	for event := range eventChan {
+		t.Errorf("published %v after Stop", event)
+	}
+
+	if code := post(context.Background(), t, r, msg); code != http.StatusInternalServerError {
+		t.Errorf("status after Stop = %d, want %d", code, http.StatusInternalServerError)
+	}
+}
+
+func TestFilterPolicyFollowsStationSet(t *testing.T) {
+	t.Parallel()
+	s := newSNSStandIn(t)
+	listener := s.listener(t, make(chan events.Event, 10), 1)
+	r := newRouter(listener)
+	msg := confirmation(snshttp.TypeSubscriptionConfirmation, sqs.ChunkTopicARN)
+	s.sign(t, msg)
+	if code := post(context.Background(), t, r, msg); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	waitForAction(t, s, "ConfirmSubscription")
+	waitForAction(t, s, "SetSubscriptionAttributes")
+
+	ctx := context.Background()
+	for range 2 {
+		if err := listener.ListenChunk(ctx, "ktlx"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if policy := waitForAction(t, s, "SetSubscriptionAttributes").Get("AttributeValue"); !strings.Contains(policy, `"KTLX"`) {
+		t.Errorf("policy = %s, want KTLX in it", policy)
+	}
+	if err := listener.ListenArchive(ctx, "KTLX"); err != nil {
+		t.Fatal(err)
+	}
+	if err := listener.UnlistenChunk(ctx, "KTLX"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.actions) != 0 {
+		t.Fatalf("SNS got %v without the station set changing", <-s.actions)
+	}
+
+	if err := listener.UnlistenChunk(ctx, "KTLX"); err != nil {
+		t.Fatal(err)
+	}
+	if policy := waitForAction(t, s, "SetSubscriptionAttributes").Get("AttributeValue"); strings.Contains(policy, "KTLX") {
+		t.Errorf("policy = %s, want KTLX gone", policy)
+	}
+	if listener.ListeningChunk("KTLX") || !listener.ListeningArchive("KTLX") {
+		t.Error("want KTLX's archives, but not its chunks, still received")
+	}
+}
@@ -3,21 +3,34 @@ package sqs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/health"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/snshttp"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snsTypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/google/uuid"
 	"github.com/puzpuzpuz/xsync/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -26,20 +39,73 @@ const (
 	nexradChunkTopicARN   = "arn:aws:sns:us-east-1:684042711724:NewNEXRADLevel2ObjectFilterable"
 )
 
+// A failing receive loop waits receiveBackoff before trying again, doubling
+// the wait each time it fails in a row up to maxReceiveBackoff.
+const (
+	receiveBackoff    = time.Second
+	maxReceiveBackoff = time.Minute
+)
+
+// startupTimeout bounds how long NewListener retries creating the queues
+// and subscriptions, with the same backoff, before giving up.
+const startupTimeout = 5 * time.Minute
+
+// maxChunkWorkers bounds how many chunk notifications are parsed and enriched
+// at once, however fast SQS or SNS delivers them.
+const maxChunkWorkers = 64
+
+//nolint:golint,gochecknoglobals
+var tracer = otel.Tracer("github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs")
+
 type Listener struct {
-	eventChan                    chan events.Event
-	archiveSites                 *xsync.MapOf[string, uint]
-	chunkSites                   *xsync.MapOf[string, uint]
-	awsSqs                       *sqs.Client
-	awsSns                       *sns.Client
-	awsSts                       *sts.Client
-	archiveQueueName             string
+	config    *config.Ingest
+	eventChan chan events.Event
+	// sitesMu serializes changes to the listener counts in archiveSites and
+	// chunkSites, which are read without it.
+	sitesMu          sync.Mutex
+	archiveSites     *xsync.MapOf[string, uint]
+	chunkSites       *xsync.MapOf[string, uint]
+	awsSqs           *sqs.Client
+	awsSns           *sns.Client
+	archiveQueueName string
+	chunkQueueName   string
+	// resourceMu guards the queue URLs and subscription ARNs once the
+	// listener has started, as they are replaced when a deleted queue or
+	// subscription is recreated.
+	resourceMu                   sync.RWMutex
 	archiveQueueURL              string
-	chunkQueueName               string
 	chunkQueueURL                string
 	nexradChunkSubscriptionARN   string
 	nexradArchiveSubscriptionARN string
 	running                      atomic.Bool
+	ctx                          context.Context
+	cancel                       context.CancelFunc
+	// In http ingest mode these hold the subscription ARNs once SNS has
+	// delivered, and we have accepted, each subscription's confirmation.
+	verifier            *snshttp.Verifier
+	confirmedChunkARN   atomic.Pointer[string]
+	confirmedArchiveARN atomic.Pointer[string]
+	enricher            ChunkEnricher
+	enrichTimeout       time.Duration
+	health              *health.Tracker
+	// backoff is the wait after the first failed receive.
+	backoff        time.Duration
+	startupTimeout time.Duration
+	// chunkWorkers holds a slot for each chunk notification being handled.
+	// Stop takes every slot, so none is handled once it returns.
+	chunkWorkers chan struct{}
+}
+
+// ChunkEnricher adds detail to chunk events before they are published.
+type ChunkEnricher interface {
+	Enrich(ctx context.Context, event *events.NexradChunkEvent) error
+}
+
+// SetChunkEnricher has every chunk event pass through enricher, for at most
+// timeout, before it is published. It must be called before Start.
+func (l *Listener) SetChunkEnricher(enricher ChunkEnricher, timeout time.Duration) {
+	l.enricher = enricher
+	l.enrichTimeout = timeout
 }
 
 func (l *Listener) ensureChunkQueue() error {
@@ -81,11 +147,10 @@ func (l *Listener) ensureArchiveQueue() error {
 }
 
 func (l *Listener) ensureArchiveSubscription() error {
-	callerID, err := l.awsSts.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	sqsARN, err := l.allowTopic(l.archiveQueueURL, nexradArchiveTopicARN)
 	if err != nil {
 		return err
 	}
-	sqsARN := fmt.Sprintf("arn:aws:sqs:us-east-1:%s:%s", *callerID.Account, l.archiveQueueName)
 
 	subs, err := l.awsSns.Subscribe(context.TODO(), &sns.SubscribeInput{
 		Protocol:              aws.String("sqs"),
@@ -97,8 +162,23 @@ func (l *Listener) ensureArchiveSubscription() error {
 		return err
 	}
 	l.nexradArchiveSubscriptionARN = *subs.SubscriptionArn
+	return nil
+}
+
+// allowTopic lets topicARN deliver to the queue at queueURL, returning the
+// queue's ARN to subscribe it with.
+func (l *Listener) allowTopic(queueURL, topicARN string) (string, error) {
+	attrs, err := l.awsSqs.GetQueueAttributes(context.TODO(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []sqsTypes.QueueAttributeName{sqsTypes.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", err
+	}
+	sqsARN := attrs.Attributes[string(sqsTypes.QueueAttributeNameQueueArn)]
+
 	_, err = l.awsSqs.SetQueueAttributes(context.TODO(), &sqs.SetQueueAttributesInput{
-		QueueUrl: aws.String(l.archiveQueueURL),
+		QueueUrl: aws.String(queueURL),
 		Attributes: map[string]string{
 			"Policy": fmt.Sprintf(`{
 				"Version": "2012-10-17",
@@ -117,12 +197,14 @@ func (l *Listener) ensureArchiveSubscription() error {
 						}
 					}
 				]
-			}`, sqsARN, nexradArchiveTopicARN),
+			}`, sqsARN, topicARN),
 		},
 	})
-	return err
+	if err != nil {
+		return "", err
+	}
+	return sqsARN, nil
 }
-
 func (l *Listener) updateFilterPolicy(ctx context.Context) error {
 	var sites []string
 	l.chunkSites.Range(func(key string, val uint) bool {
@@ -144,21 +226,41 @@ func (l *Listener) updateFilterPolicy(ctx context.Context) error {
 		"SiteID": %s
 	}`, jsonSites)
 
+	l.resourceMu.RLock()
+	subscriptionARN := l.nexradChunkSubscriptionARN
+	l.resourceMu.RUnlock()
+	if l.config.Mode == config.IngestModeHTTP {
+		// A pending subscription can't be modified. The policy is applied
+		// again as soon as SNS confirms it.
+		confirmed := l.confirmedChunkARN.Load()
+		if confirmed == nil {
+			return nil
+		}
+		subscriptionARN = *confirmed
+	}
+
+	start := time.Now()
 	_, err = l.awsSns.SetSubscriptionAttributes(ctx, &sns.SetSubscriptionAttributesInput{
-		SubscriptionArn: aws.String(l.nexradChunkSubscriptionARN),
+		SubscriptionArn: aws.String(subscriptionARN),
 		AttributeName:   aws.String("FilterPolicy"),
 		AttributeValue:  aws.String(filterPolicy),
 	})
+	metrics.FilterPolicyLatency.Observe(time.Since(start).Seconds())
+	result := metrics.ResultOK
+	if err != nil {
+		result = metrics.ResultError
+	}
+	metrics.FilterPolicyUpdates.WithLabelValues(result).Inc()
+	l.health.FilterPolicyApplied(err)
 
 	return err
 }
 
 func (l *Listener) ensureChunkSubscription() error {
-	callerID, err := l.awsSts.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	sqsARN, err := l.allowTopic(l.chunkQueueURL, nexradChunkTopicARN)
 	if err != nil {
 		return err
 	}
-	sqsARN := fmt.Sprintf("arn:aws:sqs:us-east-1:%s:%s", *callerID.Account, l.chunkQueueName)
 
 	subs, err := l.awsSns.Subscribe(context.TODO(), &sns.SubscribeInput{
 		Protocol:              aws.String("sqs"),
@@ -175,88 +277,78 @@ func (l *Listener) ensureChunkSubscription() error {
 		return err
 	}
 	l.nexradChunkSubscriptionARN = *subs.SubscriptionArn
-	_, err = l.awsSqs.SetQueueAttributes(context.TODO(), &sqs.SetQueueAttributesInput{
-		QueueUrl: aws.String(l.chunkQueueURL),
-		Attributes: map[string]string{
-			"Policy": fmt.Sprintf(`{
-				"Version": "2012-10-17",
-				"Statement": [
-					{
-						"Effect": "Allow",
-						"Principal": {
-							"AWS": "*"
-						},
-						"Action": "sqs:SendMessage",
-						"Resource": "%s",
-						"Condition": {
-							"ArnLike": {
-								"aws:SourceArn": "%s"
-							}
-						}
-					}
-				]
-			}`, sqsARN, nexradChunkTopicARN),
-		},
-	})
-	return err
+	return nil
 }
-
 func (l *Listener) destroyArchiveSubscription() error {
-	if l.nexradArchiveSubscriptionARN == "" {
+	l.resourceMu.RLock()
+	subscriptionARN := l.nexradArchiveSubscriptionARN
+	l.resourceMu.RUnlock()
+	if subscriptionARN == "" {
 		return nil
 	}
 	_, err := l.awsSns.Unsubscribe(context.TODO(), &sns.UnsubscribeInput{
-		SubscriptionArn: aws.String(l.nexradArchiveSubscriptionARN),
+		SubscriptionArn: aws.String(subscriptionARN),
 	})
 	return err
 }
 
 func (l *Listener) destroyChunkSubscription() error {
-	if l.nexradChunkSubscriptionARN == "" {
+	l.resourceMu.RLock()
+	subscriptionARN := l.nexradChunkSubscriptionARN
+	l.resourceMu.RUnlock()
+	if subscriptionARN == "" {
 		return nil
 	}
 	_, err := l.awsSns.Unsubscribe(context.TODO(), &sns.UnsubscribeInput{
-		SubscriptionArn: aws.String(l.nexradChunkSubscriptionARN),
+		SubscriptionArn: aws.String(subscriptionARN),
 	})
 	return err
 }
 
 func (l *Listener) destroyArchiveQueue() error {
-	if l.archiveQueueURL == "" {
+	l.resourceMu.RLock()
+	queueURL := l.archiveQueueURL
+	l.resourceMu.RUnlock()
+	if queueURL == "" {
 		return nil
 	}
 	_, err := l.awsSqs.DeleteQueue(context.TODO(), &sqs.DeleteQueueInput{
-		QueueUrl: aws.String(l.archiveQueueURL),
+		QueueUrl: aws.String(queueURL),
 	})
 	return err
 }
 
 func (l *Listener) destroyChunkQueue() error {
-	if l.chunkQueueURL == "" {
+	l.resourceMu.RLock()
+	queueURL := l.chunkQueueURL
+	l.resourceMu.RUnlock()
+	if queueURL == "" {
 		return nil
 	}
 	_, err := l.awsSqs.DeleteQueue(context.TODO(), &sqs.DeleteQueueInput{
-		QueueUrl: aws.String(l.chunkQueueURL),
+		QueueUrl: aws.String(queueURL),
 	})
 	return err
 }
 
-func NewListener(eventChan chan events.Event) (*Listener, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"), config.WithRetryMode(aws.RetryModeStandard), config.WithRetryMaxAttempts(10))
+// NewListener prepares the AWS resources for the configured ingest mode. No
+// notifications are received until Start is called.
+func NewListener(ingest *config.Ingest, eventChan chan events.Event) (*Listener, error) {
+	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(), awsConfig.WithRegion("us-east-1"), awsConfig.WithRetryMode(aws.RetryModeStandard), awsConfig.WithRetryMaxAttempts(10))
 	if err != nil {
 		return nil, err
 	}
+	// Missing credentials won't turn up by retrying, so they fail startup
+	// straight away.
+	if _, err := cfg.Credentials.Retrieve(context.TODO()); err != nil {
+		return nil, fmt.Errorf("loading AWS credentials: %w", err)
+	}
 	svc := sqs.NewFromConfig(cfg)
-	cfg, err = config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"), config.WithRetryMode(aws.RetryModeStandard), config.WithRetryMaxAttempts(10))
+	cfg, err = awsConfig.LoadDefaultConfig(context.TODO(), awsConfig.WithRegion("us-east-1"), awsConfig.WithRetryMode(aws.RetryModeStandard), awsConfig.WithRetryMaxAttempts(10))
 	if err != nil {
 		return nil, err
 	}
 	snsSvc := sns.NewFromConfig(cfg)
-	cfg, err = config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"), config.WithRetryMode(aws.RetryModeStandard), config.WithRetryMaxAttempts(10))
-	if err != nil {
-		return nil, err
-	}
-	stsSvc := sts.NewFromConfig(cfg)
 
 	archiveQueueUUID, err := uuid.NewV7()
 	if err != nil {
@@ -268,230 +360,710 @@ func NewListener(eventChan chan events.Event) (*Listener, error) {
 	}
 
 	listener := &Listener{
+		config:           ingest,
 		eventChan:        eventChan,
 		archiveSites:     xsync.NewMapOf[string, uint](),
 		chunkSites:       xsync.NewMapOf[string, uint](),
 		awsSqs:           svc,
 		awsSns:           snsSvc,
-		awsSts:           stsSvc,
 		archiveQueueName: fmt.Sprintf("nexrad-aws-notifier-events-archive-%s", archiveQueueUUID.String()),
 		chunkQueueName:   fmt.Sprintf("nexrad-aws-notifier-events-chunk-%s", chunkQueueUUID.String()),
 		running:          atomic.Bool{},
+		backoff:          receiveBackoff,
+		startupTimeout:   startupTimeout,
+		chunkWorkers:     make(chan struct{}, maxChunkWorkers),
+		health:           health.NewTracker(&ingest.Health, ingest.Mode, eventChan, metrics.QueueChunk, metrics.QueueArchive),
 	}
 	listener.running.Store(true)
+	listener.ctx, listener.cancel = context.WithCancel(context.Background())
+
+	if ingest.Mode == config.IngestModeHTTP {
+		// Subscriptions are made in Start, once the server can answer the
+		// confirmation requests SNS sends straight back.
+		listener.verifier = snshttp.NewVerifier(ingest.SNS.SigningCertHosts, nil)
+		return listener, nil
+	}
 
-	err = listener.ensureArchiveQueue()
+	err = listener.retry("archive queue", listener.ensureArchiveQueue)
 	if err != nil {
 		return nil, err
 	}
 
-	err = listener.ensureChunkQueue()
+	err = listener.retry("chunk queue", listener.ensureChunkQueue)
 	if err != nil {
 		_ = listener.destroyArchiveQueue()
 		return nil, err
 	}
 
-	err = listener.ensureArchiveSubscription()
+	err = listener.retry("archive subscription", listener.ensureArchiveSubscription)
 	if err != nil {
 		_ = listener.destroyArchiveQueue()
 		_ = listener.destroyChunkQueue()
 		return nil, err
 	}
 
-	err = listener.ensureChunkSubscription()
+	err = listener.retry("chunk subscription", listener.ensureChunkSubscription)
 	if err != nil {
 		_ = listener.destroyArchiveQueue()
 		_ = listener.destroyChunkQueue()
 		_ = listener.destroyArchiveSubscription()
 		return nil, err
 	}
-
-	go listener.runArchive()
-	go listener.runChunk()
+	listener.health.SetSubscribed(metrics.QueueArchive, true)
+	listener.health.SetSubscribed(metrics.QueueChunk, true)
 
 	return listener, nil
 }
 
-func (l *Listener) ListenChunk(ctx context.Context, station string) error {
-	station = strings.ToUpper(station)
-	num, loaded := l.chunkSites.LoadOrStore(station, 1)
-	if loaded {
-		l.chunkSites.Store(station, num+1)
+// retry calls ensure until it succeeds, backing off between attempts like the
+// receive loops, and gives up with its last error after startupTimeout.
+func (l *Listener) retry(resource string, ensure func() error) error {
+	deadline := time.Now().Add(l.startupTimeout)
+	backoff := l.backoff
+	for {
+		err := ensure()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("creating %s: %w", resource, err)
+		}
+		slog.Warn("Error creating AWS resource:", "resource", resource, "error", err, "retryIn", backoff)
+		if !l.wait(backoff) {
+			return fmt.Errorf("creating %s: %w", resource, err)
+		}
+		backoff = min(backoff*2, maxReceiveBackoff)
 	}
-	return l.updateFilterPolicy(ctx)
 }
 
-func (l *Listener) ListenArchive(ctx context.Context, station string) error {
-	station = strings.ToUpper(station)
-	num, loaded := l.archiveSites.LoadOrStore(station, 1)
-	if loaded {
-		l.archiveSites.Store(station, num+1)
+// Health tracks whether notifications are being received.
+func (l *Listener) Health() *health.Tracker {
+	return l.health
+}
+
+// Start begins receiving notifications. In sqs mode that is polling the
+// queues; in http mode it asks SNS to deliver to the configured endpoint.
+func (l *Listener) Start() error {
+	if l.config.Mode == config.IngestModeHTTP {
+		if err := l.subscribeEndpoint(); err != nil {
+			return err
+		}
+		go l.verify()
+		return nil
 	}
-	return l.updateFilterPolicy(ctx)
+	go l.runArchive()
+	go l.runChunk()
+	go l.verify()
+	return nil
 }
 
-func (l *Listener) UnlistenArchive(ctx context.Context, station string) error {
+// Subscribed reports whether any client is listening for station's chunk or
+// archive events.
+func (l *Listener) Subscribed(station string) bool {
 	station = strings.ToUpper(station)
-	num, loaded := l.archiveSites.LoadOrStore(station, 0)
-	if loaded {
-		l.archiveSites.Store(station, num-1)
-	}
-	if num-1 == 0 {
-		l.archiveSites.Delete(station)
+	chunk, _ := l.chunkSites.Load(station)
+	archive, _ := l.archiveSites.Load(station)
+	return chunk > 0 || archive > 0
+}
+
+// ListeningChunk reports whether station's chunk events are being received.
+func (l *Listener) ListeningChunk(station string) bool {
+	chunk, _ := l.chunkSites.Load(strings.ToUpper(station))
+	return chunk > 0
+}
+
+// ListeningArchive reports whether station's archive events are being
+// received.
+func (l *Listener) ListeningArchive(station string) bool {
+	archive, _ := l.archiveSites.Load(strings.ToUpper(station))
+	return archive > 0
+}
+
+// ListenChunk counts one more listener for station's chunks. The filter
+// policy only changes for its first.
+func (l *Listener) ListenChunk(ctx context.Context, station string) error {
+	if !l.addListener(l.chunkSites, station) {
+		return nil
 	}
 	return l.updateFilterPolicy(ctx)
 }
 
+// ListenArchive counts one more listener for station's archives. Archive
+// notifications aren't filtered, so SNS isn't told.
+func (l *Listener) ListenArchive(_ context.Context, station string) error {
+	l.addListener(l.archiveSites, station)
+	return nil
+}
+
+func (l *Listener) UnlistenArchive(_ context.Context, station string) error {
+	l.removeListener(l.archiveSites, station)
+	return nil
+}
+
+// UnlistenChunk counts one less listener for station's chunks. The filter
+// policy only changes for its last.
 func (l *Listener) UnlistenChunk(ctx context.Context, station string) error {
+	if !l.removeListener(l.chunkSites, station) {
+		return nil
+	}
+	return l.updateFilterPolicy(ctx)
+}
+
+// addListener counts one more listener for station in sites, and reports
+// whether it is the first.
+func (l *Listener) addListener(sites *xsync.MapOf[string, uint], station string) bool {
 	station = strings.ToUpper(station)
-	num, loaded := l.chunkSites.LoadOrStore(station, 0)
-	if loaded {
-		l.chunkSites.Store(station, num-1)
+	l.sitesMu.Lock()
+	defer l.sitesMu.Unlock()
+	num, _ := sites.Load(station)
+	sites.Store(station, num+1)
+	return num == 0
+}
+
+// removeListener counts one less listener for station in sites, and reports
+// whether it was the last.
+func (l *Listener) removeListener(sites *xsync.MapOf[string, uint], station string) bool {
+	station = strings.ToUpper(station)
+	l.sitesMu.Lock()
+	defer l.sitesMu.Unlock()
+	num, ok := sites.Load(station)
+	if !ok {
+		return false
 	}
-	if num-1 == 0 {
-		l.chunkSites.Delete(station)
+	if num > 1 {
+		sites.Store(station, num-1)
+		return false
 	}
-	return l.updateFilterPolicy(ctx)
+	sites.Delete(station)
+	return true
 }
 
 func (l *Listener) runArchive() {
+	backoff := l.backoff
 	// Loop and poll the SQS queue
 	for l.running.Load() {
-		resp, err := l.awsSqs.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-			QueueUrl:            aws.String(l.archiveQueueURL),
+		l.resourceMu.RLock()
+		queueURL := l.archiveQueueURL
+		l.resourceMu.RUnlock()
+
+		ctx, span := tracer.Start(l.ctx, "sqs.ReceiveMessage",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", l.archiveQueueName)))
+		resp, err := l.awsSqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
 			MaxNumberOfMessages: 10,
 			WaitTimeSeconds:     2,
 		})
 		// Break early since it's likely the listener will stop
 		// while waiting for messages
 		if !l.running.Load() {
+			span.End()
 			break
 		}
 		if err != nil {
-			slog.Warn("Error receiving message:", "error", err)
+			metrics.SQSReceives.WithLabelValues(metrics.QueueArchive, metrics.ResultError).Inc()
+			l.health.ReceiveFailed(metrics.QueueArchive, err)
+			slog.Warn("Error receiving message:", "queue", metrics.QueueArchive, "error", err, "retryIn", backoff)
+			spanError(span, err)
+			span.End()
+			if queueMissing(err) {
+				l.repairArchiveQueue()
+			}
+			if !l.wait(backoff) {
+				break
+			}
+			backoff = min(backoff*2, maxReceiveBackoff)
 			continue
 		}
+		backoff = l.backoff
+		metrics.SQSReceives.WithLabelValues(metrics.QueueArchive, metrics.ResultOK).Inc()
+		l.health.ReceiveSucceeded(metrics.QueueArchive)
+		span.SetAttributes(attribute.Int("messaging.batch.message_count", len(resp.Messages)))
 		for _, msg := range resp.Messages {
 			// Delete the message
 			_, err := l.awsSqs.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
-				QueueUrl:      aws.String(l.archiveQueueURL),
+				QueueUrl:      aws.String(queueURL),
 				ReceiptHandle: msg.ReceiptHandle,
 			})
 			if err != nil {
+				metrics.SQSDeleteFailures.WithLabelValues(metrics.QueueArchive).Inc()
 				slog.Warn("Error deleting message:", "error", err)
 			}
-			go l.onArchiveMessage(msg)
+			go l.onArchiveMessage(ctx, *msg.Body)
 		}
+		span.End()
 	}
 }
 
 func (l *Listener) runChunk() {
+	backoff := l.backoff
 	// Loop and poll the SQS queue
 	for l.running.Load() {
-		resp, err := l.awsSqs.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-			QueueUrl:            aws.String(l.chunkQueueURL),
+		l.resourceMu.RLock()
+		queueURL := l.chunkQueueURL
+		l.resourceMu.RUnlock()
+
+		ctx, span := tracer.Start(l.ctx, "sqs.ReceiveMessage",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", l.chunkQueueName)))
+		resp, err := l.awsSqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
 			MaxNumberOfMessages: 10,
 			WaitTimeSeconds:     2,
 		})
 		// Break early since it's likely the listener will stop
 		// while waiting for messages
 		if !l.running.Load() {
+			span.End()
 			break
 		}
 		if err != nil {
-			slog.Warn("Error receiving message:", "error", err)
+			metrics.SQSReceives.WithLabelValues(metrics.QueueChunk, metrics.ResultError).Inc()
+			l.health.ReceiveFailed(metrics.QueueChunk, err)
+			slog.Warn("Error receiving message:", "queue", metrics.QueueChunk, "error", err, "retryIn", backoff)
+			spanError(span, err)
+			span.End()
+			if queueMissing(err) {
+				l.repairChunkQueue()
+			}
+			if !l.wait(backoff) {
+				break
+			}
+			backoff = min(backoff*2, maxReceiveBackoff)
 			continue
 		}
+		backoff = l.backoff
+		metrics.SQSReceives.WithLabelValues(metrics.QueueChunk, metrics.ResultOK).Inc()
+		l.health.ReceiveSucceeded(metrics.QueueChunk)
+		span.SetAttributes(attribute.Int("messaging.batch.message_count", len(resp.Messages)))
 		for _, msg := range resp.Messages {
 			// Delete the message
 			_, err := l.awsSqs.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
-				QueueUrl:      aws.String(l.chunkQueueURL),
+				QueueUrl:      aws.String(queueURL),
 				ReceiptHandle: msg.ReceiptHandle,
 			})
 			if err != nil {
+				metrics.SQSDeleteFailures.WithLabelValues(metrics.QueueChunk).Inc()
 				slog.Warn("Error deleting message:", "error", err)
 			}
-			go l.onChunkMessage(msg)
+			if err := l.goChunk(ctx, *msg.Body); err != nil {
+				// Only once the listener is stopping.
+				break
+			}
+		}
+		span.End()
+	}
+}
+
+// repairArchiveQueue recreates the archive queue after it was deleted. The
+// subscription outlives the queue, and delivers to the new one once it is
+// allowed to.
+func (l *Listener) repairArchiveQueue() {
+	l.resourceMu.Lock()
+	err := l.ensureArchiveQueue()
+	if err == nil {
+		_, err = l.allowTopic(l.archiveQueueURL, nexradArchiveTopicARN)
+	}
+	l.resourceMu.Unlock()
+	if err != nil {
+		slog.Warn("Failed to recreate archive queue", "error", err)
+		return
+	}
+	slog.Info("Recreated archive queue")
+}
+
+func (l *Listener) repairChunkQueue() {
+	l.resourceMu.Lock()
+	err := l.ensureChunkQueue()
+	if err == nil {
+		_, err = l.allowTopic(l.chunkQueueURL, nexradChunkTopicARN)
+	}
+	l.resourceMu.Unlock()
+	if err != nil {
+		slog.Warn("Failed to recreate chunk queue", "error", err)
+		return
+	}
+	slog.Info("Recreated chunk queue")
+}
+
+// verify checks the subscriptions every config.Health.VerifyInterval, as
+// nothing else notices SNS dropping one.
+func (l *Listener) verify() {
+	ticker := time.NewTicker(time.Duration(l.config.Health.VerifyInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, feed := range []string{metrics.QueueChunk, metrics.QueueArchive} {
+			l.verifySubscription(feed)
+		}
+	}
+}
+
+func (l *Listener) verifySubscription(feed string) {
+	subscriptionARN := l.subscriptionARN(feed)
+	if subscriptionARN == "" {
+		// Still waiting for SNS to confirm it.
+		return
+	}
+	_, err := l.awsSns.GetSubscriptionAttributes(l.ctx, &sns.GetSubscriptionAttributesInput{
+		SubscriptionArn: aws.String(subscriptionARN),
+	})
+	if err == nil {
+		l.health.SetSubscribed(feed, true)
+		return
+	}
+	if !subscriptionMissing(err) {
+		slog.Warn("Failed to verify subscription", "feed", feed, "error", err)
+		return
+	}
+	slog.Warn("Subscription has gone, recreating it", "feed", feed)
+	l.health.SetSubscribed(feed, false)
+	if err := l.resubscribe(feed); err != nil {
+		slog.Warn("Failed to recreate subscription", "feed", feed, "error", err)
+	}
+}
+
+// subscriptionARN returns feed's subscription, or in http ingest mode, its
+// confirmed subscription.
+func (l *Listener) subscriptionARN(feed string) string {
+	if l.config.Mode == config.IngestModeHTTP {
+		confirmed := l.confirmedArchiveARN.Load()
+		if feed == metrics.QueueChunk {
+			confirmed = l.confirmedChunkARN.Load()
+		}
+		if confirmed == nil {
+			return ""
+		}
+		return *confirmed
+	}
+	l.resourceMu.RLock()
+	defer l.resourceMu.RUnlock()
+	if feed == metrics.QueueChunk {
+		return l.nexradChunkSubscriptionARN
+	}
+	return l.nexradArchiveSubscriptionARN
+}
+
+// resubscribe recreates feed's subscription. The queue is recreated too if it
+// has also gone, and the chunk filter policy is applied again.
+func (l *Listener) resubscribe(feed string) error {
+	if l.config.Mode == config.IngestModeHTTP {
+		// The new subscription is pending until SNS confirms it.
+		if feed == metrics.QueueChunk {
+			l.confirmedChunkARN.Store(nil)
+			return l.subscribeEndpointTopic(nexradChunkTopicARN)
 		}
+		l.confirmedArchiveARN.Store(nil)
+		return l.subscribeEndpointTopic(nexradArchiveTopicARN)
 	}
+
+	l.resourceMu.Lock()
+	var err error
+	if feed == metrics.QueueChunk {
+		err = l.ensureChunkQueue()
+		if err == nil {
+			err = l.ensureChunkSubscription()
+		}
+	} else {
+		err = l.ensureArchiveQueue()
+		if err == nil {
+			err = l.ensureArchiveSubscription()
+		}
+	}
+	l.resourceMu.Unlock()
+	if err != nil {
+		return err
+	}
+	l.health.SetSubscribed(feed, true)
+	slog.Info("Recreated subscription", "feed", feed)
+
+	if feed == metrics.QueueChunk {
+		return l.updateFilterPolicy(l.ctx)
+	}
+	return nil
+}
+
+// wait sleeps for d, returning false early if the listener stops.
+func (l *Listener) wait(d time.Duration) bool {
+	select {
+	case <-l.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func queueMissing(err error) bool {
+	var missing *sqsTypes.QueueDoesNotExist
+	return errors.As(err, &missing)
 }
 
-func (l *Listener) onArchiveMessage(msg types.Message) {
+func subscriptionMissing(err error) bool {
+	var missing *snsTypes.NotFoundException
+	return errors.As(err, &missing)
+}
+
+// onArchiveMessage turns a notification into events. ctx carries the span
+// of the receive or request that delivered it.
+func (l *Listener) onArchiveMessage(ctx context.Context, body string) {
+	ctx, span := tracer.Start(ctx, "sqs.parse", trace.WithAttributes(attribute.String("queue", metrics.QueueArchive)))
+	defer span.End()
+
+	metrics.SQSMessages.WithLabelValues(metrics.QueueArchive).Inc()
 	var notification ArchiveNotification
-	err := json.Unmarshal([]byte(*msg.Body), &notification)
+	err := json.Unmarshal([]byte(body), &notification)
 	if err != nil {
+		metrics.SQSParseFailures.WithLabelValues(metrics.QueueArchive).Inc()
 		slog.Warn("Error unmarshalling message:", "error", err)
+		spanError(span, err)
 		return
 	}
 	var message ArchiveNotificationMessage
 	err = json.Unmarshal([]byte(notification.Message), &message)
 	if err != nil {
+		metrics.SQSParseFailures.WithLabelValues(metrics.QueueArchive).Inc()
 		slog.Warn("Error unmarshalling message:", "error", err)
+		spanError(span, err)
 		return
 	}
+	published := notificationTime(notification.Timestamp)
 
 	for _, record := range message.Records {
-		// Key is yyyy/mm/dd/STATION/STATION_yyyymmdd_hhmmss_V06
-		parts := strings.Split(record.S3.Object.Key, "/")
-		if len(parts) < 4 {
-			slog.Warn("Invalid key:", "key", record.S3.Object.Key)
+		event, err := archiveEvent(record)
+		if err != nil {
+			metrics.SQSParseFailures.WithLabelValues(metrics.QueueArchive).Inc()
+			slog.Warn("Invalid archive record:", "error", err)
+			span.RecordError(err)
 			continue
 		}
-		station := parts[3]
-		slog.Info("Received archive record", "station", station, "prefix", record.S3.Object.Key)
+		event.Meta.Published = published
+		slog.Info("Received archive record", "station", event.Station, "prefix", event.Path)
 
 		if l.running.Load() {
-			l.eventChan <- events.NexradArchiveEvent{
-				Station: station,
-				Path:    record.S3.Object.Key,
-			}
+			_, publish := startPublish(ctx, event)
+			event.Meta.Span = publish.SpanContext()
+			l.eventChan <- event
+			publish.End()
 		}
 	}
 }
 
-func (l *Listener) onChunkMessage(msg types.Message) {
+// archiveEvent fills in what it can of an archive record's metadata. Only
+// a key too short to name a station is rejected; anything else the key or
+// record doesn't give is left unset, so an unexpected object is still
+// announced.
+func archiveEvent(record ArchiveNotificationRecord) (events.NexradArchiveEvent, error) {
+	// Key is yyyy/mm/dd/STATION/STATION_yyyymmdd_hhmmss_V06
+	parts := strings.Split(record.S3.Object.Key, "/")
+	if len(parts) < 4 {
+		return events.NexradArchiveEvent{}, fmt.Errorf("%w: %q", nexrad.ErrInvalidKey, record.S3.Object.Key)
+	}
+	event := events.NexradArchiveEvent{
+		Station: parts[3],
+		Path:    record.S3.Object.Key,
+		Bucket:  record.S3.Bucket.Name,
+		Size:    record.S3.Object.Size,
+		ETag:    record.S3.Object.ETag,
+		URL:     nexrad.ObjectURL(record.S3.Bucket.Name, record.S3.Object.Key),
+	}
+	if key, err := nexrad.ParseArchiveKey(record.S3.Object.Key); err == nil {
+		event.Station = key.Station
+		event.ScanTime = key.ScanTime
+		event.Version = key.Version
+		event.Kind = key.Kind
+	} else {
+		slog.Debug("Archive key not understood, sending what is known", "error", err)
+	}
+	if eventTime, err := time.Parse(time.RFC3339Nano, record.EventTimee); err == nil {
+		event.EventTime = eventTime
+	} else {
+		slog.Debug("Invalid archive eventTime, leaving it out", "eventTime", record.EventTimee, "error", err)
+	}
+	return event, nil
+}
+
+// goChunk hands body to onChunkMessage on one of the chunk workers, waiting
+// for a free one for as long as ctx allows. The worker keeps ctx's span but
+// runs until the listener stops rather than until ctx ends.
+func (l *Listener) goChunk(ctx context.Context, body string) error {
+	select {
+	case l.chunkWorkers <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+	workerCtx := trace.ContextWithSpan(l.ctx, trace.SpanFromContext(ctx))
+	go func() {
+		defer func() { <-l.chunkWorkers }()
+		l.onChunkMessage(workerCtx, body)
+	}()
+	return nil
+}
+
+// onChunkMessage turns a notification into an event. ctx carries the span of
+// the receive or request that delivered it.
+func (l *Listener) onChunkMessage(ctx context.Context, body string) {
+	ctx, span := tracer.Start(ctx, "sqs.parse", trace.WithAttributes(attribute.String("queue", metrics.QueueChunk)))
+	defer span.End()
+
+	metrics.SQSMessages.WithLabelValues(metrics.QueueChunk).Inc()
 	var notification ChunkNotification
-	err := json.Unmarshal([]byte(*msg.Body), &notification)
+	err := json.Unmarshal([]byte(body), &notification)
 	if err != nil {
+		metrics.SQSParseFailures.WithLabelValues(metrics.QueueChunk).Inc()
 		slog.Warn("Error unmarshalling message:", "error", err)
+		spanError(span, err)
 		return
 	}
-	site := notification.MessageAttributes["SiteID"].Value
-	volume := notification.MessageAttributes["VolumeID"].Value
-	chunk := notification.MessageAttributes["ChunkID"].Value
-	l2Version := notification.MessageAttributes["L2Version"].Value
-	chunkType := notification.MessageAttributes["ChunkType"].Value
 
-	// The message attributes don't carry the volume start time, so the object
-	// key can't be rebuilt from them. The message body has it verbatim.
-	var message ChunkNotificationMessage
-	if err := json.Unmarshal([]byte(notification.Message), &message); err != nil {
-		slog.Warn("Error unmarshalling chunk message:", "error", err)
+	event, err := chunkEvent(notification)
+	if err != nil {
+		metrics.SQSParseFailures.WithLabelValues(metrics.QueueChunk).Inc()
+		slog.Warn("Invalid chunk notification:", "error", err)
+		spanError(span, err)
+		return
 	}
+	event.Meta.Published = notificationTime(notification.Timestamp)
 
-	// Key is SITE/VOLUME/yyyymmdd-hhmmss-NNN-T
-	name := message.Key
-	if idx := strings.LastIndex(name, "/"); idx != -1 {
-		name = name[idx+1:]
+	if id := canaryID(notification); id != "" {
+		l.onCanary(ctx, id, event.Meta.Published)
+		return
+	}
+
+	if l.enricher != nil {
+		ctx, cancel := context.WithTimeout(ctx, l.enrichTimeout)
+		if err := l.enricher.Enrich(ctx, &event); err != nil {
+			// Better a plain event than none at all.
+			slog.Warn("Failed to decode chunk", "path", event.Path, "error", err)
+		}
+		cancel()
 	}
 
-	slog.Info("Received chunk record", "site", site, "volume", volume, "chunk", chunk, "chunkType", chunkType, "l2Version", l2Version, "path", message.Key)
+	slog.Info("Received chunk record", "site", event.Station, "volume", event.Volume, "chunk", event.Chunk, "chunkType", event.ChunkType, "l2Version", event.L2Version, "path", event.Path, "vcp", event.VCP)
 
 	if l.running.Load() {
-		l.eventChan <- events.NexradChunkEvent{
-			Station:   site,
-			Volume:    volume,
-			Chunk:     chunk,
-			ChunkType: chunkType,
-			L2Version: l2Version,
-			Name:      name,
-			Path:      message.Key,
+		_, publish := startPublish(ctx, event)
+		event.Meta.Span = publish.SpanContext()
+		l.eventChan <- event
+		publish.End()
+	}
+}
+
+// startPublish starts the span covering an event's handoff to the event bus.
+// The event carries it from there to the websocket hub.
+func startPublish(ctx context.Context, event events.Event) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "events.publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("event.type", string(event.GetType())),
+		attribute.String("station", event.GetStation()),
+	))
+}
+
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// chunkEvent builds an event from a chunk notification. The message attributes
+// are what the filter policy matched on, so they must agree with the body and
+// the object key it names.
+func chunkEvent(notification ChunkNotification) (events.NexradChunkEvent, error) {
+	attribute := func(name string) (string, error) {
+		attr, ok := notification.MessageAttributes[name]
+		if !ok || attr.Value == "" {
+			return "", &MissingAttributeError{Attribute: name}
 		}
+		return attr.Value, nil
 	}
+
+	var message ChunkNotificationMessage
+	if err := json.Unmarshal([]byte(notification.Message), &message); err != nil {
+		return events.NexradChunkEvent{}, fmt.Errorf("failed to unmarshal chunk message: %w", err)
+	}
+	// The message attributes don't carry the volume start time, so the object
+	// key can't be rebuilt from them. The message body has it verbatim.
+	key, err := nexrad.ParseChunkKey(message.Key)
+	if err != nil {
+		return events.NexradChunkEvent{}, err
+	}
+
+	fields := []struct {
+		name string
+		body []string
+	}{
+		{"SiteID", []string{message.SiteID, key.Station}},
+		{"VolumeID", []string{message.VolumeID, strconv.Itoa(key.Volume)}},
+		{"ChunkID", []string{message.ChunkID, strconv.Itoa(key.Sequence)}},
+		{"ChunkType", []string{message.ChunkType, key.Type}},
+		{"L2Version", []string{message.L2Version}},
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		value, err := attribute(field.name)
+		if err != nil {
+			return events.NexradChunkEvent{}, err
+		}
+		for _, body := range field.body {
+			if body != "" && !attributeEqual(value, body) {
+				return events.NexradChunkEvent{}, &AttributeMismatchError{Attribute: field.name, Attr: value, Body: body}
+			}
+		}
+		values[field.name] = value
+	}
+
+	bucket := message.S3Bucket
+	if bucket == "" {
+		bucket = nexrad.ChunkBucket
+	}
+
+	// Key is SITE/VOLUME/yyyymmdd-hhmmss-NNN-T
+	name := message.Key[strings.LastIndex(message.Key, "/")+1:]
+
+	return events.NexradChunkEvent{
+		Station:      values["SiteID"],
+		Volume:       values["VolumeID"],
+		Chunk:        values["ChunkID"],
+		ChunkType:    values["ChunkType"],
+		L2Version:    values["L2Version"],
+		Name:         name,
+		Path:         message.Key,
+		VolumeStart:  key.VolumeStart,
+		Sequence:     key.Sequence,
+		VolumeNumber: key.Volume,
+		Bucket:       bucket,
+		URL:          nexrad.ObjectURL(bucket, message.Key),
+	}, nil
+}
+
+// notificationTime parses the time SNS published a notification. It is only
+// used to measure latency, so an unparsable one is left zero.
+func notificationTime(timestamp string) time.Time {
+	published, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return published
+}
+
+// attributeEqual compares an attribute to its body counterpart. Numbers are
+// zero padded in the object key but not in the attributes.
+func attributeEqual(attr, body string) bool {
+	if attr == body {
+		return true
+	}
+	a, errA := strconv.Atoi(attr)
+	b, errB := strconv.Atoi(body)
+	return errA == nil && errB == nil && a == b
 }
 
 func (l *Listener) Stop() error {
 	l.running.Store(false)
+	l.cancel()
+	l.health.Stop()
 	errGrp := errgroup.Group{}
 	errGrp.SetLimit(2)
 	errGrp.Go(func() error {
@@ -506,5 +1078,11 @@ func (l *Listener) Stop() error {
 	errGrp.Go(func() error {
 		return l.destroyArchiveQueue()
 	})
-	return errGrp.Wait()
+	err := errGrp.Wait()
+	// Wait out the workers still handling a chunk, so none publishes after
+	// the event channel closes.
+	for range cap(l.chunkWorkers) {
+		l.chunkWorkers <- struct{}{}
+	}
+	return err
 }
@@ -0,0 +1,384 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/health"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/metrics"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/nexrad"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	snsTypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const archiveMessage = `{
+  "Records": [{
+    "eventVersion": "2.1",
+    "eventSource": "aws:s3",
+    "awsRegion": "us-east-1",
+    "eventTime": "2024-04-18T03:42:11.537Z",
+    "eventName": "ObjectCreated:Put",
+    "s3": {
+      "s3SchemaVersion": "1.0",
+      "bucket": {"name": "unidata-nexrad-level2", "arn": "arn:aws:s3:::unidata-nexrad-level2"},
+      "object": {
+        "key": "2024/04/18/KTLX/KTLX20240418_033635_V06",
+        "size": 8316412,
+        "eTag": "4b7dd7d6a9c3c0e4b6b1e9e8ef0d0c1a",
+        "sequencer": "006620967FA0E1E1C3"
+      }
+    }
+  }]
+}`
+
+func TestArchiveEvent(t *testing.T) {
+	t.Parallel()
+	var message ArchiveNotificationMessage
+	if err := json.Unmarshal([]byte(archiveMessage), &message); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := archiveEvent(message.Records[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := events.NexradArchiveEvent{
+		Station:   "KTLX",
+		Path:      "2024/04/18/KTLX/KTLX20240418_033635_V06",
+		ScanTime:  time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		Version:   "V06",
+		Kind:      nexrad.ArchiveKindVolume,
+		Bucket:    "unidata-nexrad-level2",
+		Size:      8316412,
+		ETag:      "4b7dd7d6a9c3c0e4b6b1e9e8ef0d0c1a",
+		EventTime: time.Date(2024, 4, 18, 3, 42, 11, 537000000, time.UTC),
+		URL:       "https://unidata-nexrad-level2.s3.amazonaws.com/2024/04/18/KTLX/KTLX20240418_033635_V06",
+	}
+	if !got.EventTime.Equal(want.EventTime) {
+		t.Errorf("EventTime = %v, want %v", got.EventTime, want.EventTime)
+	}
+	got.EventTime = want.EventTime
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archiveEvent() = %+v, want %+v", got, want)
+	}
+}
+
+func TestArchiveEventRejectsShortKey(t *testing.T) {
+	t.Parallel()
+	var record ArchiveNotificationRecord
+	record.EventTimee = "2024-04-18T03:42:11.537Z"
+	record.S3.Object.Key = "2024/04/18"
+	if _, err := archiveEvent(record); err == nil {
+		t.Error("expected an error for a key without a station")
+	}
+}
+
+func TestArchiveEventKeepsUnexpectedKey(t *testing.T) {
+	t.Parallel()
+	var record ArchiveNotificationRecord
+	record.EventTimee = "not a time"
+	record.S3.Bucket.Name = "unidata-nexrad-level2"
+	record.S3.Object.Key = "2024/04/18/KTLX/renamed.tar"
+	got, err := archiveEvent(record)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := events.NexradArchiveEvent{
+		Station: "KTLX",
+		Path:    "2024/04/18/KTLX/renamed.tar",
+		Bucket:  "unidata-nexrad-level2",
+		URL:     "https://unidata-nexrad-level2.s3.amazonaws.com/2024/04/18/KTLX/renamed.tar",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archiveEvent() = %+v, want %+v", got, want)
+	}
+}
+
+func chunkNotification(t *testing.T, attributes map[string]string, body string) ChunkNotification {
+	t.Helper()
+	var notification ChunkNotification
+	notification.Message = body
+	notification.MessageAttributes = make(map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	})
+	for name, value := range attributes {
+		attr := notification.MessageAttributes[name]
+		attr.Type = "String"
+		attr.Value = value
+		notification.MessageAttributes[name] = attr
+	}
+	return notification
+}
+
+func chunkAttributes() map[string]string {
+	return map[string]string{
+		"SiteID":    "KJAX",
+		"VolumeID":  "415",
+		"ChunkID":   "25",
+		"ChunkType": "I",
+		"L2Version": "V06",
+	}
+}
+
+const chunkBody = `{"S3Bucket":"unidata-nexrad-level2-chunks","Key":"KJAX/415/20240418-033635-025-I","SiteID":"KJAX","DateTime":"2024-04-18T03:36:35","VolumeID":"415","ChunkID":"25","ChunkType":"I","L2Version":"V06"}`
+
+func TestChunkEvent(t *testing.T) {
+	t.Parallel()
+	got, err := chunkEvent(chunkNotification(t, chunkAttributes(), chunkBody))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := events.NexradChunkEvent{
+		Station:      "KJAX",
+		Volume:       "415",
+		Chunk:        "25",
+		ChunkType:    "I",
+		L2Version:    "V06",
+		Name:         "20240418-033635-025-I",
+		Path:         "KJAX/415/20240418-033635-025-I",
+		VolumeStart:  time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		Sequence:     25,
+		VolumeNumber: 415,
+		Bucket:       "unidata-nexrad-level2-chunks",
+		URL:          "https://unidata-nexrad-level2-chunks.s3.amazonaws.com/KJAX/415/20240418-033635-025-I",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunkEvent() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChunkEventMissingAttribute(t *testing.T) {
+	t.Parallel()
+	attributes := chunkAttributes()
+	delete(attributes, "L2Version")
+
+	_, err := chunkEvent(chunkNotification(t, attributes, chunkBody))
+	var missing *MissingAttributeError
+	if !errors.As(err, &missing) {
+		t.Fatalf("error = %v, want MissingAttributeError", err)
+	}
+	if missing.Attribute != "L2Version" {
+		t.Errorf("Attribute = %q, want L2Version", missing.Attribute)
+	}
+}
+
+func TestChunkEventMismatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		attribute string
+		value     string
+	}{
+		{"site", "SiteID", "KTLX"},
+		{"volume", "VolumeID", "416"},
+		{"chunk", "ChunkID", "26"},
+		{"type", "ChunkType", "E"},
+		{"version", "L2Version", "V08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			attributes := chunkAttributes()
+			attributes[tt.attribute] = tt.value
+
+			_, err := chunkEvent(chunkNotification(t, attributes, chunkBody))
+			var mismatch *AttributeMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("error = %v, want AttributeMismatchError", err)
+			}
+			if mismatch.Attribute != tt.attribute {
+				t.Errorf("Attribute = %q, want %q", mismatch.Attribute, tt.attribute)
+			}
+		})
+	}
+}
+
+func TestNotificationTime(t *testing.T) {
+	t.Parallel()
+	want := time.Date(2024, 4, 18, 3, 36, 35, 120000000, time.UTC)
+	if got := notificationTime("2024-04-18T03:36:35.120Z"); !got.Equal(want) {
+		t.Errorf("notificationTime = %v, want %v", got, want)
+	}
+	if got := notificationTime("yesterday"); !got.IsZero() {
+		t.Errorf("notificationTime = %v, want zero for an unparsable timestamp", got)
+	}
+}
+
+// sqsStandIn answers the SQS JSON API. Receives fail with QueueDoesNotExist
+// until the queue has been looked up again.
+type sqsStandIn struct {
+	mu        sync.Mutex
+	calls     map[string]int
+	recreated bool
+}
+
+func (s *sqsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[op]++
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	switch op {
+	case "ReceiveMessage":
+		if !s.recreated {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"The specified queue does not exist."}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"Messages":[]}`)
+	case "GetQueueUrl":
+		s.recreated = true
+		_, _ = io.WriteString(w, `{"QueueUrl":"https://sqs.us-east-1.amazonaws.com/123456789012/chunk"}`)
+	case "GetQueueAttributes":
+		_, _ = io.WriteString(w, `{"Attributes":{"QueueArn":"arn:aws:sqs:us-east-1:123456789012:chunk"}}`)
+	default:
+		_, _ = io.WriteString(w, `{}`)
+	}
+}
+
+func (s *sqsStandIn) count(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+func TestRecreatesDeletedQueue(t *testing.T) {
+	t.Parallel()
+	stand := &sqsStandIn{calls: make(map[string]int)}
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+
+	ingest := &config.Ingest{Mode: config.IngestModeSQS, Health: config.Health{
+		StaleAfter:     config.Duration(time.Minute),
+		ErrorThreshold: 5,
+		RestartAfter:   config.Duration(time.Hour),
+	}}
+	l := &Listener{
+		config: ingest,
+		awsSqs: sqs.New(sqs.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(server.URL),
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+		chunkQueueName: "chunk",
+		chunkQueueURL:  "https://sqs.us-east-1.amazonaws.com/123456789012/chunk",
+		health:         health.NewTracker(&ingest.Health, ingest.Mode, nil, metrics.QueueChunk),
+		backoff:        time.Millisecond,
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.running.Store(true)
+	l.health.SetSubscribed(metrics.QueueChunk, true)
+
+	done := make(chan struct{})
+	go func() {
+		l.runChunk()
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for stand.count("ReceiveMessage") < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	l.running.Store(false)
+	l.cancel()
+	<-done
+
+	if stand.count("GetQueueUrl") != 1 || stand.count("SetQueueAttributes") != 1 {
+		t.Errorf("calls = %v, want the queue looked up and its policy set once", stand.calls)
+	}
+	report := l.health.Report()
+	if queue := report.Queues[metrics.QueueChunk]; queue.LastReceive == nil || queue.ConsecutiveErrors != 0 {
+		t.Errorf("chunk queue = %+v, want receiving again", queue)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	errThrottled := errors.New("throttled")
+	l := &Listener{backoff: time.Millisecond, startupTimeout: time.Second}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	t.Cleanup(l.cancel)
+
+	attempts := 0
+	err := l.retry("chunk queue", func() error {
+		attempts++
+		if attempts < 3 {
+			return errThrottled
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("retry = %v after %d attempts, want success on the third", err, attempts)
+	}
+
+	l.startupTimeout = 20 * time.Millisecond
+	err = l.retry("chunk queue", func() error { return errThrottled })
+	if !errors.Is(err, errThrottled) {
+		t.Errorf("retry = %v, want %v once the deadline passes", err, errThrottled)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	t.Parallel()
+	if !queueMissing(fmt.Errorf("receive: %w", &sqsTypes.QueueDoesNotExist{})) {
+		t.Error("QueueDoesNotExist not recognised")
+	}
+	if queueMissing(errors.New("connection reset")) {
+		t.Error("other errors taken for a missing queue")
+	}
+	if !subscriptionMissing(fmt.Errorf("verify: %w", &snsTypes.NotFoundException{})) {
+		t.Error("NotFoundException not recognised")
+	}
+}
+
+// A canary must come out of the chunk path as a canary, never as a chunk
+// the rest of the service would act on.
+func TestCanaryDiverted(t *testing.T) {
+	t.Parallel()
+	body, err := canaryNotification("0192f1c4-7b1a-7c3e-9a51-3f6b2d1e8a90", time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listener{eventChan: make(chan events.Event, 1)}
+	l.running.Store(true)
+
+	l.onChunkMessage(context.Background(), body)
+	select {
+	case event := <-l.eventChan:
+		canary, ok := event.(events.CanaryEvent)
+		if !ok || canary.ID != "0192f1c4-7b1a-7c3e-9a51-3f6b2d1e8a90" {
+			t.Errorf("published %+v, want the canary", event)
+		}
+		if !canary.Meta.Published.Equal(time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC)) {
+			t.Errorf("Published = %v, want the send time", canary.Meta.Published)
+		}
+	default:
+		t.Fatal("nothing published")
+	}
+
+	var notification ChunkNotification
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunkEvent(notification); err != nil {
+		t.Errorf("canary fails chunk parsing: %v", err)
+	}
+	if canaryID(chunkNotification(t, chunkAttributes(), chunkBody)) != "" {
+		t.Error("real chunk notification taken for a canary")
+	}
+}
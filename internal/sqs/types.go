@@ -1,5 +1,7 @@
 package sqs
 
+import "fmt"
+
 type ArchiveNotification struct {
 	Type             string `json:"Type"`
 	MessageID        string `json:"MessageId"`
@@ -63,3 +65,25 @@ type ChunkNotificationMessage struct {
 	ChunkType string `json:"ChunkType"`
 	L2Version string `json:"L2Version"`
 }
+
+// MissingAttributeError is returned when a chunk notification lacks one of
+// the message attributes an event is built from.
+type MissingAttributeError struct {
+	Attribute string
+}
+
+func (e *MissingAttributeError) Error() string {
+	return fmt.Sprintf("chunk notification is missing the %s attribute", e.Attribute)
+}
+
+// AttributeMismatchError is returned when a chunk notification's message
+// attributes and its message body describe different objects.
+type AttributeMismatchError struct {
+	Attribute string
+	Attr      string
+	Body      string
+}
+
+func (e *AttributeMismatchError) Error() string {
+	return fmt.Sprintf("chunk notification %s attribute %q does not match body %q", e.Attribute, e.Attr, e.Body)
+}
@@ -0,0 +1,42 @@
+package stations
+
+import (
+	"strings"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// Station is where a radar is, as it reports itself.
+type Station struct {
+	ICAO      string    `json:"icao"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Registry records station locations from the volume data block every
+// decoded radial carries, so it needs no site table to be kept up to date
+// and follows radars that move, such as the transportable ones.
+type Registry struct {
+	stations *xsync.MapOf[string, Station]
+}
+
+func NewRegistry() *Registry {
+	return &Registry{stations: xsync.NewMapOf[string, Station]()}
+}
+
+// Observe records a station's reported location.
+func (r *Registry) Observe(icao string, latitude, longitude float64) {
+	// An all-zero volume data block means the radar didn't say.
+	if icao == "" || (latitude == 0 && longitude == 0) {
+		return
+	}
+	icao = strings.ToUpper(icao)
+	r.stations.Store(icao, Station{ICAO: icao, Latitude: latitude, Longitude: longitude, Updated: time.Now()})
+}
+
+// Lookup returns a station's last reported location.
+func (r *Registry) Lookup(icao string) (Station, bool) {
+	return r.stations.Load(strings.ToUpper(icao))
+}
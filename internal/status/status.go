@@ -0,0 +1,286 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+const (
+	// queueSize bounds status changes waiting to be published. Beyond it
+	// they are dropped rather than stalling the event bus.
+	queueSize = 64
+	// samples is how many recent volume intervals per VCP make up the
+	// typical interval.
+	samples = 10
+	// minSamples is how many intervals a VCP needs before its cadence is
+	// judged.
+	minSamples = 3
+	// checkInterval is how often silent stations are looked for.
+	checkInterval = 30 * time.Second
+)
+
+// Subscriptions reports which stations currently have clients.
+type Subscriptions interface {
+	Subscribed(station string) bool
+}
+
+// stationState is what the event stream has told us about one station.
+type stationState struct {
+	status  events.StationState
+	reason  string
+	changed time.Time
+
+	vcp         int
+	volume      time.Time
+	lastChunk   time.Time
+	lastArchive time.Time
+	// lastInterval is the time between the latest two volumes, and
+	// expected what was typical for their VCP before it. expected is zero
+	// when there is nothing to judge lastInterval against.
+	lastInterval time.Duration
+	expected     time.Duration
+	// intervals holds recent volume intervals per VCP.
+	intervals map[int][]time.Duration
+
+	// Chunks only arrive for subscribed stations, so silence is measured
+	// from when the station last gained a subscriber if that is later.
+	watched      bool
+	watchedSince time.Time
+}
+
+// typical is the median recent interval between volumes for vcp.
+func (s *stationState) typical(vcp int) (time.Duration, bool) {
+	intervals := s.intervals[vcp]
+	if len(intervals) < minSamples {
+		return 0, false
+	}
+	sorted := slices.Clone(intervals)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2], true
+}
+
+// Tracker follows each station's chunks and archive files and reports when
+// its feed goes offline or its cadence strays far from normal for its VCP.
+type Tracker struct {
+	config        *config.Status
+	subscriptions Subscriptions
+	publish       chan<- events.Event
+	pending       chan events.Event
+	stations      map[string]*stationState
+	// mu guards stations between handle, the silence checks and Status.
+	mu sync.Mutex
+
+	consumer *events.Consumer
+}
+
+// NewTracker starts tracking the stations announced on eventsChannel and
+// publishes their status changes to publish.
+func NewTracker(config *config.Status, subscriptions Subscriptions, eventsChannel <-chan events.Event, publish chan<- events.Event) *Tracker {
+	t := &Tracker{
+		config:        config,
+		subscriptions: subscriptions,
+		publish:       publish,
+		pending:       make(chan events.Event, queueSize),
+		stations:      make(map[string]*stationState),
+		consumer:      events.NewConsumer(),
+	}
+	t.consumer.Go(t.send)
+	t.consumer.Go(t.checkLoop)
+	t.consumer.Consume(eventsChannel, func(event events.Event) {
+		t.handle(event, time.Now())
+	})
+	return t
+}
+
+// Stop discards status changes that have not been published yet.
+func (t *Tracker) Stop() error {
+	t.consumer.Stop()
+	return nil
+}
+
+// Status returns the current status of station, if it has one yet.
+func (t *Tracker) Status(station string) (events.StationStatusEvent, bool) {
+	station = strings.ToUpper(station)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.stations[station]
+	if !ok || state.status == "" {
+		return events.StationStatusEvent{}, false
+	}
+	return statusEvent(station, state, ""), true
+}
+
+func (t *Tracker) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-t.pending:
+			t.publish <- event
+		}
+	}
+}
+
+func (t *Tracker) checkLoop(ctx context.Context) {
+	ticker := time.NewTicker(min(checkInterval, time.Duration(t.config.OfflineAfter)/4))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.check(now)
+		}
+	}
+}
+
+func (t *Tracker) state(station string) *stationState {
+	state, ok := t.stations[station]
+	if !ok {
+		state = &stationState{intervals: make(map[int][]time.Duration)}
+		t.stations[station] = state
+	}
+	return state
+}
+
+func (t *Tracker) handle(event events.Event, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch ev := event.(type) {
+	case events.NexradChunkEvent:
+		t.onChunk(ev, now)
+	case events.NexradArchiveEvent:
+		station := strings.ToUpper(ev.Station)
+		state := t.state(station)
+		state.lastArchive = now
+		t.evaluate(station, state, now)
+	}
+}
+
+func (t *Tracker) onChunk(chunk events.NexradChunkEvent, now time.Time) {
+	station := strings.ToUpper(chunk.Station)
+	state := t.state(station)
+	state.lastChunk = now
+
+	if !chunk.VolumeStart.IsZero() && chunk.VolumeStart.After(state.volume) {
+		if !state.volume.IsZero() {
+			interval := chunk.VolumeStart.Sub(state.volume)
+			state.lastInterval = interval
+			state.expected = 0
+			// A VCP change restarts the volume early, so says nothing
+			// about either VCP's cadence.
+			if chunk.VCP == 0 || chunk.VCP == state.vcp {
+				state.expected, _ = state.typical(state.vcp)
+				// Longer than offline means the station was down, which
+				// is not its cadence either.
+				if interval <= time.Duration(t.config.OfflineAfter) {
+					intervals := append(state.intervals[state.vcp], interval)
+					state.intervals[state.vcp] = intervals[max(0, len(intervals)-samples):]
+				}
+			}
+		}
+		state.volume = chunk.VolumeStart
+	}
+	// Only decoded chunks know their VCP, and a straggler from the previous
+	// volume must not flip it back.
+	if chunk.VCP != 0 && chunk.VolumeStart.Equal(state.volume) {
+		state.vcp = chunk.VCP
+	}
+	t.evaluate(station, state, now)
+}
+
+func (t *Tracker) check(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for station, state := range t.stations {
+		t.evaluate(station, state, now)
+	}
+}
+
+// evaluate works out the station's status and announces it if it changed.
+func (t *Tracker) evaluate(station string, state *stationState, now time.Time) {
+	subscribed := t.subscriptions.Subscribed(station)
+	if subscribed && !state.watched {
+		state.watchedSince = now
+	}
+	state.watched = subscribed
+
+	status, reason := t.judge(state, now)
+	if status == "" || (status == state.status && reason == state.reason) {
+		return
+	}
+	previous := state.status
+	state.status = status
+	state.reason = reason
+	if status == previous {
+		// Only the reason changed.
+		return
+	}
+	state.changed = now
+	slog.Info("Station status changed", "station", station, "status", status, "previous", previous, "reason", reason)
+	select {
+	case t.pending <- statusEvent(station, state, previous):
+	default:
+		slog.Warn("Status queue full, dropping status", "station", station, "status", status)
+	}
+}
+
+// judge returns the status the station's state calls for, or "" while
+// there is too little to go on.
+func (t *Tracker) judge(state *stationState, now time.Time) (events.StationState, string) {
+	typical, known := state.typical(state.vcp)
+	if state.watched {
+		since := state.lastChunk
+		if state.watchedSince.After(since) {
+			since = state.watchedSince
+		}
+		silentFor := now.Sub(since)
+		if silentFor > time.Duration(t.config.OfflineAfter) {
+			return events.StationOffline, fmt.Sprintf("no chunks for %s", silentFor.Truncate(time.Second))
+		}
+		if !state.lastChunk.IsZero() && known && silentFor > t.scale(typical) {
+			return events.StationDegraded, fmt.Sprintf("no chunks for %s, volumes usually start every %s", silentFor.Truncate(time.Second), typical)
+		}
+	}
+	if state.lastChunk.IsZero() {
+		return "", ""
+	}
+	if state.expected > 0 && (state.lastInterval > t.scale(state.expected) ||
+		state.lastInterval < time.Duration(float64(state.expected)/t.config.DegradedFactor)) {
+		return events.StationDegraded, fmt.Sprintf("last volume took %s, usually %s", state.lastInterval, state.expected)
+	}
+	return events.StationOnline, ""
+}
+
+func (t *Tracker) scale(interval time.Duration) time.Duration {
+	return time.Duration(float64(interval) * t.config.DegradedFactor)
+}
+
+func statusEvent(station string, state *stationState, previous events.StationState) events.StationStatusEvent {
+	event := events.StationStatusEvent{
+		Station:     station,
+		Status:      state.status,
+		Previous:    previous,
+		Reason:      state.reason,
+		VCP:         state.vcp,
+		VolumeStart: state.volume,
+		LastChunk:   state.lastChunk,
+		LastArchive: state.lastArchive,
+		Time:        state.changed,
+	}
+	if typical, ok := state.typical(state.vcp); ok {
+		event.TypicalInterval = typical.String()
+	}
+	if state.lastInterval > 0 {
+		event.LastInterval = state.lastInterval.String()
+	}
+	return event
+}
@@ -0,0 +1,140 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+)
+
+type subscribed map[string]bool
+
+func (s subscribed) Subscribed(station string) bool {
+	return s[station]
+}
+
+func newTestTracker(subscriptions subscribed) *Tracker {
+	return &Tracker{
+		config:        &config.Status{OfflineAfter: config.Duration(20 * time.Minute), DegradedFactor: 2},
+		subscriptions: subscriptions,
+		pending:       make(chan events.Event, queueSize),
+		stations:      make(map[string]*stationState),
+	}
+}
+
+func changes(t *Tracker) []events.StationStatusEvent {
+	var got []events.StationStatusEvent
+	for {
+		select {
+		case event := <-t.pending:
+			got = append(got, event.(events.StationStatusEvent))
+		default:
+			return got
+		}
+	}
+}
+
+// volumes sends the first chunk of count volumes every interval from start,
+// received as they start.
+func volumes(t *Tracker, start time.Time, count int, interval time.Duration, vcp int) time.Time {
+	for i := range count {
+		volumeStart := start.Add(time.Duration(i) * interval)
+		t.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: volumeStart, VCP: vcp, Sequence: 1}, volumeStart)
+	}
+	return start.Add(time.Duration(count-1) * interval)
+}
+
+func TestOnlineAndOffline(t *testing.T) {
+	t.Parallel()
+	tr := newTestTracker(subscribed{"KTLX": true})
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	last := volumes(tr, start, 2, 5*time.Minute, 212)
+
+	got := changes(tr)
+	if len(got) != 1 || got[0].Status != events.StationOnline || got[0].Previous != "" {
+		t.Fatalf("got %+v, want one change to online", got)
+	}
+
+	// Not enough history to judge cadence, so only going offline counts.
+	tr.check(last.Add(15 * time.Minute))
+	if got := changes(tr); len(got) != 0 {
+		t.Errorf("got %+v before the station is offline", got)
+	}
+	tr.check(last.Add(21 * time.Minute))
+	got = changes(tr)
+	if len(got) != 1 || got[0].Status != events.StationOffline || got[0].Previous != events.StationOnline {
+		t.Fatalf("got %+v, want one change to offline", got)
+	}
+	if status, ok := tr.Status("ktlx"); !ok || status.Status != events.StationOffline || status.Reason != "no chunks for 21m0s" {
+		t.Errorf("Status = %+v, %t, want offline", status, ok)
+	}
+
+	// Coming back is online again, and the outage is not a cadence.
+	back := last.Add(time.Hour)
+	tr.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: back, VCP: 212}, back)
+	got = changes(tr)
+	if len(got) != 1 || got[0].Status != events.StationOnline {
+		t.Errorf("got %+v, want one change to online", got)
+	}
+}
+
+func TestUnsubscribedIsNotOffline(t *testing.T) {
+	t.Parallel()
+	subscriptions := subscribed{"KTLX": true}
+	tr := newTestTracker(subscriptions)
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	last := volumes(tr, start, 2, 5*time.Minute, 212)
+	changes(tr)
+
+	subscriptions["KTLX"] = false
+	tr.check(last.Add(time.Hour))
+	// Silence is measured from the new subscriber.
+	subscriptions["KTLX"] = true
+	tr.check(last.Add(2 * time.Hour))
+	tr.check(last.Add(2*time.Hour + 10*time.Minute))
+	if got := changes(tr); len(got) != 0 {
+		t.Errorf("got %+v, want no changes while unsubscribed", got)
+	}
+	tr.check(last.Add(2*time.Hour + 21*time.Minute))
+	if got := changes(tr); len(got) != 1 || got[0].Status != events.StationOffline {
+		t.Errorf("got %+v, want offline", got)
+	}
+}
+
+func TestCadence(t *testing.T) {
+	t.Parallel()
+	tr := newTestTracker(subscribed{"KTLX": true})
+	start := time.Date(2024, 4, 18, 3, 0, 0, 0, time.UTC)
+	last := volumes(tr, start, 5, 5*time.Minute, 212)
+	changes(tr)
+
+	// Two volumes' worth of silence is degraded, short of offline.
+	tr.check(last.Add(11 * time.Minute))
+	got := changes(tr)
+	if len(got) != 1 || got[0].Status != events.StationDegraded || got[0].TypicalInterval != "5m0s" {
+		t.Fatalf("got %+v, want degraded", got)
+	}
+
+	// The late volume keeps it degraded until a normal one follows.
+	late := last.Add(12 * time.Minute)
+	tr.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: late, VCP: 212}, late)
+	if got := changes(tr); len(got) != 0 {
+		t.Errorf("got %+v, want still degraded", got)
+	}
+	if status, _ := tr.Status("KTLX"); status.Reason != "last volume took 12m0s, usually 5m0s" {
+		t.Errorf("Reason = %q", status.Reason)
+	}
+	next := late.Add(5 * time.Minute)
+	tr.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: next, VCP: 212}, next)
+	if got := changes(tr); len(got) != 1 || got[0].Status != events.StationOnline {
+		t.Errorf("got %+v, want online", got)
+	}
+
+	// Switching to clear air restarts the volume early, which is fine.
+	clearAir := next.Add(time.Minute)
+	tr.handle(events.NexradChunkEvent{Station: "KTLX", VolumeStart: clearAir, VCP: 35}, clearAir)
+	if got := changes(tr); len(got) != 0 {
+		t.Errorf("got %+v, want no change for a VCP switch", got)
+	}
+}
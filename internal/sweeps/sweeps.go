@@ -0,0 +1,243 @@
+package sweeps
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+)
+
+const (
+	// expiry is how long an unfinished cut is kept after its last chunk.
+	// A lost chunk means it will never finish.
+	expiry = 15 * time.Minute
+	// sailsTolerance is how close, in degrees, a later surveillance cut must
+	// be to the volume's first to count as a repeat of the lowest tilt.
+	sailsTolerance = 0.1
+	// queueSize bounds completed sweeps waiting to be published. Beyond it
+	// they are dropped rather than stalling the event bus.
+	queueSize = 64
+)
+
+type lowestTilt struct {
+	volume time.Time
+	angle  float64
+}
+
+// volumeCuts is the elevation table from a volume's S chunk.
+type volumeCuts struct {
+	volume time.Time
+	cuts   []level2.Cut
+}
+
+type sweepKey struct {
+	station   string
+	volume    int
+	start     time.Time
+	elevation int
+}
+
+// part is the share of a cut carried by one chunk.
+type part struct {
+	path    string
+	radials []*level2.Radial
+	moments []string
+}
+
+type sweep struct {
+	parts map[int]part
+	// first and last are the sequence numbers of the chunks holding the
+	// cut's first and last radials, once they have been seen.
+	first   int
+	last    int
+	vcp     int
+	updated time.Time
+}
+
+// complete reports whether every chunk from the first radial to the last
+// has arrived. Chunks are handled concurrently, so they can arrive in any
+// order.
+func (s *sweep) complete() bool {
+	if s.first == 0 || s.last == 0 {
+		return false
+	}
+	for sequence := s.first; sequence <= s.last; sequence++ {
+		if _, ok := s.parts[sequence]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Tracker follows the radial status flags of decoded chunks and announces
+// each elevation cut once all of it has arrived.
+type Tracker struct {
+	publish chan<- events.Event
+	pending chan events.Event
+	// sweeps, lowest and cuts are only touched by handle and expire.
+	sweeps map[sweepKey]*sweep
+	lowest map[string]lowestTilt
+	cuts   map[string]volumeCuts
+
+	consumer *events.Consumer
+}
+
+// NewTracker starts tracking the chunks announced on eventsChannel and
+// publishes completed sweeps to publish.
+func NewTracker(eventsChannel <-chan events.Event, publish chan<- events.Event) *Tracker {
+	t := &Tracker{
+		publish:  publish,
+		pending:  make(chan events.Event, queueSize),
+		sweeps:   make(map[sweepKey]*sweep),
+		lowest:   make(map[string]lowestTilt),
+		cuts:     make(map[string]volumeCuts),
+		consumer: events.NewConsumer(),
+	}
+	t.consumer.Go(t.send)
+	t.consumer.ConsumeTicking(eventsChannel, t.handle, expiry/4, t.expire)
+	return t
+}
+
+// Stop discards sweeps that have not been published yet.
+func (t *Tracker) Stop() error {
+	t.consumer.Stop()
+	return nil
+}
+
+func (t *Tracker) handle(event events.Event) {
+	if chunk, ok := event.(events.NexradChunkEvent); ok {
+		t.add(chunk, time.Now())
+	}
+}
+
+func (t *Tracker) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-t.pending:
+			t.publish <- event
+		}
+	}
+}
+
+func (t *Tracker) add(chunk events.NexradChunkEvent, now time.Time) {
+	if len(chunk.Cuts) > 0 {
+		t.cuts[strings.ToUpper(chunk.Station)] = volumeCuts{volume: chunk.VolumeStart, cuts: chunk.Cuts}
+	}
+	for _, elevation := range chunk.Elevations {
+		key := sweepKey{
+			station:   strings.ToUpper(chunk.Station),
+			volume:    chunk.VolumeNumber,
+			start:     chunk.VolumeStart,
+			elevation: elevation.Number,
+		}
+		s, ok := t.sweeps[key]
+		if !ok {
+			s = &sweep{parts: make(map[int]part)}
+			t.sweeps[key] = s
+		}
+		s.updated = now
+		s.vcp = max(s.vcp, chunk.VCP)
+		if elevation.Start {
+			s.first = chunk.Sequence
+		}
+		if elevation.End {
+			s.last = chunk.Sequence
+		}
+		var radials []*level2.Radial
+		for _, radial := range chunk.Radials {
+			if radial.ElevationNumber == elevation.Number {
+				radials = append(radials, radial)
+			}
+		}
+		s.parts[chunk.Sequence] = part{path: chunk.Path, radials: radials, moments: elevation.Moments}
+
+		if s.complete() {
+			delete(t.sweeps, key)
+			event := sweepEvent(key, s)
+			event.LowestTilt = t.lowestTilt(event)
+			t.enqueue(event)
+		}
+	}
+}
+
+// lowestTilt reports whether event is at the lowest elevation of its volume:
+// the first cut, or a supplemental surveillance cut at the same angle. The
+// Doppler half of a split cut repeats the angle too, but is not a new look
+// at the lowest tilt.
+func (t *Tracker) lowestTilt(event events.NexradSweepEvent) bool {
+	if event.ElevationNumber == 1 {
+		t.lowest[event.Station] = lowestTilt{volume: event.VolumeStart, angle: event.Angle}
+		return true
+	}
+	lowest, ok := t.lowest[event.Station]
+	if !ok || !lowest.volume.Equal(event.VolumeStart) || math.Abs(event.Angle-lowest.angle) > sailsTolerance {
+		return false
+	}
+	return t.surveillance(event)
+}
+
+// surveillance reports whether event is a surveillance cut, going by the
+// waveform in its volume's Message 5. If the S chunk hasn't been seen, a
+// cut without velocity is taken to be the surveillance half of a split cut.
+func (t *Tracker) surveillance(event events.NexradSweepEvent) bool {
+	vcp, ok := t.cuts[event.Station]
+	if ok && vcp.volume.Equal(event.VolumeStart) && event.ElevationNumber <= len(vcp.cuts) {
+		return vcp.cuts[event.ElevationNumber-1].Waveform.Surveillance()
+	}
+	return !slices.Contains(event.Moments, "VEL")
+}
+
+func (t *Tracker) enqueue(event events.NexradSweepEvent) {
+	slog.Info("Sweep complete", "station", event.Station, "volume", event.VolumeNumber, "elevation", event.ElevationNumber, "angle", event.Angle)
+	select {
+	case t.pending <- event:
+	default:
+		slog.Warn("Sweep queue full, dropping sweep", "station", event.Station, "volume", event.VolumeNumber, "elevation", event.ElevationNumber)
+	}
+}
+
+func (t *Tracker) expire(now time.Time) {
+	for key, s := range t.sweeps {
+		if now.Sub(s.updated) > expiry {
+			slog.Debug("Abandoning incomplete sweep", "station", key.station, "volume", key.volume, "elevation", key.elevation)
+			delete(t.sweeps, key)
+		}
+	}
+}
+
+func sweepEvent(key sweepKey, s *sweep) events.NexradSweepEvent {
+	event := events.NexradSweepEvent{
+		Station:         key.station,
+		VolumeNumber:    key.volume,
+		VolumeStart:     key.start,
+		ElevationNumber: key.elevation,
+		VCP:             s.vcp,
+		Moments:         []string{},
+	}
+	var sum float64
+	for sequence := s.first; sequence <= s.last; sequence++ {
+		p := s.parts[sequence]
+		event.Chunks = append(event.Chunks, p.path)
+		event.Radials = append(event.Radials, p.radials...)
+		for _, moment := range p.moments {
+			if !slices.Contains(event.Moments, moment) {
+				event.Moments = append(event.Moments, moment)
+			}
+		}
+		for _, radial := range p.radials {
+			sum += float64(radial.Elevation)
+		}
+	}
+	slices.Sort(event.Moments)
+	if len(event.Radials) > 0 {
+		event.Angle = math.Round(sum/float64(len(event.Radials))*100) / 100
+	}
+	return event
+}
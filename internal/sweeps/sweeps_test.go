@@ -0,0 +1,209 @@
+package sweeps_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/decoder"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/s3"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sweeps"
+)
+
+const bucket = "unidata-nexrad-level2-chunks"
+
+// decodedChunks decodes the level2 fixtures the way the listener would
+// before publishing them.
+func decodedChunks(t *testing.T) map[int]events.NexradChunkEvent {
+	t.Helper()
+	fixtures := http.StripPrefix("/"+bucket+"/", http.FileServer(http.Dir("../level2/testdata")))
+	server := httptest.NewServer(fixtures)
+	t.Cleanup(server.Close)
+	d := decoder.NewDecoder(s3.NewClient(server.URL), stations.NewRegistry())
+
+	chunks := make(map[int]events.NexradChunkEvent)
+	for sequence, name := range map[int]string{1: "001-S", 2: "002-I", 3: "003-I", 4: "004-E"} {
+		event := events.NexradChunkEvent{
+			Station:      "KTLX",
+			Bucket:       bucket,
+			Path:         "KTLX-20240418-033635-" + name,
+			VolumeStart:  time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+			Sequence:     sequence,
+			VolumeNumber: 415,
+		}
+		if err := d.Enrich(context.Background(), &event); err != nil {
+			t.Fatal(err)
+		}
+		chunks[sequence] = event
+	}
+	return chunks
+}
+
+func TestSweepComplete(t *testing.T) {
+	t.Parallel()
+	chunks := decodedChunks(t)
+
+	in := make(chan events.Event, 10)
+	out := make(chan events.Event, 10)
+	tracker := sweeps.NewTracker(in, out)
+	t.Cleanup(func() {
+		close(in)
+		_ = tracker.Stop()
+	})
+
+	// Out of order: neither cut is whole until chunk 3 lands.
+	in <- chunks[1]
+	in <- chunks[4]
+	in <- chunks[2]
+	select {
+	case event := <-out:
+		t.Fatalf("unexpected early event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	in <- chunks[3]
+
+	got := make(map[int]events.NexradSweepEvent)
+	for range 2 {
+		select {
+		case event := <-out:
+			sweep, ok := event.(events.NexradSweepEvent)
+			if !ok {
+				t.Fatalf("got %T, want NexradSweepEvent", event)
+			}
+			got[sweep.ElevationNumber] = sweep
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for sweeps")
+		}
+	}
+
+	tests := []struct {
+		elevation int
+		angle     float64
+		chunks    []string
+	}{
+		{1, 0.48, []string{"KTLX-20240418-033635-002-I", "KTLX-20240418-033635-003-I"}},
+		{2, 0.88, []string{"KTLX-20240418-033635-003-I", "KTLX-20240418-033635-004-E"}},
+	}
+	for _, tt := range tests {
+		sweep, ok := got[tt.elevation]
+		if !ok {
+			t.Errorf("no sweep for elevation %d", tt.elevation)
+			continue
+		}
+		if sweep.Station != "KTLX" || sweep.VolumeNumber != 415 || sweep.VCP != 212 {
+			t.Errorf("elevation %d: unexpected sweep %+v", tt.elevation, sweep)
+		}
+		if sweep.LowestTilt != (tt.elevation == 1) {
+			t.Errorf("elevation %d: LowestTilt = %t", tt.elevation, sweep.LowestTilt)
+		}
+		if sweep.Angle != tt.angle {
+			t.Errorf("elevation %d: Angle = %v, want %v", tt.elevation, sweep.Angle, tt.angle)
+		}
+		if !slices.Equal(sweep.Moments, []string{"REF", "VEL"}) {
+			t.Errorf("elevation %d: Moments = %v, want [REF VEL]", tt.elevation, sweep.Moments)
+		}
+		if !slices.Equal(sweep.Chunks, tt.chunks) {
+			t.Errorf("elevation %d: Chunks = %v, want %v", tt.elevation, sweep.Chunks, tt.chunks)
+		}
+		if len(sweep.Radials) != 360 {
+			t.Errorf("elevation %d: got %d radials, want 360", tt.elevation, len(sweep.Radials))
+		}
+	}
+}
+
+func TestSweepIgnoresUndecodedChunks(t *testing.T) {
+	t.Parallel()
+	in := make(chan events.Event, 10)
+	out := make(chan events.Event, 10)
+	tracker := sweeps.NewTracker(in, out)
+	t.Cleanup(func() {
+		close(in)
+		_ = tracker.Stop()
+	})
+
+	in <- events.NexradChunkEvent{Station: "KTLX", Sequence: 2, VolumeNumber: 415}
+	select {
+	case event := <-out:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// wholeCut returns a chunk holding all of one elevation cut.
+func wholeCut(sequence, elevation int, angle float32, moments ...string) events.NexradChunkEvent {
+	return events.NexradChunkEvent{
+		Station:      "KTLX",
+		Path:         fmt.Sprintf("KTLX-20240418-033635-%03d-I", sequence),
+		VolumeStart:  time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		Sequence:     sequence,
+		VolumeNumber: 415,
+		Elevations:   []events.ChunkElevation{{Number: elevation, Moments: moments, Start: true, End: true}},
+		Radials:      []*level2.Radial{{ElevationNumber: elevation, Elevation: angle}},
+	}
+}
+
+func TestSweepSplitCuts(t *testing.T) {
+	t.Parallel()
+
+	// A split cut VCP with SAILS: the 0.5 degree tilt is scanned twice,
+	// surveillance then Doppler, before 0.9 degrees and a SAILS re-scan.
+	vcp := []level2.Cut{
+		{Angle: 0.5, Waveform: level2.WaveformContiguousSurveillance},
+		{Angle: 0.5, Waveform: level2.WaveformContiguousDoppler},
+		{Angle: 0.9, Waveform: level2.WaveformContiguousSurveillance},
+		{Angle: 0.5, Waveform: level2.WaveformContiguousSurveillance},
+	}
+	tests := []struct {
+		name string
+		cuts []level2.Cut
+	}{
+		{"message 5", vcp},
+		// Without the S chunk, the Doppler half is told apart by velocity.
+		{"moments", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			in := make(chan events.Event, 10)
+			out := make(chan events.Event, 10)
+			tracker := sweeps.NewTracker(in, out)
+			t.Cleanup(func() {
+				close(in)
+				_ = tracker.Stop()
+			})
+
+			start := wholeCut(1, 0, 0)
+			start.Elevations = nil
+			start.Radials = nil
+			start.Cuts = tt.cuts
+			in <- start
+			in <- wholeCut(2, 1, 0.48, "REF")
+			in <- wholeCut(3, 2, 0.48, "REF", "VEL")
+			in <- wholeCut(4, 3, 0.88, "REF")
+			in <- wholeCut(5, 4, 0.48, "REF")
+
+			want := map[int]bool{1: true, 2: false, 3: false, 4: true}
+			for range want {
+				select {
+				case event := <-out:
+					sweep, ok := event.(events.NexradSweepEvent)
+					if !ok {
+						t.Fatalf("got %T, want NexradSweepEvent", event)
+					}
+					if sweep.LowestTilt != want[sweep.ElevationNumber] {
+						t.Errorf("elevation %d: LowestTilt = %t, want %t", sweep.ElevationNumber, sweep.LowestTilt, want[sweep.ElevationNumber])
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for sweeps")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// firstFD is the first file descriptor systemd passes sockets from.
+const firstFD = 3
+
+// Notify states.
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+var ErrNoSockets = errors.New("no sockets passed by systemd")
+
+type socket struct {
+	fd    uintptr
+	name  string
+	taken bool
+}
+
+//nolint:golint,gochecknoglobals
+var (
+	inheritOnce sync.Once
+	inheritMu   sync.Mutex
+	inherited   []*socket
+)
+
+// parseInherited reads the sockets systemd passed from the LISTEN_*
+// variables, which are only for us when LISTEN_PID is our PID.
+func parseInherited(pid, fds, names string) []*socket {
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count <= 0 {
+		return nil
+	}
+	// Without FileDescriptorName= systemd names each socket "unknown".
+	nameList := strings.Split(names, ":")
+	sockets := make([]*socket, count)
+	for i := range sockets {
+		sockets[i] = &socket{fd: uintptr(firstFD + i), name: "unknown"}
+		if i < len(nameList) && nameList[i] != "" {
+			sockets[i].name = nameList[i]
+		}
+	}
+	return sockets
+}
+
+// Listeners takes the sockets systemd passed with FileDescriptorName= name,
+// or all of them when name is empty. Each socket is handed out once.
+func Listeners(name string) ([]net.Listener, error) {
+	inheritOnce.Do(func() {
+		inherited = parseInherited(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+		// Like sd_listen_fds, keep them from being passed on to children.
+		for _, s := range inherited {
+			syscall.CloseOnExec(int(s.fd))
+		}
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	})
+
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+	var listeners []net.Listener
+	for _, s := range inherited {
+		if s.taken || (name != "" && s.name != name) {
+			continue
+		}
+		file := os.NewFile(s.fd, s.name)
+		listener, err := net.FileListener(file)
+		// FileListener works on a duplicate.
+		_ = file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("socket %q from systemd: %w", s.name, err)
+		}
+		s.taken = true
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("%w named %q", ErrNoSockets, name)
+		}
+		return nil, ErrNoSockets
+	}
+	return listeners, nil
+}
+
+// Notify tells systemd of state. It does nothing unless the service is run
+// with Type=notify, or otherwise has NOTIFY_SOCKET set.
+func Notify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// A leading @ is an abstract socket, which net handles itself.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval is how often systemd expects a watchdog ping, and whether
+// it expects them at all.
+func WatchdogInterval() (time.Duration, bool) {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// Watchdog pings the systemd watchdog while live reports true, so systemd
+// restarts the service once it stops, as Kubernetes would on a failing
+// /healthz.
+type Watchdog struct {
+	interval time.Duration
+	live     func() bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewWatchdog pings at half of interval, leaving room for a ping to be
+// late.
+func NewWatchdog(interval time.Duration, live func() bool) *Watchdog {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watchdog{
+		interval: interval,
+		live:     live,
+		cancel:   cancel,
+	}
+	w.wg.Add(1)
+	go w.run(ctx)
+	return w
+}
+
+func (w *Watchdog) run(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !w.live() {
+				slog.Warn("Withholding systemd watchdog ping while not live")
+				continue
+			}
+			if err := Notify(StateWatchdog); err != nil {
+				slog.Warn("Failed to ping systemd watchdog", "error", err)
+			}
+		}
+	}
+}
+
+func (w *Watchdog) Stop() error {
+	w.cancel()
+	w.wg.Wait()
+	return nil
+}
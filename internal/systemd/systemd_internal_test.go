@@ -0,0 +1,102 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseInherited(t *testing.T) {
+	t.Parallel()
+	pid := strconv.Itoa(os.Getpid())
+
+	sockets := parseInherited(pid, "3", "api:metrics")
+	if len(sockets) != 3 {
+		t.Fatalf("parseInherited() = %d sockets, want 3", len(sockets))
+	}
+	for i, want := range []struct {
+		fd   uintptr
+		name string
+	}{{3, "api"}, {4, "metrics"}, {5, "unknown"}} {
+		if sockets[i].fd != want.fd || sockets[i].name != want.name {
+			t.Errorf("socket %d = %d %q, want %d %q", i, sockets[i].fd, sockets[i].name, want.fd, want.name)
+		}
+	}
+
+	if sockets := parseInherited("1", "2", ""); sockets != nil {
+		t.Errorf("sockets for another process = %v, want none", sockets)
+	}
+	if sockets := parseInherited(pid, "", ""); sockets != nil {
+		t.Errorf("sockets without LISTEN_FDS = %v, want none", sockets)
+	}
+}
+
+// listenNotify stands in for systemd's notify socket. The tests using it set
+// process-wide environment variables, so they can't run in parallel.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn, timeout time.Duration) (string, bool) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", false
+	}
+	return string(buf[:n]), true
+}
+
+func TestNotify(t *testing.T) {
+	conn := listenNotify(t)
+	if err := Notify(StateReady); err != nil {
+		t.Fatal(err)
+	}
+	if state, ok := receive(t, conn, time.Second); state != StateReady {
+		t.Errorf("received %q, %t, want %q", state, ok, StateReady)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify(StateReady); err != nil {
+		t.Errorf("Notify() without systemd error = %v", err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "40000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	interval, ok := WatchdogInterval()
+	if !ok || interval != 40*time.Millisecond {
+		t.Fatalf("WatchdogInterval() = %s, %t, want 40ms", interval, ok)
+	}
+
+	var live atomic.Bool
+	w := NewWatchdog(interval, live.Load)
+	t.Cleanup(func() { _ = w.Stop() })
+	if state, ok := receive(t, conn, 100*time.Millisecond); ok {
+		t.Errorf("received %q while not live, want nothing", state)
+	}
+	live.Store(true)
+	if state, ok := receive(t, conn, time.Second); state != StateWatchdog {
+		t.Errorf("received %q, %t, want %q", state, ok, StateWatchdog)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("WatchdogInterval() is set for another process")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/auth"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
 	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/sqs"
@@ -95,7 +96,9 @@ func CreateHandler(newHandler func() Websocket, config *config.HTTP) func(*gin.C
 			ReadBufferSize:   bufferSize,
 			WriteBufferSize:  bufferSize,
 			WriteBufferPool:  nil,
-			Subprotocols:     []string{},
+			// Offered by clients that send their credential as a
+			// subprotocol.
+			Subprotocols: []string{auth.Subprotocol},
 			Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
 				slog.Warn("Websocket handshake failed",
 					"status", status, "reason", reason,
@@ -128,6 +131,12 @@ func CreateHandler(newHandler func() Websocket, config *config.HTTP) func(*gin.C
 			c.String(http.StatusBadRequest, "type and station are required")
 			return
 		}
+		// Only set when auth is enabled.
+		if principal, ok := c.Value("principal").(*auth.Principal); ok && !principal.Allows(messageType, station) {
+			slog.Warn("Websocket subscription not allowed", "principal", principal.Name, "type", messageType, "station", station)
+			c.String(http.StatusForbidden, "not allowed to subscribe to %s for %s", messageType, station)
+			return
+		}
 		sqsListener, ok := c.MustGet("sqsListener").(*sqs.Listener)
 		if !ok {
 			slog.Error("Failed to get sqsListener")
@@ -0,0 +1,95 @@
+package zones
+
+import (
+	"math"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+)
+
+const (
+	earthRadiusKm       = 6371.0
+	kmPerDegreeLatitude = 111.32
+)
+
+//nolint:golint,gochecknoglobals
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+type point struct {
+	latitude  float64
+	longitude float64
+}
+
+// shape is a configured zone ready for testing gates against.
+type shape struct {
+	// center is where distances and bearings are measured from: the point
+	// of a point-radius zone, or the mean of a polygon's vertices.
+	center  point
+	radius  float64
+	polygon []point
+}
+
+func newShape(zone config.Zone) shape {
+	if zone.Point != nil {
+		return shape{
+			center: point{zone.Point.Latitude, zone.Point.Longitude},
+			radius: zone.Point.Radius,
+		}
+	}
+	s := shape{polygon: make([]point, 0, len(zone.Polygon))}
+	for _, vertex := range zone.Polygon {
+		s.polygon = append(s.polygon, point{vertex[0], vertex[1]})
+		s.center.latitude += vertex[0]
+		s.center.longitude += vertex[1]
+	}
+	s.center.latitude /= float64(len(zone.Polygon))
+	s.center.longitude /= float64(len(zone.Polygon))
+	return s
+}
+
+func (s shape) contains(p point) bool {
+	if s.polygon == nil {
+		return distance(s.center, p) <= s.radius
+	}
+	// Ray casting: count the edges crossed by a line east from p.
+	inside := false
+	for i, j := 0, len(s.polygon)-1; i < len(s.polygon); j, i = i, i+1 {
+		a, b := s.polygon[i], s.polygon[j]
+		if (a.latitude > p.latitude) != (b.latitude > p.latitude) &&
+			p.longitude < a.longitude+(p.latitude-a.latitude)*(b.longitude-a.longitude)/(b.latitude-a.latitude) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// gateLocation places a gate rangeKm from the radar along azimuth degrees,
+// treating the earth as flat over the radar's reach as the imagery does.
+func gateLocation(radar point, azimuth, rangeKm float64) point {
+	theta := azimuth * math.Pi / 180
+	return point{
+		latitude:  radar.latitude + rangeKm*math.Cos(theta)/kmPerDegreeLatitude,
+		longitude: radar.longitude + rangeKm*math.Sin(theta)/(kmPerDegreeLatitude*math.Cos(radar.latitude*math.Pi/180)),
+	}
+}
+
+// distance is the great-circle distance from a to b in kilometers.
+func distance(a, b point) float64 {
+	lat1, lat2 := a.latitude*math.Pi/180, b.latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.longitude - a.longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// bearing is the initial bearing from a to b in degrees clockwise from north.
+func bearing(a, b point) float64 {
+	lat1, lat2 := a.latitude*math.Pi/180, b.latitude*math.Pi/180
+	dLon := (b.longitude - a.longitude) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+func compass(bearing float64) string {
+	return compassPoints[int(math.Round(bearing/22.5))%len(compassPoints)]
+}
@@ -0,0 +1,241 @@
+package zones
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+const (
+	ConditionReflectivity = "reflectivity"
+
+	// queueSize bounds sweeps waiting to be checked. Beyond it new sweeps
+	// are skipped rather than stalling the event bus.
+	queueSize = 16
+)
+
+type zone struct {
+	config.Zone
+	shape shape
+}
+
+type alertKey struct {
+	zone    string
+	station string
+}
+
+// alertState is what has been alerted for one zone and station.
+type alertState struct {
+	// active is set while echoes above the threshold are in the zone.
+	active  bool
+	alerted time.Time
+}
+
+// hit is the strongest gate found in a zone.
+type hit struct {
+	dbz      float64
+	location point
+	// distance is from the zone's center, in kilometers.
+	distance float64
+	azimuth  float64
+	rangeKm  float64
+	gates    int
+}
+
+// Monitor checks the reflectivity of every lowest-tilt sweep against the
+// configured zones and raises a NexradAlertEvent when echoes enter one.
+type Monitor struct {
+	zones    []zone
+	registry *stations.Registry
+	publish  chan<- events.Event
+	jobs     chan events.NexradSweepEvent
+	// alerts is only touched by worker.
+	alerts map[alertKey]*alertState
+
+	consumer *events.Consumer
+}
+
+// NewMonitor starts checking the sweeps announced on eventsChannel and
+// publishes alerts to publish.
+func NewMonitor(zones []config.Zone, registry *stations.Registry, eventsChannel <-chan events.Event, publish chan<- events.Event) *Monitor {
+	m := &Monitor{
+		zones:    newZones(zones),
+		registry: registry,
+		publish:  publish,
+		jobs:     make(chan events.NexradSweepEvent, queueSize),
+		alerts:   make(map[alertKey]*alertState),
+		consumer: events.NewConsumer(),
+	}
+	m.consumer.Go(m.worker)
+	m.consumer.Consume(eventsChannel, m.handle)
+	return m
+}
+
+func newZones(configs []config.Zone) []zone {
+	zones := make([]zone, 0, len(configs))
+	for _, c := range configs {
+		zones = append(zones, zone{Zone: c, shape: newShape(c)})
+	}
+	return zones
+}
+
+// Stop waits for the sweep being checked, if any.
+func (m *Monitor) Stop() error {
+	m.consumer.Stop()
+	return nil
+}
+
+func (m *Monitor) handle(event events.Event) {
+	sweep, ok := event.(events.NexradSweepEvent)
+	if !ok || !sweep.LowestTilt || !slices.Contains(sweep.Moments, "REF") {
+		return
+	}
+	select {
+	case m.jobs <- sweep:
+	default:
+		slog.Warn("Zone queue full, skipping sweep", "station", sweep.Station, "volume", sweep.VolumeNumber, "elevation", sweep.ElevationNumber)
+	}
+}
+
+func (m *Monitor) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sweep := <-m.jobs:
+			for _, alert := range m.check(sweep, time.Now()) {
+				if m.consumer.Stopped() {
+					return
+				}
+				m.publish <- alert
+			}
+		}
+	}
+}
+
+// check returns the alerts raised by sweep. One storm alerts once: a zone
+// and station stay quiet until echoes have left the zone for a scan and the
+// zone's cooldown has passed.
+func (m *Monitor) check(sweep events.NexradSweepEvent, now time.Time) []events.NexradAlertEvent {
+	station := strings.ToUpper(sweep.Station)
+	var radar *stations.Station
+	var alerts []events.NexradAlertEvent
+	for _, z := range m.zones {
+		if !applies(z, station) {
+			continue
+		}
+		if radar == nil {
+			found, ok := m.registry.Lookup(station)
+			if !ok {
+				slog.Warn("Station location unknown, skipping zones", "station", station)
+				return nil
+			}
+			radar = &found
+		}
+
+		key := alertKey{zone: z.Name, station: station}
+		state, ok := m.alerts[key]
+		if !ok {
+			state = &alertState{}
+			m.alerts[key] = state
+		}
+		h, found := strongest(z, point{radar.Latitude, radar.Longitude}, sweep)
+		if !found {
+			state.active = false
+			continue
+		}
+		wasActive := state.active
+		state.active = true
+		if wasActive || now.Sub(state.alerted) < time.Duration(z.Cooldown) {
+			continue
+		}
+		state.alerted = now
+		alerts = append(alerts, alert(z, station, sweep, h, now))
+	}
+	return alerts
+}
+
+// strongest finds the strongest gate of sweep at or above the zone's
+// threshold that lies inside the zone, the closest to its center of those
+// equally strong.
+func strongest(z zone, radar point, sweep events.NexradSweepEvent) (hit, bool) {
+	var h hit
+	for _, radial := range sweep.Radials {
+		ref, ok := radial.Moments["REF"]
+		if !ok {
+			continue
+		}
+		for gate := range ref.Gates {
+			dbz, ok := ref.Value(gate)
+			if !ok || float64(dbz) < z.Threshold {
+				continue
+			}
+			rangeKm := (ref.FirstGate + float64(gate)*ref.GateSpacing) / 1000
+			location := gateLocation(radar, float64(radial.Azimuth), rangeKm)
+			if !z.shape.contains(location) {
+				continue
+			}
+			h.gates++
+			d := distance(z.shape.center, location)
+			if h.gates == 1 || float64(dbz) > h.dbz || (float64(dbz) == h.dbz && d < h.distance) {
+				h.dbz = float64(dbz)
+				h.location = location
+				h.distance = d
+				h.azimuth = float64(radial.Azimuth)
+				h.rangeKm = rangeKm
+			}
+		}
+	}
+	return h, h.gates > 0
+}
+
+func alert(z zone, station string, sweep events.NexradSweepEvent, h hit, now time.Time) events.NexradAlertEvent {
+	distanceKm := round(h.distance, 1)
+	direction := round(bearing(z.shape.center, h.location), 0)
+	message := fmt.Sprintf("%s sees %.1f dBZ %.1f km %s of %s", station, h.dbz, distanceKm, compass(direction), z.Name)
+	slog.Info("Zone alert", "zone", z.Name, "station", station, "message", message)
+	return events.NexradAlertEvent{
+		Station:   station,
+		Rule:      z.Name,
+		Condition: ConditionReflectivity,
+		Message:   message,
+		Evidence: map[string]any{
+			"maxDbz":          h.dbz,
+			"threshold":       z.Threshold,
+			"distance":        distanceKm,
+			"bearing":         direction,
+			"latitude":        round(h.location.latitude, 4),
+			"longitude":       round(h.location.longitude, 4),
+			"azimuth":         round(h.azimuth, 1),
+			"range":           round(h.rangeKm, 1),
+			"gates":           h.gates,
+			"volumeNumber":    sweep.VolumeNumber,
+			"volumeStart":     sweep.VolumeStart,
+			"elevationNumber": sweep.ElevationNumber,
+			"angle":           sweep.Angle,
+		},
+		Time: now,
+	}
+}
+
+func applies(z zone, station string) bool {
+	if len(z.Stations) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(z.Stations, func(s string) bool {
+		return strings.EqualFold(s, station)
+	})
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
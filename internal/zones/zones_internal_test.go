@@ -0,0 +1,143 @@
+package zones
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/config"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/events"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/level2"
+	"github.com/USA-RedDragon/nexrad-aws-notifier/internal/stations"
+)
+
+// lowestSweep decodes elevation 1 from the level2 fixtures. Its 55 dBZ cell
+// covers azimuths 200-229 and gates 100-159, 27-42 km from the radar.
+func lowestSweep(t *testing.T) events.NexradSweepEvent {
+	t.Helper()
+	sweep := events.NexradSweepEvent{
+		Station:         "KTLX",
+		VolumeNumber:    415,
+		VolumeStart:     time.Date(2024, 4, 18, 3, 36, 35, 0, time.UTC),
+		ElevationNumber: 1,
+		Angle:           0.48,
+		LowestTilt:      true,
+		Moments:         []string{"REF", "VEL"},
+	}
+	for _, name := range []string{"002-I", "003-I"} {
+		data, err := os.ReadFile(filepath.Join("..", "level2", "testdata", "KTLX-20240418-033635-"+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := level2.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, radial := range chunk.Radials {
+			if radial.ElevationNumber == 1 {
+				sweep.Radials = append(sweep.Radials, radial)
+			}
+		}
+	}
+	return sweep
+}
+
+func newTestMonitor(t *testing.T, zones ...config.Zone) *Monitor {
+	t.Helper()
+	registry := stations.NewRegistry()
+	registry.Observe("KTLX", 35.3331, -97.2778)
+	return &Monitor{
+		zones:    newZones(zones),
+		registry: registry,
+		alerts:   make(map[alertKey]*alertState),
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	// The middle of the cell: azimuth 215°, 34.6 km out.
+	cell := gateLocation(point{35.3331, -97.2778}, 215, 34.6)
+	m := newTestMonitor(t,
+		config.Zone{Name: "venue", Threshold: 50, Point: &config.ZonePoint{Latitude: cell.latitude, Longitude: cell.longitude + 0.3, Radius: 30}},
+		// The cell is outside 20 km of the radar.
+		config.Zone{Name: "radar", Threshold: 50, Point: &config.ZonePoint{Latitude: 35.3331, Longitude: -97.2778, Radius: 20}},
+		config.Zone{Name: "box", Stations: []string{"ktlx"}, Threshold: 50, Polygon: [][2]float64{
+			{cell.latitude - 0.05, cell.longitude - 0.05},
+			{cell.latitude + 0.05, cell.longitude - 0.05},
+			{cell.latitude + 0.05, cell.longitude + 0.05},
+			{cell.latitude - 0.05, cell.longitude + 0.05},
+		}},
+		config.Zone{Name: "elsewhere", Stations: []string{"KFWS"}, Threshold: 50, Point: &config.ZonePoint{Latitude: cell.latitude, Longitude: cell.longitude, Radius: 15}},
+	)
+	sweep := lowestSweep(t)
+
+	got := m.check(sweep, time.Now())
+	if len(got) != 2 {
+		t.Fatalf("got %d alerts, want 2: %+v", len(got), got)
+	}
+	venue, box := got[0], got[1]
+	if venue.Rule != "venue" || venue.Station != "KTLX" || venue.Condition != ConditionReflectivity {
+		t.Errorf("first alert = %+v, want venue for KTLX", venue)
+	}
+	if venue.Evidence["maxDbz"] != 55.0 {
+		t.Errorf("maxDbz = %v, want 55", venue.Evidence["maxDbz"])
+	}
+	// The venue is 27 km east of the cell's middle, so the nearest edge of
+	// the cell lies closer, to its west.
+	if distance := venue.Evidence["distance"].(float64); distance < 5 || distance > 25 {
+		t.Errorf("distance = %v km, want the near edge of the cell", distance)
+	}
+	if bearing := venue.Evidence["bearing"].(float64); bearing < 225 || bearing > 315 {
+		t.Errorf("bearing = %v, want westward", bearing)
+	}
+	if box.Rule != "box" {
+		t.Errorf("second alert = %+v, want box", box)
+	}
+}
+
+func TestCheckDeduplicates(t *testing.T) {
+	t.Parallel()
+	cooldown := config.Duration(30 * time.Minute)
+	m := newTestMonitor(t, config.Zone{Name: "venue", Threshold: 50, Cooldown: cooldown, Point: &config.ZonePoint{Latitude: 35.0785, Longitude: -97.4964, Radius: 10}})
+	sweep := lowestSweep(t)
+	quiet := sweep
+	quiet.Radials = nil
+	now := time.Now()
+
+	if got := m.check(sweep, now); len(got) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(got))
+	}
+	// Leaving and coming back within the cooldown stays quiet.
+	m.check(quiet, now.Add(5*time.Minute))
+	if got := m.check(sweep, now.Add(10*time.Minute)); len(got) != 0 {
+		t.Errorf("got %d alerts within the cooldown, want 0", len(got))
+	}
+	// Staying in the zone stays quiet after the cooldown too.
+	if got := m.check(sweep, now.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("got %d alerts for the same storm, want 0", len(got))
+	}
+	m.check(quiet, now.Add(65*time.Minute))
+	if got := m.check(sweep, now.Add(70*time.Minute)); len(got) != 1 {
+		t.Errorf("got %d alerts for a new storm, want 1", len(got))
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	t.Parallel()
+	okc := point{35.4676, -97.5164}
+	tulsa := point{36.1540, -95.9928}
+	if d := distance(okc, tulsa); math.Abs(d-158) > 2 {
+		t.Errorf("distance = %v km, want about 158", d)
+	}
+	if b := bearing(okc, tulsa); math.Abs(b-61) > 2 {
+		t.Errorf("bearing = %v, want about 61", b)
+	}
+	if got := compass(350); got != "N" {
+		t.Errorf("compass(350) = %s, want N", got)
+	}
+	if got := compass(225); got != "SW" {
+		t.Errorf("compass(225) = %s, want SW", got)
+	}
+}